@@ -3,6 +3,16 @@ package main
 import (
 	"chat-client/internal/chat"
 	"chat-client/internal/discovery"
+	"chat-client/internal/export"
+	"chat-client/internal/identity"
+	"chat-client/internal/lock"
+	"chat-client/internal/mesh"
+	"chat-client/internal/presence"
+	"chat-client/internal/profile"
+	"chat-client/internal/protocol"
+	"chat-client/internal/retention"
+	"chat-client/internal/rotation"
+	"chat-client/internal/session"
 	"chat-client/internal/user"
 	"chat-client/pkg/store"
 	"context"
@@ -15,15 +25,35 @@ type App struct {
 	userService      *user.UserService
 	chatService      *chat.ChatService
 	discoveryService *discovery.DiscoveryService
+	exportService    *export.ExportService
+	identityService  *identity.IdentityService
+	lockService      *lock.LockService
+	meshService      *mesh.MeshService
+	presenceService  *presence.PresenceService
+	profileService   *profile.ProfileService
+	protocolService  *protocol.ProtocolService
+	retentionService *retention.RetentionService
+	rotationService  *rotation.RotationService
+	sessionService   *session.SessionService
 }
 
 // NewApp creates a new App application struct
-func NewApp(s *store.Store, userService *user.UserService, chatService *chat.ChatService, discoveryService *discovery.DiscoveryService) *App {
+func NewApp(s *store.Store, userService *user.UserService, chatService *chat.ChatService, discoveryService *discovery.DiscoveryService, exportService *export.ExportService, identityService *identity.IdentityService, lockService *lock.LockService, meshService *mesh.MeshService, presenceService *presence.PresenceService, profileService *profile.ProfileService, protocolService *protocol.ProtocolService, retentionService *retention.RetentionService, rotationService *rotation.RotationService, sessionService *session.SessionService) *App {
 	return &App{
 		s:                s,
 		userService:      userService,
 		chatService:      chatService,
 		discoveryService: discoveryService,
+		exportService:    exportService,
+		identityService:  identityService,
+		lockService:      lockService,
+		meshService:      meshService,
+		presenceService:  presenceService,
+		profileService:   profileService,
+		protocolService:  protocolService,
+		retentionService: retentionService,
+		rotationService:  rotationService,
+		sessionService:   sessionService,
 	}
 }
 
@@ -35,8 +65,52 @@ func (a *App) startup(ctx context.Context) {
 	a.userService.Startup(ctx)
 	a.chatService.Startup(ctx)
 	a.discoveryService.Startup(ctx)
+	a.exportService.Startup(ctx)
+	a.identityService.Startup(ctx)
+	a.lockService.Startup(ctx)
+	a.meshService.Startup(ctx)
+	a.presenceService.Startup(ctx)
+	a.profileService.Startup(ctx)
+	a.protocolService.Startup(ctx)
+	a.retentionService.Startup(ctx)
+	a.rotationService.Startup(ctx)
+	a.sessionService.Startup(ctx)
+
+	// gossip routes to contacts while mesh mode is enabled
+	go a.meshService.GossipRoutes()
+
+	// keep persistent sessions with online contacts
+	go a.sessionService.MaintainSessions()
+
+	// turn away after inactivity and keep contacts up to date with our presence
+	go a.presenceService.WatchPresence()
+
+	// lock the session and wipe keys after inactivity
+	go a.lockService.WatchLock()
+
+	// exchange identity keys with contacts paired before signing
+	go a.identityService.WatchIdentities()
+
+	// rotate shared keys of contacts once they carried enough messages or grew old
+	go a.rotationService.WatchRotation()
+
+	// push contacts to the other devices of the user that missed a pairing or rotation
+	go a.userService.SyncDevices()
+
+	// catch up online contacts that missed a profile change
+	go a.profileService.PushProfiles()
+
+	// reseal stored messages written in an older envelope format
+	go a.chatService.UpgradeMessages()
+
+	// delete disappearing messages once they expire, including those that expired while closed
+	go a.chatService.ReapMessages()
+
+	// prune history beyond the retention policies
+	go a.retentionService.EnforcePolicies()
 }
 
 func (a *App) shutdown(ctx context.Context) {
+	a.userService.Logout()
 	a.s.Clear()
 }
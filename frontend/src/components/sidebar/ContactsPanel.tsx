@@ -119,6 +119,26 @@ export default function ContactsPanel({ onSelect }: ContactsProps) {
     };
   }, []);
 
+  useEffect(() => {
+    // only messages of conversations that are not muted, outside do-not-disturb, raise a toast
+    const unsubscribeNotify = EventsOn(
+      "msg:notify",
+      (msg: chat.ChatMessage) => {
+        if (msg.peer_id === current?.id) return;
+
+        const contact = contacts.find((c) => c.contact.id === msg.peer_id);
+        toast(
+          "New message from " + (contact?.contact.username ?? msg.peer_id),
+          { icon: <Info /> },
+        );
+      },
+    );
+
+    return () => {
+      unsubscribeNotify();
+    };
+  }, [contacts, current]);
+
   useEffect(() => {
     handleSearch(searchTerm);
   }, [searchTerm, handleSearch]);
@@ -0,0 +1,109 @@
+import { useEffect, useState } from "react";
+import { RespondPairing } from "../../../wailsjs/go/user/UserService";
+import { EventsOn } from "../../../wailsjs/runtime/runtime";
+import type { TPairAttempt } from "@/models";
+import { toast } from "sonner";
+import { Check, Info, X } from "lucide-react";
+import { Button } from "../ui/button";
+import {
+  Dialog,
+  DialogContent,
+  DialogDescription,
+  DialogFooter,
+  DialogHeader,
+  DialogTitle,
+} from "../ui/dialog";
+
+export default function PairAttemptDialog() {
+  const [attempts, setAttempts] = useState<TPairAttempt[]>([]);
+  const attempt = attempts[0];
+
+  const dismiss = (id: string) => {
+    setAttempts((prev) => prev.filter((a) => a.id !== id));
+  };
+
+  const handleRespond = (accept: boolean) => {
+    if (!attempt) return;
+
+    dismiss(attempt.id);
+
+    RespondPairing(attempt.id, accept)
+      .then((res) => {
+        if (res.code !== 200) {
+          toast.error("Pairing request expired", { icon: <Info /> });
+        }
+      })
+      .catch(() => {});
+  };
+
+  useEffect(() => {
+    const unsubscribeAttempt = EventsOn(
+      "pair:attempt",
+      (attempt: TPairAttempt) => {
+        setAttempts((prev) => [...prev, attempt]);
+      },
+    );
+
+    const unsubscribeExpired = EventsOn(
+      "pair:attempt:expired",
+      (attempt: TPairAttempt) => {
+        dismiss(attempt.id);
+        toast("Pairing request from " + attempt.username + " expired", {
+          icon: <Info />,
+        });
+      },
+    );
+
+    return () => {
+      unsubscribeAttempt();
+      unsubscribeExpired();
+    };
+  }, []);
+
+  return (
+    <Dialog
+      open={!!attempt}
+      onOpenChange={(open) => {
+        if (!open) handleRespond(false);
+      }}
+    >
+      <DialogContent>
+        <DialogHeader>
+          <DialogTitle>Pairing request</DialogTitle>
+          <DialogDescription>
+            Accept only if you shared your pairing code with this peer
+          </DialogDescription>
+        </DialogHeader>
+        {attempt && (
+          <div className="grid p-2 border border-neutral-800 rounded-md">
+            <div className="flex justify-between">
+              <span>{attempt.username}</span>
+              <span className="text-sm text-neutral-400">{attempt.ip}</span>
+            </div>
+            <span className="text-xs text-neutral-400">{attempt.peer_id}</span>
+          </div>
+        )}
+        <DialogFooter>
+          <Button
+            variant="outline"
+            className="mr-2"
+            onClick={() => {
+              handleRespond(false);
+            }}
+          >
+            <X />
+            Reject
+          </Button>
+          <Button
+            onClick={() => {
+              handleRespond(true);
+            }}
+          >
+            <Check />
+            Accept
+          </Button>
+        </DialogFooter>
+      </DialogContent>
+    </Dialog>
+  );
+}
@@ -33,6 +33,11 @@ export default function PairDialog() {
       code: code,
     };
 
+    // the peer has to accept the request, which can take up to a minute
+    const waiting = toast.loading(
+      "Waiting for " + currPeer.username + " to accept",
+    );
+
     RequestPairing(req)
       .then((res) => {
         if (res.code === 200) {
@@ -41,7 +46,10 @@ export default function PairDialog() {
           toast.error(res.data, { icon: <Info /> });
         }
       })
-      .catch(() => {});
+      .catch(() => {})
+      .finally(() => {
+        toast.dismiss(waiting);
+      });
   };
 
   const scanPeers = () => {
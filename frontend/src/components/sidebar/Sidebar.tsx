@@ -4,6 +4,7 @@ import ProfilePanel from "./ProfilePanel";
 import ContactsPanel from "./ContactsPanel";
 import PairDialog from "./PairDialog";
 import GenerateCodeDialog from "./GenerateCodeDialog";
+import PairAttemptDialog from "./PairAttemptDialog";
 
 interface SidebarProps {
   user: TProfileSchema;
@@ -19,6 +20,7 @@ export default function Sidebar({ user, onSelect }: SidebarProps) {
           <PairDialog />
           <GenerateCodeDialog />
         </div>
+        <PairAttemptDialog />
         <ContactsPanel onSelect={onSelect} />
       </div>
     </div>
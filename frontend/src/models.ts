@@ -17,8 +17,8 @@ export const RegisterSchema = z
       }),
     password: z
       .string()
-      .min(8, "Password must between 8 to 32 characters")
-      .max(32, "Password must between 8 to 32 characters"),
+      .min(8, "Password must between 8 to 128 characters")
+      .max(128, "Password must between 8 to 128 characters"),
     confirm_password: z.string(),
   })
   .refine((data) => data.password === data.confirm_password, {
@@ -38,8 +38,8 @@ export const LoginSchema = z.object({
     }),
   password: z
     .string()
-    .min(8, "Password must between 8 to 32 characters")
-    .max(32, "Password must between 8 to 32 characters"),
+    .min(8, "Password must between 8 to 128 characters")
+    .max(128, "Password must between 8 to 128 characters"),
 });
 
 export type TLoginSchema = z.infer<typeof LoginSchema>;
@@ -60,6 +60,13 @@ export type TPairRequestModel = {
   type: string;
 };
 
+export type TPairAttempt = {
+  id: string;
+  peer_id: string;
+  username: string;
+  ip: string;
+};
+
 export type ContactList = {
   contact: user.ContactModel;
   unreadMessage: number;
@@ -3,10 +3,14 @@ import MainLayout from "@/components/MainLayout";
 import Sidebar from "@/components/sidebar/Sidebar";
 import { useEffect, useState } from "react";
 import { GetProfile } from "../../wailsjs/go/user/UserService";
+import { ReportActivity } from "../../wailsjs/go/presence/PresenceService";
 import ChatRoom from "@/components/ChatRoom";
 import type { TProfileSchema, TResponseSchema } from "@/models";
 import { useNavigate } from "react-router";
 
+// input is reported at most this often, well below the auto-away and auto-lock timers
+const ACTIVITY_INTERVAL = 10_000;
+
 export default function Chat() {
   const [user, setUser] = useState<TProfileSchema>();
   const [contact, setContact] = useState<user.ContactModel>();
@@ -32,6 +36,25 @@ export default function Chat() {
       .catch(() => {});
   }, []);
 
+  useEffect(() => {
+    // keep the presence from turning away and the session from locking while in use
+    let last = 0;
+    const report = () => {
+      const now = Date.now();
+      if (now - last < ACTIVITY_INTERVAL) return;
+
+      last = now;
+      ReportActivity().catch(() => {});
+    };
+
+    const events = ["keydown", "mousedown", "mousemove", "wheel", "focus"];
+    events.forEach((event) => window.addEventListener(event, report));
+
+    return () => {
+      events.forEach((event) => window.removeEventListener(event, report));
+    };
+  }, []);
+
   return (
     <MainLayout className="flex">
       {user && (
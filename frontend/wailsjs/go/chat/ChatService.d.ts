@@ -1,14 +1,61 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
-import {chat} from '../models';
 import {response} from '../models';
+import {chat} from '../models';
+import {mesh} from '../models';
 import {user} from '../models';
 import {context} from '../models';
 
+export function AddReaction(arg1:string,arg2:string,arg3:string):Promise<response.Response_chat_client_internal_chat_ChatMessage_>;
+
 export function CreateChat(arg1:chat.SendMessageSchema):Promise<void>;
 
+export function DeleteMessage(arg1:string,arg2:string):Promise<response.Response_chat_client_internal_chat_ChatMessage_>;
+
+export function EditMessage(arg1:string,arg2:string,arg3:string):Promise<response.Response_chat_client_internal_chat_ChatMessage_>;
+
+export function GetConversationSettings(arg1:string):Promise<response.Response_chat_client_internal_chat_ConversationSettings_>;
+
+export function GetConversations(arg1:boolean):Promise<response.Response___chat_client_internal_chat_Conversation_>;
+
+export function GetHistory(arg1:string,arg2:chat.HistoryQuery):Promise<response.Response_chat_client_internal_chat_MessagePage_>;
+
 export function GetMessages(arg1:string,arg2:number):Promise<response.Response___chat_client_internal_chat_ChatMessage_>;
 
+export function GetRevisions(arg1:string,arg2:string):Promise<response.Response___chat_client_internal_chat_ChatRevision_>;
+
+export function GetThread(arg1:string,arg2:string):Promise<response.Response___chat_client_internal_chat_ChatMessage_>;
+
+export function MarkAllRead():Promise<response.Response_int64_>;
+
+export function MarkConversationRead(arg1:string):Promise<response.Response_int64_>;
+
+export function MarkRead(arg1:string,arg2:number):Promise<response.Response_int64_>;
+
+export function ReapMessages():Promise<void>;
+
+export function ReceiveEnvelope(arg1:mesh.PacketSchema):Promise<void>;
+
+export function ReceiveSignal(arg1:chat.SignalSchema):Promise<void>;
+
+export function ReceiveSync(arg1:chat.SyncSchema):Promise<void>;
+
+export function RemoveReaction(arg1:string,arg2:string,arg3:string):Promise<response.Response_chat_client_internal_chat_ChatMessage_>;
+
 export function SendMessage(arg1:user.ContactModel,arg2:chat.SendMessageSchema):Promise<response.Response_chat_client_internal_chat_ChatMessage_>;
 
+export function SendSignal(arg1:string,arg2:string):Promise<response.Response_bool_>;
+
+export function SetArchived(arg1:string,arg2:boolean):Promise<response.Response_chat_client_internal_chat_ConversationSettings_>;
+
+export function SetDisappearingTimer(arg1:string,arg2:number):Promise<response.Response_int64_>;
+
+export function SetMuted(arg1:string,arg2:boolean,arg3:string):Promise<response.Response_chat_client_internal_chat_ConversationSettings_>;
+
+export function SetPinOrder(arg1:Array<string>):Promise<response.Response___chat_client_internal_chat_ConversationSettings_>;
+
+export function SetPinned(arg1:string,arg2:boolean):Promise<response.Response_chat_client_internal_chat_ConversationSettings_>;
+
 export function Startup(arg1:context.Context):Promise<void>;
+
+export function UpgradeMessages():Promise<void>;
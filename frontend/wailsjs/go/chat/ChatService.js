@@ -2,18 +2,110 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddReaction(arg1, arg2, arg3) {
+  return window['go']['chat']['ChatService']['AddReaction'](arg1, arg2, arg3);
+}
+
 export function CreateChat(arg1) {
   return window['go']['chat']['ChatService']['CreateChat'](arg1);
 }
 
+export function DeleteMessage(arg1, arg2) {
+  return window['go']['chat']['ChatService']['DeleteMessage'](arg1, arg2);
+}
+
+export function EditMessage(arg1, arg2, arg3) {
+  return window['go']['chat']['ChatService']['EditMessage'](arg1, arg2, arg3);
+}
+
+export function GetConversationSettings(arg1) {
+  return window['go']['chat']['ChatService']['GetConversationSettings'](arg1);
+}
+
+export function GetConversations(arg1) {
+  return window['go']['chat']['ChatService']['GetConversations'](arg1);
+}
+
+export function GetHistory(arg1, arg2) {
+  return window['go']['chat']['ChatService']['GetHistory'](arg1, arg2);
+}
+
 export function GetMessages(arg1, arg2) {
   return window['go']['chat']['ChatService']['GetMessages'](arg1, arg2);
 }
 
+export function GetRevisions(arg1, arg2) {
+  return window['go']['chat']['ChatService']['GetRevisions'](arg1, arg2);
+}
+
+export function GetThread(arg1, arg2) {
+  return window['go']['chat']['ChatService']['GetThread'](arg1, arg2);
+}
+
+export function MarkAllRead() {
+  return window['go']['chat']['ChatService']['MarkAllRead']();
+}
+
+export function MarkConversationRead(arg1) {
+  return window['go']['chat']['ChatService']['MarkConversationRead'](arg1);
+}
+
+export function MarkRead(arg1, arg2) {
+  return window['go']['chat']['ChatService']['MarkRead'](arg1, arg2);
+}
+
+export function ReapMessages() {
+  return window['go']['chat']['ChatService']['ReapMessages']();
+}
+
+export function ReceiveEnvelope(arg1) {
+  return window['go']['chat']['ChatService']['ReceiveEnvelope'](arg1);
+}
+
+export function ReceiveSignal(arg1) {
+  return window['go']['chat']['ChatService']['ReceiveSignal'](arg1);
+}
+
+export function ReceiveSync(arg1) {
+  return window['go']['chat']['ChatService']['ReceiveSync'](arg1);
+}
+
+export function RemoveReaction(arg1, arg2, arg3) {
+  return window['go']['chat']['ChatService']['RemoveReaction'](arg1, arg2, arg3);
+}
+
 export function SendMessage(arg1, arg2) {
   return window['go']['chat']['ChatService']['SendMessage'](arg1, arg2);
 }
 
+export function SendSignal(arg1, arg2) {
+  return window['go']['chat']['ChatService']['SendSignal'](arg1, arg2);
+}
+
+export function SetArchived(arg1, arg2) {
+  return window['go']['chat']['ChatService']['SetArchived'](arg1, arg2);
+}
+
+export function SetDisappearingTimer(arg1, arg2) {
+  return window['go']['chat']['ChatService']['SetDisappearingTimer'](arg1, arg2);
+}
+
+export function SetMuted(arg1, arg2, arg3) {
+  return window['go']['chat']['ChatService']['SetMuted'](arg1, arg2, arg3);
+}
+
+export function SetPinOrder(arg1) {
+  return window['go']['chat']['ChatService']['SetPinOrder'](arg1);
+}
+
+export function SetPinned(arg1, arg2) {
+  return window['go']['chat']['ChatService']['SetPinned'](arg1, arg2);
+}
+
 export function Startup(arg1) {
   return window['go']['chat']['ChatService']['Startup'](arg1);
 }
+
+export function UpgradeMessages() {
+  return window['go']['chat']['ChatService']['UpgradeMessages']();
+}
@@ -1,17 +1,35 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {context} from '../models';
 import {discovery} from '../models';
 import {response} from '../models';
-import {context} from '../models';
 
-export function BroadcastService(arg1:string,arg2:string):Promise<void>;
+export function BroadcastService(arg1:context.Context,arg2:string,arg3:string):Promise<void>;
+
+export function FindPeer(arg1:string):Promise<discovery.PeerModel>;
+
+export function GetDevices(arg1:string):Promise<Array<discovery.PeerModel>>;
 
 export function GetPeer(arg1:string):Promise<discovery.PeerModel>;
 
 export function GetPeers():Promise<response.Response___chat_client_internal_discovery_PeerModel_>;
 
-export function QueryService():Promise<void>;
+export function GetReachable():Promise<Array<discovery.RouteModel>>;
+
+export function GetRoutes(arg1:string):Promise<Array<discovery.RouteModel>>;
+
+export function QueryService(arg1:context.Context):Promise<void>;
 
 export function RefreshQuery():Promise<void>;
 
+export function Reset():Promise<void>;
+
+export function SetPeerPresence(arg1:string,arg2:string):Promise<void>;
+
+export function SetPresence(arg1:string):Promise<void>;
+
+export function SetRoutes(arg1:string,arg2:Array<discovery.RouteModel>):Promise<void>;
+
+export function SignRecords(arg1:discovery.SignFunc,arg2:discovery.VerifyFunc):Promise<void>;
+
 export function Startup(arg1:context.Context):Promise<void>;
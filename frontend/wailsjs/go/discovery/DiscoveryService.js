@@ -2,8 +2,16 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
-export function BroadcastService(arg1, arg2) {
-  return window['go']['discovery']['DiscoveryService']['BroadcastService'](arg1, arg2);
+export function BroadcastService(arg1, arg2, arg3) {
+  return window['go']['discovery']['DiscoveryService']['BroadcastService'](arg1, arg2, arg3);
+}
+
+export function FindPeer(arg1) {
+  return window['go']['discovery']['DiscoveryService']['FindPeer'](arg1);
+}
+
+export function GetDevices(arg1) {
+  return window['go']['discovery']['DiscoveryService']['GetDevices'](arg1);
 }
 
 export function GetPeer(arg1) {
@@ -14,14 +22,42 @@ export function GetPeers() {
   return window['go']['discovery']['DiscoveryService']['GetPeers']();
 }
 
-export function QueryService() {
-  return window['go']['discovery']['DiscoveryService']['QueryService']();
+export function GetReachable() {
+  return window['go']['discovery']['DiscoveryService']['GetReachable']();
+}
+
+export function GetRoutes(arg1) {
+  return window['go']['discovery']['DiscoveryService']['GetRoutes'](arg1);
+}
+
+export function QueryService(arg1) {
+  return window['go']['discovery']['DiscoveryService']['QueryService'](arg1);
 }
 
 export function RefreshQuery() {
   return window['go']['discovery']['DiscoveryService']['RefreshQuery']();
 }
 
+export function Reset() {
+  return window['go']['discovery']['DiscoveryService']['Reset']();
+}
+
+export function SetPeerPresence(arg1, arg2) {
+  return window['go']['discovery']['DiscoveryService']['SetPeerPresence'](arg1, arg2);
+}
+
+export function SetPresence(arg1) {
+  return window['go']['discovery']['DiscoveryService']['SetPresence'](arg1);
+}
+
+export function SetRoutes(arg1, arg2) {
+  return window['go']['discovery']['DiscoveryService']['SetRoutes'](arg1, arg2);
+}
+
+export function SignRecords(arg1, arg2) {
+  return window['go']['discovery']['DiscoveryService']['SignRecords'](arg1, arg2);
+}
+
 export function Startup(arg1) {
   return window['go']['discovery']['DiscoveryService']['Startup'](arg1);
 }
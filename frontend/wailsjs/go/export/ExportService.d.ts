@@ -0,0 +1,9 @@
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+import {export} from '../models';
+import {response} from '../models';
+import {context} from '../models';
+
+export function ExportConversation(arg1:string,arg2:export.ExportOptions):Promise<response.Response_chat_client_internal_export_ExportResult_>;
+
+export function Startup(arg1:context.Context):Promise<void>;
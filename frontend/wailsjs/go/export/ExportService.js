@@ -0,0 +1,11 @@
+// @ts-check
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+
+export function ExportConversation(arg1, arg2) {
+  return window['go']['export']['ExportService']['ExportConversation'](arg1, arg2);
+}
+
+export function Startup(arg1) {
+  return window['go']['export']['ExportService']['Startup'](arg1);
+}
@@ -0,0 +1,15 @@
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+import {response} from '../models';
+import {identity} from '../models';
+import {context} from '../models';
+
+export function GetFingerprints(arg1:string):Promise<response.Response_chat_client_internal_identity_Fingerprints_>;
+
+export function ReceiveRekey(arg1:identity.RekeySchema):Promise<void>;
+
+export function Startup(arg1:context.Context):Promise<void>;
+
+export function Verify(arg1:string,arg2:string,arg3:Array<number>,arg4:string):Promise<void>;
+
+export function WatchIdentities():Promise<void>;
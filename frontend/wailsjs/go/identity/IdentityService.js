@@ -0,0 +1,23 @@
+// @ts-check
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+
+export function GetFingerprints(arg1) {
+  return window['go']['identity']['IdentityService']['GetFingerprints'](arg1);
+}
+
+export function ReceiveRekey(arg1) {
+  return window['go']['identity']['IdentityService']['ReceiveRekey'](arg1);
+}
+
+export function Startup(arg1) {
+  return window['go']['identity']['IdentityService']['Startup'](arg1);
+}
+
+export function Verify(arg1, arg2, arg3, arg4) {
+  return window['go']['identity']['IdentityService']['Verify'](arg1, arg2, arg3, arg4);
+}
+
+export function WatchIdentities() {
+  return window['go']['identity']['IdentityService']['WatchIdentities']();
+}
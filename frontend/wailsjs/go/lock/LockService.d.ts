@@ -0,0 +1,16 @@
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+import {response} from '../models';
+import {context} from '../models';
+
+export function GetLockStatus():Promise<response.Response_chat_client_internal_lock_LockStatus_>;
+
+export function Lock():Promise<response.Response_chat_client_internal_lock_LockStatus_>;
+
+export function SetAutoLock(arg1:number):Promise<response.Response_chat_client_internal_lock_LockStatus_>;
+
+export function Startup(arg1:context.Context):Promise<void>;
+
+export function Unlock(arg1:string):Promise<response.Response_chat_client_internal_lock_LockStatus_>;
+
+export function WatchLock():Promise<void>;
@@ -0,0 +1,27 @@
+// @ts-check
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+
+export function GetLockStatus() {
+  return window['go']['lock']['LockService']['GetLockStatus']();
+}
+
+export function Lock() {
+  return window['go']['lock']['LockService']['Lock']();
+}
+
+export function SetAutoLock(arg1) {
+  return window['go']['lock']['LockService']['SetAutoLock'](arg1);
+}
+
+export function Startup(arg1) {
+  return window['go']['lock']['LockService']['Startup'](arg1);
+}
+
+export function Unlock(arg1) {
+  return window['go']['lock']['LockService']['Unlock'](arg1);
+}
+
+export function WatchLock() {
+  return window['go']['lock']['LockService']['WatchLock']();
+}
@@ -0,0 +1,19 @@
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+import {response} from '../models';
+import {mesh} from '../models';
+import {context} from '../models';
+
+export function GetMeshMode():Promise<response.Response_bool_>;
+
+export function GossipRoutes():Promise<void>;
+
+export function Receive(arg1:mesh.PacketSchema):Promise<mesh.EnvelopeSchema>;
+
+export function ReceiveRoutes(arg1:mesh.PacketSchema):Promise<void>;
+
+export function Send(arg1:string,arg2:any):Promise<void>;
+
+export function SetMeshMode(arg1:boolean):Promise<response.Response_bool_>;
+
+export function Startup(arg1:context.Context):Promise<void>;
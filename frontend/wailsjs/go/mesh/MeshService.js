@@ -0,0 +1,31 @@
+// @ts-check
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+
+export function GetMeshMode() {
+  return window['go']['mesh']['MeshService']['GetMeshMode']();
+}
+
+export function GossipRoutes() {
+  return window['go']['mesh']['MeshService']['GossipRoutes']();
+}
+
+export function Receive(arg1) {
+  return window['go']['mesh']['MeshService']['Receive'](arg1);
+}
+
+export function ReceiveRoutes(arg1) {
+  return window['go']['mesh']['MeshService']['ReceiveRoutes'](arg1);
+}
+
+export function Send(arg1, arg2) {
+  return window['go']['mesh']['MeshService']['Send'](arg1, arg2);
+}
+
+export function SetMeshMode(arg1) {
+  return window['go']['mesh']['MeshService']['SetMeshMode'](arg1);
+}
+
+export function Startup(arg1) {
+  return window['go']['mesh']['MeshService']['Startup'](arg1);
+}
@@ -1,77 +1,1091 @@
 export namespace chat {
 	
+	export class ReactionSummary {
+	    emoji: string;
+	    count: number;
+	    senders: string[];
+	    mine: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ReactionSummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.emoji = source["emoji"];
+	        this.count = source["count"];
+	        this.senders = source["senders"];
+	        this.mine = source["mine"];
+	    }
+	}
+	export class QuotedMessage {
+	    message_id: string;
+	    sender: string;
+	    preview: string;
+	    deleted: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new QuotedMessage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.message_id = source["message_id"];
+	        this.sender = source["sender"];
+	        this.preview = source["preview"];
+	        this.deleted = source["deleted"];
+	    }
+	}
 	export class ChatMessage {
 	    id: number;
+	    message_id: string;
 	    sender: string;
 	    peer_id: string;
+	    message: string;
+	    reply_to?: QuotedMessage;
+	    reactions?: ReactionSummary[];
+	    edited: boolean;
+	    deleted: boolean;
+	    expires_at?: string;
+	    created_at: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ChatMessage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.message_id = source["message_id"];
+	        this.sender = source["sender"];
+	        this.peer_id = source["peer_id"];
+	        this.message = source["message"];
+	        this.reply_to = this.convertValues(source["reply_to"], QuotedMessage);
+	        this.reactions = this.convertValues(source["reactions"], ReactionSummary);
+	        this.edited = source["edited"];
+	        this.deleted = source["deleted"];
+	        this.expires_at = source["expires_at"];
+	        this.created_at = source["created_at"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ChatRevision {
 	    message: string;
 	    created_at: string;
 	
 	    static createFrom(source: any = {}) {
-	        return new ChatMessage(source);
+	        return new ChatRevision(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.message = source["message"];
+	        this.created_at = source["created_at"];
+	    }
+	}
+	export class ConversationSettings {
+	    peer_id: string;
+	    muted: boolean;
+	    muted_until?: string;
+	    pin_order: number;
+	    archived: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ConversationSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peer_id = source["peer_id"];
+	        this.muted = source["muted"];
+	        this.muted_until = source["muted_until"];
+	        this.pin_order = source["pin_order"];
+	        this.archived = source["archived"];
+	    }
+	}
+	export class Conversation {
+	    peer_id: string;
+	    username: string;
+	    last_message?: ChatMessage;
+	    last_activity?: string;
+	    unread: number;
+	    settings: ConversationSettings;
+	
+	    static createFrom(source: any = {}) {
+	        return new Conversation(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peer_id = source["peer_id"];
+	        this.username = source["username"];
+	        this.last_message = this.convertValues(source["last_message"], ChatMessage);
+	        this.last_activity = source["last_activity"];
+	        this.unread = source["unread"];
+	        this.settings = this.convertValues(source["settings"], ConversationSettings);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class HistoryQuery {
+	    before?: number;
+	    after?: number;
+	    around?: string;
+	    date?: string;
+	    limit?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HistoryQuery(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.before = source["before"];
+	        this.after = source["after"];
+	        this.around = source["around"];
+	        this.date = source["date"];
+	        this.limit = source["limit"];
+	    }
+	}
+	export class MessagePage {
+	    messages: ChatMessage[];
+	    prev: number;
+	    next: number;
+	    total: number;
+	    unread: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new MessagePage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.messages = this.convertValues(source["messages"], ChatMessage);
+	        this.prev = source["prev"];
+	        this.next = source["next"];
+	        this.total = source["total"];
+	        this.unread = source["unread"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	
+	export class SendMessageSchema {
+	    id?: string;
+	    sender: string;
+	    type?: string;
+	    ref?: string;
+	    reply_to?: string;
+	    message: string;
+	    expires_in?: number;
+	    signature?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SendMessageSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.sender = source["sender"];
+	        this.type = source["type"];
+	        this.ref = source["ref"];
+	        this.reply_to = source["reply_to"];
+	        this.message = source["message"];
+	        this.expires_in = source["expires_in"];
+	        this.signature = source["signature"];
+	    }
+	}
+	export class SignalSchema {
+	    sender: string;
+	    payload: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SignalSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.sender = source["sender"];
+	        this.payload = source["payload"];
+	    }
+	}
+	export class SyncSchema {
+	    sender: string;
+	    payload: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.sender = source["sender"];
+	        this.payload = source["payload"];
+	    }
+	}
+
+}
+
+export namespace discovery {
+	
+	export class PeerModel {
+	    id: string;
+	    username: string;
+	    ip: string;
+	    presence: string;
+	    device?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new PeerModel(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.username = source["username"];
+	        this.ip = source["ip"];
+	        this.presence = source["presence"];
+	        this.device = source["device"];
+	    }
+	}
+	export class RouteModel {
+	    id: string;
+	    via?: string;
+	    hops: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new RouteModel(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.via = source["via"];
+	        this.hops = source["hops"];
+	    }
+	}
+
+}
+
+export namespace export {
+	
+	export class ExportOptions {
+	    format: string;
+	    from?: string;
+	    to?: string;
+	    zip: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ExportOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.format = source["format"];
+	        this.from = source["from"];
+	        this.to = source["to"];
+	        this.zip = source["zip"];
+	    }
+	}
+	export class ExportResult {
+	    path: string;
+	    messages: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ExportResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.messages = source["messages"];
+	    }
+	}
+
+}
+
+export namespace identity {
+	
+	export class Fingerprints {
+	    own: string;
+	    peer: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Fingerprints(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.own = source["own"];
+	        this.peer = source["peer"];
+	    }
+	}
+	export class RekeySchema {
+	    sender: string;
+	    payload: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RekeySchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.sender = source["sender"];
+	        this.payload = source["payload"];
+	    }
+	}
+
+}
+
+export namespace lock {
+	
+	export class LockStatus {
+	    locked: boolean;
+	    auto_lock_minutes: number;
+	    queued: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new LockStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.locked = source["locked"];
+	        this.auto_lock_minutes = source["auto_lock_minutes"];
+	        this.queued = source["queued"];
+	    }
+	}
+
+}
+
+export namespace mesh {
+	
+	export class EnvelopeSchema {
+	    id: string;
+	    origin: string;
+	    recipient: string;
+	    hops: number;
+	    data: number[];
+	
+	    static createFrom(source: any = {}) {
+	        return new EnvelopeSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.origin = source["origin"];
+	        this.recipient = source["recipient"];
+	        this.hops = source["hops"];
+	        this.data = source["data"];
+	    }
+	}
+	export class PacketSchema {
+	    sender: string;
+	    payload: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new PacketSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.sender = source["sender"];
+	        this.payload = source["payload"];
+	    }
+	}
+
+}
+
+export namespace presence {
+	
+	export class PresenceSchema {
+	    sender: string;
+	    payload: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new PresenceSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.sender = source["sender"];
+	        this.payload = source["payload"];
+	    }
+	}
+	export class PresenceSettings {
+	    presence: string;
+	    chosen: string;
+	    away: boolean;
+	    auto_away_minutes: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new PresenceSettings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.presence = source["presence"];
+	        this.chosen = source["chosen"];
+	        this.away = source["away"];
+	        this.auto_away_minutes = source["auto_away_minutes"];
+	    }
+	}
+
+}
+
+export namespace profile {
+	
+	export class ProfileSchema {
+	    sender: string;
+	    payload: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ProfileSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.sender = source["sender"];
+	        this.payload = source["payload"];
+	    }
+	}
+	export class UpdateProfileSchema {
+	    display_name: string;
+	    status_text: string;
+	    avatar?: string;
+	    remove_avatar: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new UpdateProfileSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.display_name = source["display_name"];
+	        this.status_text = source["status_text"];
+	        this.avatar = source["avatar"];
+	        this.remove_avatar = source["remove_avatar"];
+	    }
+	}
+
+}
+
+export namespace protocol {
+	
+	export class InfoSchema {
+	    protocol: number;
+	    min_protocol?: number;
+	    app_version: string;
+	    features: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new InfoSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.protocol = source["protocol"];
+	        this.min_protocol = source["min_protocol"];
+	        this.app_version = source["app_version"];
+	        this.features = source["features"];
+	    }
+	}
+
+}
+
+export namespace response {
+	
+	export class Response___chat_client_internal_chat_ChatMessage_ {
+	    code: number;
+	    data: chat.ChatMessage[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Response___chat_client_internal_chat_ChatMessage_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], chat.ChatMessage);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response___chat_client_internal_chat_ChatRevision_ {
+	    code: number;
+	    data: chat.ChatRevision[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Response___chat_client_internal_chat_ChatRevision_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], chat.ChatRevision);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response___chat_client_internal_chat_ConversationSettings_ {
+	    code: number;
+	    data: chat.ConversationSettings[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Response___chat_client_internal_chat_ConversationSettings_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], chat.ConversationSettings);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response___chat_client_internal_chat_Conversation_ {
+	    code: number;
+	    data: chat.Conversation[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Response___chat_client_internal_chat_Conversation_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], chat.Conversation);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response___chat_client_internal_discovery_PeerModel_ {
+	    code: number;
+	    data: discovery.PeerModel[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Response___chat_client_internal_discovery_PeerModel_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], discovery.PeerModel);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response___chat_client_internal_retention_RetentionPolicyModel_ {
+	    code: number;
+	    data: retention.RetentionPolicyModel[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Response___chat_client_internal_retention_RetentionPolicyModel_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], retention.RetentionPolicyModel);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response___chat_client_internal_user_ContactModel_ {
+	    code: number;
+	    data: user.ContactModel[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Response___chat_client_internal_user_ContactModel_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], user.ContactModel);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response___chat_client_internal_user_DeviceInfo_ {
+	    code: number;
+	    data: user.DeviceInfo[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Response___chat_client_internal_user_DeviceInfo_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], user.DeviceInfo);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response_bool_ {
+	    code: number;
+	    data: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new Response_bool_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = source["data"];
+	    }
+	}
+	export class Response_chat_client_internal_chat_ChatMessage_ {
+	    code: number;
+	    data: chat.ChatMessage;
+	
+	    static createFrom(source: any = {}) {
+	        return new Response_chat_client_internal_chat_ChatMessage_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], chat.ChatMessage);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response_chat_client_internal_chat_ConversationSettings_ {
+	    code: number;
+	    data: chat.ConversationSettings;
+	
+	    static createFrom(source: any = {}) {
+	        return new Response_chat_client_internal_chat_ConversationSettings_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], chat.ConversationSettings);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response_chat_client_internal_chat_MessagePage_ {
+	    code: number;
+	    data: chat.MessagePage;
+	
+	    static createFrom(source: any = {}) {
+	        return new Response_chat_client_internal_chat_MessagePage_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], chat.MessagePage);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response_chat_client_internal_export_ExportResult_ {
+	    code: number;
+	    data: export.ExportResult;
+	
+	    static createFrom(source: any = {}) {
+	        return new Response_chat_client_internal_export_ExportResult_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], export.ExportResult);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response_chat_client_internal_identity_Fingerprints_ {
+	    code: number;
+	    data: identity.Fingerprints;
+	
+	    static createFrom(source: any = {}) {
+	        return new Response_chat_client_internal_identity_Fingerprints_(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
-	        this.id = source["id"];
-	        this.sender = source["sender"];
-	        this.peer_id = source["peer_id"];
-	        this.message = source["message"];
-	        this.created_at = source["created_at"];
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], identity.Fingerprints);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
-	export class SendMessageSchema {
-	    sender: string;
-	    message: string;
+	export class Response_chat_client_internal_lock_LockStatus_ {
+	    code: number;
+	    data: lock.LockStatus;
 	
 	    static createFrom(source: any = {}) {
-	        return new SendMessageSchema(source);
+	        return new Response_chat_client_internal_lock_LockStatus_(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
-	        this.sender = source["sender"];
-	        this.message = source["message"];
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], lock.LockStatus);
 	    }
-	}
-
-}
-
-export namespace discovery {
 	
-	export class PeerModel {
-	    id: string;
-	    username: string;
-	    ip: string;
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response_chat_client_internal_presence_PresenceSettings_ {
+	    code: number;
+	    data: presence.PresenceSettings;
 	
 	    static createFrom(source: any = {}) {
-	        return new PeerModel(source);
+	        return new Response_chat_client_internal_presence_PresenceSettings_(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
-	        this.id = source["id"];
-	        this.username = source["username"];
-	        this.ip = source["ip"];
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], presence.PresenceSettings);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
-
-}
-
-export namespace response {
+	export class Response_chat_client_internal_protocol_InfoSchema_ {
+	    code: number;
+	    data: protocol.InfoSchema;
 	
-	export class Response___chat_client_internal_chat_ChatMessage_ {
+	    static createFrom(source: any = {}) {
+	        return new Response_chat_client_internal_protocol_InfoSchema_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = this.convertValues(source["data"], protocol.InfoSchema);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class Response_chat_client_internal_retention_RetentionPolicyModel_ {
 	    code: number;
-	    data: chat.ChatMessage[];
+	    data: retention.RetentionPolicyModel;
 	
 	    static createFrom(source: any = {}) {
-	        return new Response___chat_client_internal_chat_ChatMessage_(source);
+	        return new Response_chat_client_internal_retention_RetentionPolicyModel_(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.code = source["code"];
-	        this.data = this.convertValues(source["data"], chat.ChatMessage);
+	        this.data = this.convertValues(source["data"], retention.RetentionPolicyModel);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -92,18 +1106,18 @@ export namespace response {
 		    return a;
 		}
 	}
-	export class Response___chat_client_internal_discovery_PeerModel_ {
+	export class Response_chat_client_internal_retention_RetentionReport_ {
 	    code: number;
-	    data: discovery.PeerModel[];
+	    data: retention.RetentionReport;
 	
 	    static createFrom(source: any = {}) {
-	        return new Response___chat_client_internal_discovery_PeerModel_(source);
+	        return new Response_chat_client_internal_retention_RetentionReport_(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.code = source["code"];
-	        this.data = this.convertValues(source["data"], discovery.PeerModel);
+	        this.data = this.convertValues(source["data"], retention.RetentionReport);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -124,18 +1138,18 @@ export namespace response {
 		    return a;
 		}
 	}
-	export class Response___chat_client_internal_user_ContactModel_ {
+	export class Response_chat_client_internal_rotation_RotationStatus_ {
 	    code: number;
-	    data: user.ContactModel[];
+	    data: rotation.RotationStatus;
 	
 	    static createFrom(source: any = {}) {
-	        return new Response___chat_client_internal_user_ContactModel_(source);
+	        return new Response_chat_client_internal_rotation_RotationStatus_(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.code = source["code"];
-	        this.data = this.convertValues(source["data"], user.ContactModel);
+	        this.data = this.convertValues(source["data"], rotation.RotationStatus);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -156,18 +1170,18 @@ export namespace response {
 		    return a;
 		}
 	}
-	export class Response_chat_client_internal_chat_ChatMessage_ {
+	export class Response_chat_client_internal_user_ContactModel_ {
 	    code: number;
-	    data: chat.ChatMessage;
+	    data: user.ContactModel;
 	
 	    static createFrom(source: any = {}) {
-	        return new Response_chat_client_internal_chat_ChatMessage_(source);
+	        return new Response_chat_client_internal_user_ContactModel_(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.code = source["code"];
-	        this.data = this.convertValues(source["data"], chat.ChatMessage);
+	        this.data = this.convertValues(source["data"], user.ContactModel);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -220,6 +1234,20 @@ export namespace response {
 		    return a;
 		}
 	}
+	export class Response_int64_ {
+	    code: number;
+	    data: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Response_int64_(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.code = source["code"];
+	        this.data = source["data"];
+	    }
+	}
 	export class Response_string_ {
 	    code: number;
 	    data: string;
@@ -237,12 +1265,130 @@ export namespace response {
 
 }
 
+export namespace retention {
+	
+	export class RetentionPolicyModel {
+	    peer_id: string;
+	    max_age_days?: number;
+	    max_messages?: number;
+	    quota_mb?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new RetentionPolicyModel(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peer_id = source["peer_id"];
+	        this.max_age_days = source["max_age_days"];
+	        this.max_messages = source["max_messages"];
+	        this.quota_mb = source["quota_mb"];
+	    }
+	}
+	export class RetentionReport {
+	    expired: number;
+	    trimmed: number;
+	    over_quota: number;
+	    freed_bytes: number;
+	    ran_at: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RetentionReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.expired = source["expired"];
+	        this.trimmed = source["trimmed"];
+	        this.over_quota = source["over_quota"];
+	        this.freed_bytes = source["freed_bytes"];
+	        this.ran_at = source["ran_at"];
+	    }
+	}
+
+}
+
+export namespace rotation {
+	
+	export class RotateSchema {
+	    sender: string;
+	    payload: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RotateSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.sender = source["sender"];
+	        this.payload = source["payload"];
+	    }
+	}
+	export class RotationStatus {
+	    peer_id: string;
+	    key_id: string;
+	    rotated_at: string;
+	    messages: number;
+	    retired: number;
+	    pending: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new RotationStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peer_id = source["peer_id"];
+	        this.key_id = source["key_id"];
+	        this.rotated_at = source["rotated_at"];
+	        this.messages = source["messages"];
+	        this.retired = source["retired"];
+	        this.pending = source["pending"];
+	    }
+	}
+
+}
+
 export namespace user {
 	
+	export class ContactMetaSchema {
+	    nickname: string;
+	    note: string;
+	    color: string;
+	    tag: string;
+	    trusted: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ContactMetaSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.nickname = source["nickname"];
+	        this.note = source["note"];
+	        this.color = source["color"];
+	        this.tag = source["tag"];
+	        this.trusted = source["trusted"];
+	    }
+	}
 	export class ContactModel {
 	    id: string;
 	    username: string;
 	    SharedKey: number[];
+	    SignKey: number[];
+	    key_id: string;
+	    // Go type: time
+	    key_rotated_at?: any;
+	    disappear_after: number;
+	    display_name: string;
+	    status_text: string;
+	    avatar: string;
+	    profile_version: number;
+	    nickname: string;
+	    note: string;
+	    color: string;
+	    tag: string;
+	    trusted: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new ContactModel(source);
@@ -253,6 +1399,73 @@ export namespace user {
 	        this.id = source["id"];
 	        this.username = source["username"];
 	        this.SharedKey = source["SharedKey"];
+	        this.SignKey = source["SignKey"];
+	        this.key_id = source["key_id"];
+	        this.key_rotated_at = this.convertValues(source["key_rotated_at"], null);
+	        this.disappear_after = source["disappear_after"];
+	        this.display_name = source["display_name"];
+	        this.status_text = source["status_text"];
+	        this.avatar = source["avatar"];
+	        this.profile_version = source["profile_version"];
+	        this.nickname = source["nickname"];
+	        this.note = source["note"];
+	        this.color = source["color"];
+	        this.tag = source["tag"];
+	        this.trusted = source["trusted"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ContactSyncSchema {
+	    sender: string;
+	    payload: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ContactSyncSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.sender = source["sender"];
+	        this.payload = source["payload"];
+	    }
+	}
+	export class DeviceInfo {
+	    id: string;
+	    name: string;
+	    fingerprint: string;
+	    current: boolean;
+	    online: boolean;
+	    linked_at?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DeviceInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.fingerprint = source["fingerprint"];
+	        this.current = source["current"];
+	        this.online = source["online"];
+	        this.linked_at = source["linked_at"];
 	    }
 	}
 	export class InitPairSchema {
@@ -260,6 +1473,7 @@ export namespace user {
 	    username: string;
 	    code: string;
 	    pubkey: string;
+	    sign_key?: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new InitPairSchema(source);
@@ -271,6 +1485,45 @@ export namespace user {
 	        this.username = source["username"];
 	        this.code = source["code"];
 	        this.pubkey = source["pubkey"];
+	        this.sign_key = source["sign_key"];
+	    }
+	}
+	export class LinkRequestSchema {
+	    device: string;
+	    name: string;
+	    pubkey: string;
+	    mac: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new LinkRequestSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.device = source["device"];
+	        this.name = source["name"];
+	        this.pubkey = source["pubkey"];
+	        this.mac = source["mac"];
+	    }
+	}
+	export class LinkResponseSchema {
+	    device: string;
+	    name: string;
+	    pubkey: string;
+	    bundle: string;
+	    mac: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new LinkResponseSchema(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.device = source["device"];
+	        this.name = source["name"];
+	        this.pubkey = source["pubkey"];
+	        this.bundle = source["bundle"];
+	        this.mac = source["mac"];
 	    }
 	}
 	export class RequestPairSchema {
@@ -291,6 +1544,7 @@ export namespace user {
 	}
 	export class ResponsePairSchema {
 	    pubkey: string;
+	    sign_key?: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new ResponsePairSchema(source);
@@ -299,11 +1553,16 @@ export namespace user {
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.pubkey = source["pubkey"];
+	        this.sign_key = source["sign_key"];
 	    }
 	}
 	export class UserProfile {
 	    id: string;
 	    username: string;
+	    display_name: string;
+	    status_text: string;
+	    avatar: string;
+	    profile_version: number;
 	
 	    static createFrom(source: any = {}) {
 	        return new UserProfile(source);
@@ -313,6 +1572,10 @@ export namespace user {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.id = source["id"];
 	        this.username = source["username"];
+	        this.display_name = source["display_name"];
+	        this.status_text = source["status_text"];
+	        this.avatar = source["avatar"];
+	        this.profile_version = source["profile_version"];
 	    }
 	}
 
@@ -0,0 +1,22 @@
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+import {response} from '../models';
+import {time} from '../models';
+import {presence} from '../models';
+import {context} from '../models';
+
+export function GetPresence():Promise<response.Response_chat_client_internal_presence_PresenceSettings_>;
+
+export function Idle():Promise<time.Duration>;
+
+export function ReceivePresence(arg1:presence.PresenceSchema):Promise<void>;
+
+export function ReportActivity():Promise<void>;
+
+export function SetAutoAway(arg1:number):Promise<response.Response_chat_client_internal_presence_PresenceSettings_>;
+
+export function SetPresence(arg1:string):Promise<response.Response_chat_client_internal_presence_PresenceSettings_>;
+
+export function Startup(arg1:context.Context):Promise<void>;
+
+export function WatchPresence():Promise<void>;
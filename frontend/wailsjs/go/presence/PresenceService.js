@@ -0,0 +1,35 @@
+// @ts-check
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+
+export function GetPresence() {
+  return window['go']['presence']['PresenceService']['GetPresence']();
+}
+
+export function Idle() {
+  return window['go']['presence']['PresenceService']['Idle']();
+}
+
+export function ReceivePresence(arg1) {
+  return window['go']['presence']['PresenceService']['ReceivePresence'](arg1);
+}
+
+export function ReportActivity() {
+  return window['go']['presence']['PresenceService']['ReportActivity']();
+}
+
+export function SetAutoAway(arg1) {
+  return window['go']['presence']['PresenceService']['SetAutoAway'](arg1);
+}
+
+export function SetPresence(arg1) {
+  return window['go']['presence']['PresenceService']['SetPresence'](arg1);
+}
+
+export function Startup(arg1) {
+  return window['go']['presence']['PresenceService']['Startup'](arg1);
+}
+
+export function WatchPresence() {
+  return window['go']['presence']['PresenceService']['WatchPresence']();
+}
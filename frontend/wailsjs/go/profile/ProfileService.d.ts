@@ -0,0 +1,13 @@
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+import {profile} from '../models';
+import {context} from '../models';
+import {response} from '../models';
+
+export function PushProfiles():Promise<void>;
+
+export function ReceiveProfile(arg1:profile.ProfileSchema):Promise<void>;
+
+export function Startup(arg1:context.Context):Promise<void>;
+
+export function UpdateProfile(arg1:profile.UpdateProfileSchema):Promise<response.Response_chat_client_internal_user_UserProfile_>;
@@ -0,0 +1,19 @@
+// @ts-check
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+
+export function PushProfiles() {
+  return window['go']['profile']['ProfileService']['PushProfiles']();
+}
+
+export function ReceiveProfile(arg1) {
+  return window['go']['profile']['ProfileService']['ReceiveProfile'](arg1);
+}
+
+export function Startup(arg1) {
+  return window['go']['profile']['ProfileService']['Startup'](arg1);
+}
+
+export function UpdateProfile(arg1) {
+  return window['go']['profile']['ProfileService']['UpdateProfile'](arg1);
+}
@@ -0,0 +1,17 @@
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+import {protocol} from '../models';
+import {response} from '../models';
+import {context} from '../models';
+
+export function GetInfo():Promise<protocol.InfoSchema>;
+
+export function GetPeerInfo(arg1:string):Promise<response.Response_chat_client_internal_protocol_InfoSchema_>;
+
+export function Require(arg1:string,arg2:string):Promise<void>;
+
+export function RequireCompatible(arg1:string):Promise<void>;
+
+export function Startup(arg1:context.Context):Promise<void>;
+
+export function Supports(arg1:string,arg2:string):Promise<boolean>;
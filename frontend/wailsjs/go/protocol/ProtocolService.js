@@ -0,0 +1,27 @@
+// @ts-check
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+
+export function GetInfo() {
+  return window['go']['protocol']['ProtocolService']['GetInfo']();
+}
+
+export function GetPeerInfo(arg1) {
+  return window['go']['protocol']['ProtocolService']['GetPeerInfo'](arg1);
+}
+
+export function Require(arg1, arg2) {
+  return window['go']['protocol']['ProtocolService']['Require'](arg1, arg2);
+}
+
+export function RequireCompatible(arg1) {
+  return window['go']['protocol']['ProtocolService']['RequireCompatible'](arg1);
+}
+
+export function Startup(arg1) {
+  return window['go']['protocol']['ProtocolService']['Startup'](arg1);
+}
+
+export function Supports(arg1, arg2) {
+  return window['go']['protocol']['ProtocolService']['Supports'](arg1, arg2);
+}
@@ -0,0 +1,17 @@
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+import {response} from '../models';
+import {retention} from '../models';
+import {context} from '../models';
+
+export function DeleteRetentionPolicy(arg1:string):Promise<response.Response_bool_>;
+
+export function EnforcePolicies():Promise<void>;
+
+export function GetRetentionPolicies():Promise<response.Response___chat_client_internal_retention_RetentionPolicyModel_>;
+
+export function RunRetention():Promise<response.Response_chat_client_internal_retention_RetentionReport_>;
+
+export function SetRetentionPolicy(arg1:retention.RetentionPolicyModel):Promise<response.Response_chat_client_internal_retention_RetentionPolicyModel_>;
+
+export function Startup(arg1:context.Context):Promise<void>;
@@ -0,0 +1,27 @@
+// @ts-check
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+
+export function DeleteRetentionPolicy(arg1) {
+  return window['go']['retention']['RetentionService']['DeleteRetentionPolicy'](arg1);
+}
+
+export function EnforcePolicies() {
+  return window['go']['retention']['RetentionService']['EnforcePolicies']();
+}
+
+export function GetRetentionPolicies() {
+  return window['go']['retention']['RetentionService']['GetRetentionPolicies']();
+}
+
+export function RunRetention() {
+  return window['go']['retention']['RetentionService']['RunRetention']();
+}
+
+export function SetRetentionPolicy(arg1) {
+  return window['go']['retention']['RetentionService']['SetRetentionPolicy'](arg1);
+}
+
+export function Startup(arg1) {
+  return window['go']['retention']['RetentionService']['Startup'](arg1);
+}
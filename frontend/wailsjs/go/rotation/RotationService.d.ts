@@ -0,0 +1,15 @@
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+import {response} from '../models';
+import {rotation} from '../models';
+import {context} from '../models';
+
+export function GetRotation(arg1:string):Promise<response.Response_chat_client_internal_rotation_RotationStatus_>;
+
+export function ReceiveRotate(arg1:rotation.RotateSchema):Promise<void>;
+
+export function RotateKey(arg1:string):Promise<response.Response_chat_client_internal_rotation_RotationStatus_>;
+
+export function Startup(arg1:context.Context):Promise<void>;
+
+export function WatchRotation():Promise<void>;
@@ -0,0 +1,23 @@
+// @ts-check
+// Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
+// This file is automatically generated. DO NOT EDIT
+
+export function GetRotation(arg1) {
+  return window['go']['rotation']['RotationService']['GetRotation'](arg1);
+}
+
+export function ReceiveRotate(arg1) {
+  return window['go']['rotation']['RotationService']['ReceiveRotate'](arg1);
+}
+
+export function RotateKey(arg1) {
+  return window['go']['rotation']['RotationService']['RotateKey'](arg1);
+}
+
+export function Startup(arg1) {
+  return window['go']['rotation']['RotationService']['Startup'](arg1);
+}
+
+export function WatchRotation() {
+  return window['go']['rotation']['RotationService']['WatchRotation']();
+}
@@ -4,20 +4,40 @@ import {response} from '../models';
 import {user} from '../models';
 import {context} from '../models';
 
+export function GenerateLinkCode():Promise<response.Response_string_>;
+
 export function GeneratePairingCode():Promise<response.Response_string_>;
 
 export function GetContacts():Promise<response.Response___chat_client_internal_user_ContactModel_>;
 
+export function GetDevices():Promise<response.Response___chat_client_internal_user_DeviceInfo_>;
+
 export function GetProfile():Promise<response.Response_chat_client_internal_user_UserProfile_>;
 
-export function HandleUserPairing(arg1:user.InitPairSchema):Promise<user.ResponsePairSchema>;
+export function HandleDeviceLink(arg1:user.LinkRequestSchema):Promise<user.LinkResponseSchema>;
+
+export function HandleUserPairing(arg1:user.InitPairSchema,arg2:string):Promise<user.ResponsePairSchema>;
+
+export function LinkDevice(arg1:string,arg2:string):Promise<response.Response_chat_client_internal_user_UserProfile_>;
 
 export function Login(arg1:string,arg2:string):Promise<response.Response_chat_client_internal_user_UserProfile_>;
 
+export function Logout():Promise<response.Response_bool_>;
+
+export function ReceiveContact(arg1:user.ContactSyncSchema):Promise<void>;
+
 export function Register(arg1:string,arg2:string):Promise<response.Response_chat_client_internal_user_UserProfile_>;
 
 export function RequestPairing(arg1:user.RequestPairSchema):Promise<response.Response_string_>;
 
+export function RespondPairing(arg1:string,arg2:boolean):Promise<response.Response_bool_>;
+
 export function ScanPeers():Promise<response.Response___chat_client_internal_discovery_PeerModel_>;
 
 export function Startup(arg1:context.Context):Promise<void>;
+
+export function SyncContact(arg1:string):Promise<response.Response_bool_>;
+
+export function SyncDevices():Promise<void>;
+
+export function UpdateContact(arg1:string,arg2:user.ContactMetaSchema):Promise<response.Response_chat_client_internal_user_ContactModel_>;
@@ -2,6 +2,10 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function GenerateLinkCode() {
+  return window['go']['user']['UserService']['GenerateLinkCode']();
+}
+
 export function GeneratePairingCode() {
   return window['go']['user']['UserService']['GeneratePairingCode']();
 }
@@ -10,18 +14,38 @@ export function GetContacts() {
   return window['go']['user']['UserService']['GetContacts']();
 }
 
+export function GetDevices() {
+  return window['go']['user']['UserService']['GetDevices']();
+}
+
 export function GetProfile() {
   return window['go']['user']['UserService']['GetProfile']();
 }
 
-export function HandleUserPairing(arg1) {
-  return window['go']['user']['UserService']['HandleUserPairing'](arg1);
+export function HandleDeviceLink(arg1) {
+  return window['go']['user']['UserService']['HandleDeviceLink'](arg1);
+}
+
+export function HandleUserPairing(arg1, arg2) {
+  return window['go']['user']['UserService']['HandleUserPairing'](arg1, arg2);
+}
+
+export function LinkDevice(arg1, arg2) {
+  return window['go']['user']['UserService']['LinkDevice'](arg1, arg2);
 }
 
 export function Login(arg1, arg2) {
   return window['go']['user']['UserService']['Login'](arg1, arg2);
 }
 
+export function Logout() {
+  return window['go']['user']['UserService']['Logout']();
+}
+
+export function ReceiveContact(arg1) {
+  return window['go']['user']['UserService']['ReceiveContact'](arg1);
+}
+
 export function Register(arg1, arg2) {
   return window['go']['user']['UserService']['Register'](arg1, arg2);
 }
@@ -30,6 +54,10 @@ export function RequestPairing(arg1) {
   return window['go']['user']['UserService']['RequestPairing'](arg1);
 }
 
+export function RespondPairing(arg1, arg2) {
+  return window['go']['user']['UserService']['RespondPairing'](arg1, arg2);
+}
+
 export function ScanPeers() {
   return window['go']['user']['UserService']['ScanPeers']();
 }
@@ -37,3 +65,15 @@ export function ScanPeers() {
 export function Startup(arg1) {
   return window['go']['user']['UserService']['Startup'](arg1);
 }
+
+export function SyncContact(arg1) {
+  return window['go']['user']['UserService']['SyncContact'](arg1);
+}
+
+export function SyncDevices() {
+  return window['go']['user']['UserService']['SyncDevices']();
+}
+
+export function UpdateContact(arg1, arg2) {
+  return window['go']['user']['UserService']['UpdateContact'](arg1, arg2);
+}
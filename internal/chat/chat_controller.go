@@ -1,6 +1,7 @@
 package chat
 
 import (
+	"chat-client/internal/mesh"
 	"log"
 	"net/http"
 
@@ -13,6 +14,9 @@ type ChatController struct {
 
 type IChatController interface {
 	CreateChat(c *fiber.Ctx) error
+	ReceiveEnvelope(c *fiber.Ctx) error
+	ReceiveSignal(c *fiber.Ctx) error
+	ReceiveSync(c *fiber.Ctx) error
 }
 
 func NewChatController(chatService *ChatService) *ChatController {
@@ -29,9 +33,93 @@ func (cc *ChatController) CreateChat(c *fiber.Ctx) error {
 
 	err = cc.chatService.CreateChat(payload)
 	if err != nil {
-		log.Println(err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid chat message"})
+		switch err.Error() {
+		case "queue full":
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		case "signature missing", "invalid signature":
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		default:
+			log.Println(err)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid chat message"})
+		}
 	}
 
 	return c.JSON(fiber.Map{"status": "message received successfully"})
 }
+
+func (cc *ChatController) ReceiveEnvelope(c *fiber.Ctx) error {
+	var input mesh.PacketSchema
+
+	err := c.BodyParser(&input)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid envelope"})
+	}
+
+	err = cc.chatService.ReceiveEnvelope(input)
+	if err != nil {
+		switch err.Error() {
+		case "rate limit exceeded":
+			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+		case "mesh disabled", "unknown forwarder":
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case "hop limit reached", "no route to peer":
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case "queue full":
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		case "signature missing", "invalid signature":
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		default:
+			log.Println(err)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid envelope"})
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "envelope received successfully"})
+}
+
+func (cc *ChatController) ReceiveSignal(c *fiber.Ctx) error {
+	var input SignalSchema
+
+	err := c.BodyParser(&input)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid signal"})
+	}
+
+	err = cc.chatService.ReceiveSignal(input)
+	if err != nil {
+		switch err.Error() {
+		case "rate limit exceeded":
+			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+		case "unknown peer":
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid signal"})
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "signal received successfully"})
+}
+
+func (cc *ChatController) ReceiveSync(c *fiber.Ctx) error {
+	var input SyncSchema
+
+	err := c.BodyParser(&input)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid sync"})
+	}
+
+	err = cc.chatService.ReceiveSync(input)
+	if err != nil {
+		switch err.Error() {
+		case "queue full":
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		case "unknown peer":
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		default:
+			log.Println(err)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid sync"})
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "sync received successfully"})
+}
@@ -1,24 +1,288 @@
 package chat
 
-import "time"
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message types exchanged with peers, version 1 clients omit the type for text
+const (
+	MSG_TEXT   = "text"
+	MSG_EDIT   = "edit"
+	MSG_DELETE = "delete"
+
+	// reaction add and remove, the encrypted emoji travels in the message field
+	MSG_REACT   = "react"
+	MSG_UNREACT = "unreact"
+
+	// disappearing message timer of the conversation, the encrypted seconds travel in the message field
+	MSG_TIMER = "timer"
+)
+
+const (
+	// own messages can only be edited or deleted for everyone within these windows
+	EDIT_WINDOW   = time.Minute * 15
+	DELETE_WINDOW = time.Hour * 24
+
+	// allowance for clock skew and delivery delay when checking the peer's windows
+	WINDOW_GRACE = time.Minute
+
+	// characters of the original message shown in a quoted reply
+	PREVIEW_LENGTH = 80
+
+	// characters allowed in a reaction, enough for joined emoji sequences
+	MAX_REACTION_LENGTH = 16
+
+	// bounds of the disappearing message timer, zero turns it off
+	MIN_DISAPPEAR = time.Second * 30
+	MAX_DISAPPEAR = time.Hour * 24 * 28
+
+	// how often expired messages are looked for
+	REAP_PERIOD = time.Second * 5
+
+	// messages per history page unless asked otherwise
+	PAGE_SIZE     = 20
+	MAX_PAGE_SIZE = 100
+
+	// incoming packets kept while the session is locked
+	MAX_QUEUED = 5000
+
+	// how often and how many stored messages in an older envelope format are resealed at once
+	UPGRADE_PERIOD = time.Minute * 10
+	UPGRADE_BATCH  = 200
+)
+
+// Kinds of packets queued while the session is locked
+const (
+	QUEUED_MESSAGE  = "message"
+	QUEUED_ENVELOPE = "envelope"
+	QUEUED_SYNC     = "sync"
+)
+
+// Ephemeral signals, never persisted and only sent to peers that are online
+const (
+	SIGNAL_TYPING  = "typing"
+	SIGNAL_STOPPED = "stopped"
+	SIGNAL_VIEWING = "viewing"
+)
+
+const (
+	// an active signal expires unless it is repeated within this duration
+	SIGNAL_TTL = time.Second * 6
+
+	// the same signal is sent to a peer at most once per interval
+	SIGNAL_INTERVAL = time.Second * 2
+
+	// signals accepted from or sent to a single peer per minute
+	SIGNAL_LIMIT = 60
+)
 
 type SendMessageSchema struct {
+	ID      string `json:"id,omitempty"`
 	Sender  string `json:"sender" validate:"required,alphanum"`
+	Type    string `json:"type,omitempty"`
+	Ref     string `json:"ref,omitempty"`
+	ReplyTo string `json:"reply_to,omitempty"`
 	Message string `json:"message" validate:"required,min=1,max=250"`
+
+	// seconds the message is kept after delivery, zero keeps it
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+
+	// identity signature over the other fields and the recipient, omitted by clients from before signing
+	Signature string `json:"signature,omitempty"`
+}
+
+// Bytes covered by the signature, binding the packet to its sender and recipient
+func (sm SendMessageSchema) signed(recipient string) []byte {
+	return []byte(strings.Join([]string{
+		"message", sm.ID, sm.Sender, recipient, sm.Type, sm.Ref, sm.ReplyTo, sm.Message, strconv.FormatInt(sm.ExpiresIn, 10),
+	}, "\x00"))
+}
+
+// Compact preview of the message being replied to
+type QuotedMessage struct {
+	MessageID string `json:"message_id"`
+	Sender    string `json:"sender"`
+	Preview   string `json:"preview"`
+	Deleted   bool   `json:"deleted"`
 }
 
 type ChatMessage struct {
-	ID        uint64 `json:"id"`
-	Sender    string `json:"sender" validate:"required,alphanum"`
-	PeerID    string `json:"peer_id"`
-	Message   string `json:"message" validate:"required,min=1,max=250"`
-	CreatedAt string `json:"created_at"`
+	ID        uint64            `json:"id"`
+	MessageID string            `json:"message_id"`
+	Sender    string            `json:"sender" validate:"required,alphanum"`
+	PeerID    string            `json:"peer_id"`
+	Message   string            `json:"message" validate:"required,min=1,max=250"`
+	ReplyTo   *QuotedMessage    `json:"reply_to,omitempty"`
+	Reactions []ReactionSummary `json:"reactions,omitempty"`
+	Edited    bool              `json:"edited"`
+	Deleted   bool              `json:"deleted"`
+	ExpiresAt string            `json:"expires_at,omitempty"`
+	CreatedAt string            `json:"created_at"`
 }
 
 type ChatModel struct {
-	ID        uint64 `gorm:"primaryKey"`
-	PeerID    string `gorm:"index"`
+	ID        uint64 `gorm:"primaryKey;index:idx_chat_history,priority:2"`
+	MessageID string `gorm:"index"`
+	PeerID    string `gorm:"index:idx_chat_history,priority:1"`
 	Sender    string `gorm:"not null"`
 	Message   []byte `gorm:"not null"`
+	ReplyTo   string `gorm:"index"`
+	Deleted   bool   `gorm:"not null;default:false"`
+	EditedAt  *time.Time
+	ExpiresAt *time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// History query, at most one of before, after, around and date is used. Without any
+// of them the latest messages are returned
+type HistoryQuery struct {
+	Before uint64 `json:"before,omitempty"`
+	After  uint64 `json:"after,omitempty"`
+	Around string `json:"around,omitempty"`
+	Date   string `json:"date,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// Page of history oldest first, prev and next are the cursors for older and newer
+// messages and are zero at either end of the conversation
+type MessagePage struct {
+	Messages []ChatMessage `json:"messages"`
+	Prev     uint64        `json:"prev"`
+	Next     uint64        `json:"next"`
+	Total    int64         `json:"total"`
+	Unread   int64         `json:"unread"`
+}
+
+// Per-conversation state, the read marker is the ID of the last message read and
+// unread counts messages from the peer past it
+type ConversationModel struct {
+	PeerID     string `gorm:"primaryKey"`
+	LastReadID uint64 `gorm:"not null;default:0"`
+	Unread     int64  `gorm:"not null;default:0"`
+	UpdatedAt  time.Time
+}
+
+// User preferences of a conversation, a pin order of zero means not pinned
+type ConversationSettingsModel struct {
+	PeerID     string `gorm:"primaryKey"`
+	Muted      bool   `gorm:"not null;default:false"`
+	MutedUntil *time.Time
+	PinOrder   int  `gorm:"not null;default:0"`
+	Archived   bool `gorm:"not null;default:false"`
+	UpdatedAt  time.Time
+}
+
+type ConversationSettings struct {
+	PeerID     string `json:"peer_id"`
+	Muted      bool   `json:"muted"`
+	MutedUntil string `json:"muted_until,omitempty"`
+	PinOrder   int    `json:"pin_order"`
+	Archived   bool   `json:"archived"`
+}
+
+// Conversation overview of a contact, last message content is shortened to a preview
+type Conversation struct {
+	PeerID       string               `json:"peer_id"`
+	Username     string               `json:"username"`
+	LastMessage  *ChatMessage         `json:"last_message,omitempty"`
+	LastActivity string               `json:"last_activity,omitempty"`
+	Unread       int64                `json:"unread"`
+	Settings     ConversationSettings `json:"settings"`
+}
+
+// Emitted with chat:unread when the unread count of a conversation changes
+type UnreadEvent struct {
+	PeerID string `json:"peer_id"`
+	Unread int64  `json:"unread"`
+}
+
+// Previous content of an edited message, kept locally only
+type ChatRevisionModel struct {
+	ID        uint64 `gorm:"primaryKey"`
+	ChatID    uint64 `gorm:"index;not null"`
+	Message   []byte `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// Reaction of a sender to a message, one row per sender and emoji. The emoji is sealed
+// with the shared key of the contact and told apart by its keyed digest, rows from before
+// that keep it in plain text until they are resealed
+type ReactionModel struct {
+	ID        uint64  `gorm:"primaryKey"`
+	ChatID    uint64  `gorm:"uniqueIndex:idx_reaction_digest;not null"`
+	Sender    string  `gorm:"uniqueIndex:idx_reaction_digest;not null"`
+	Digest    *string `gorm:"uniqueIndex:idx_reaction_digest"`
+	Content   []byte
+	Emoji     string `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+type ReactionSummary struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	Senders []string `json:"senders"`
+	Mine    bool     `json:"mine"`
+}
+
+// Emitted with msg:reaction when the peer adds or removes a reaction
+type ReactionEvent struct {
+	PeerID    string            `json:"peer_id"`
+	MessageID string            `json:"message_id"`
+	Sender    string            `json:"sender"`
+	Emoji     string            `json:"emoji"`
+	Removed   bool              `json:"removed"`
+	Reactions []ReactionSummary `json:"reactions"`
+}
+
+// Signal packet, payload is the encrypted SignalData
+type SignalSchema struct {
+	Sender  string `json:"sender" validate:"required,alphanum"`
+	Payload string `json:"payload" validate:"required,base64"`
+}
+
+type SignalData struct {
+	Type   string `json:"type"`
+	SentAt int64  `json:"sent_at"`
+}
+
+// Message sent from another device of the user, payload is the SyncData encrypted with the sync key
+type SyncSchema struct {
+	Sender  string `json:"sender" validate:"required,alphanum"`
+	Payload string `json:"payload" validate:"required,base64"`
+}
+
+// Packet as sent to the contact, its content is still encrypted with the shared key of the contact
+type SyncData struct {
+	PeerID  string            `json:"peer_id"`
+	Message SendMessageSchema `json:"message"`
+}
+
+// Emitted with peer:typing when a peer signal starts or ends
+type PeerSignal struct {
+	PeerID string `json:"peer_id"`
+	Signal string `json:"signal"`
+	Active bool   `json:"active"`
+}
+
+// Emitted with chat:timer when the peer changes the disappearing message timer
+type TimerEvent struct {
+	PeerID         string `json:"peer_id"`
+	DisappearAfter int64  `json:"disappear_after"`
+}
+
+// Incoming packet received while the session is locked, data is the packet as received
+// so its content stays encrypted with the shared key until unlocked
+type QueuedPacketModel struct {
+	ID        uint64 `gorm:"primaryKey"`
+	Kind      string `gorm:"not null"`
+	Sender    string `gorm:"index;not null"`
+	Data      []byte `gorm:"not null"`
 	CreatedAt time.Time
 }
+
+type ChatRevision struct {
+	Message   string `json:"message"`
+	CreatedAt string `json:"created_at"`
+}
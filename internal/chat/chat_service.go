@@ -1,241 +1,2528 @@
 package chat
 
 import (
-	"bytes"
 	"chat-client/internal/discovery"
+	"chat-client/internal/identity"
+	"chat-client/internal/mesh"
+	"chat-client/internal/presence"
+	"chat-client/internal/protocol"
+	"chat-client/internal/session"
 	"chat-client/internal/user"
 	"chat-client/pkg/encryption"
+	"chat-client/pkg/ratelimit"
 	"chat-client/pkg/response"
 	"chat-client/pkg/store"
+	"cmp"
 	"context"
 	"encoding/base64"
 	"errors"
-	"fmt"
-	"net/http"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bytedance/sonic"
 	"github.com/oklog/ulid/v2"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ChatService struct {
 	ctx              context.Context
 	db               *gorm.DB
 	s                *store.Store
+	keyring          *user.Keyring
 	discoveryService *discovery.DiscoveryService
+	identityService  *identity.IdentityService
+	meshService      *mesh.MeshService
+	presenceService  *presence.PresenceService
+	protocolService  *protocol.ProtocolService
+	sessionService   *session.SessionService
+	sendLimiter      *ratelimit.Limiter
+	recvLimiter      *ratelimit.Limiter
+	signals          map[string]*time.Timer
+	sent             map[string]time.Time
+	mu               sync.Mutex
+	replaying        sync.Mutex
 }
 
 type IChatService interface {
+	AddReaction(peerId, messageId, emoji string) response.Response[ChatMessage]
+	applyDelete(chat *ChatModel) error
+	applyEdit(chat *ChatModel, encrypted []byte) error
+	clearSignal(peerId, signal string)
+	countUnread(peerId string)
 	CreateChat(input SendMessageSchema) error
+	DeleteMessage(peerId, messageId string) response.Response[ChatMessage]
+	deliver(peerId string, payload SendMessageSchema) error
+	disappearAfter(peerId string) int64
+	EditMessage(peerId, messageId, message string) response.Response[ChatMessage]
+	encrypt(peerId, message string) ([]byte, string, error)
+	fillQuotes(peerId string, messages []ChatMessage, keys *user.SharedKeys) error
+	fillReactions(messages []ChatMessage) error
+	findOwnMessage(peerId, messageId string, window time.Duration) (ChatModel, error)
+	GetConversations(archived bool) response.Response[[]Conversation]
+	GetConversationSettings(peerId string) response.Response[ConversationSettings]
+	GetHistory(peerId string, query HistoryQuery) response.Response[MessagePage]
 	GetMessages(peerId string, cursor uint64) response.Response[[]ChatMessage]
-	SendMessage(contact user.ContactModel, input SendMessageSchema) response.Response[string]
+	GetRevisions(peerId, messageId string) response.Response[[]ChatRevision]
+	GetThread(peerId, messageId string) response.Response[[]ChatMessage]
+	handleEnvelope(peerId string, data []byte) error
+	handleMessage(peerId string, data []byte) error
+	handleSignal(peerId string, data []byte) error
+	handleSync(peerId string, data []byte) error
+	history(peerId string, query HistoryQuery) (MessagePage, error)
+	isMuted(peerId string) bool
+	MarkAllRead() response.Response[int64]
+	MarkConversationRead(peerId string) response.Response[int64]
+	MarkRead(peerId string, id uint64) response.Response[int64]
+	queue(kind, sender string, v any) error
+	react(peerId, messageId, emoji string, remove bool) response.Response[ChatMessage]
+	reap()
+	ReapMessages()
+	receiveDelete(input SendMessageSchema, decrypted []byte) error
+	receiveEdit(input SendMessageSchema, decrypted []byte) error
+	ReceiveEnvelope(input mesh.PacketSchema) error
+	receiveReaction(input SendMessageSchema, decrypted []byte) error
+	ReceiveSignal(input SignalSchema) error
+	ReceiveSync(input SyncSchema) error
+	receiveTimer(input SendMessageSchema, decrypted []byte) error
+	recount(peerId string) (int64, error)
+	receiveText(input SendMessageSchema, decrypted []byte) error
+	RemoveReaction(peerId, messageId, emoji string) response.Response[ChatMessage]
+	replayQueued()
+	requireFeature(peerId, feature string) error
+	seal(peerId string, content []byte) ([]byte, error)
+	SendMessage(contact user.ContactModel, input SendMessageSchema) response.Response[ChatMessage]
+	SendSignal(peerId, signal string) response.Response[bool]
+	SetArchived(peerId string, archived bool) response.Response[ConversationSettings]
+	SetDisappearingTimer(peerId string, seconds int64) response.Response[int64]
+	SetMuted(peerId string, muted bool, until string) response.Response[ConversationSettings]
+	SetPinned(peerId string, pinned bool) response.Response[ConversationSettings]
+	SetPinOrder(peerIds []string) response.Response[[]ConversationSettings]
+	settings(peerId string) (ConversationSettingsModel, error)
+	setSignal(peerId, signal string)
 	Startup(ctx context.Context)
+	storeReaction(chat ChatModel, sender, emoji string, remove bool) error
+	syncDevices(peerId string, payload SendMessageSchema)
+	syncText(peerId string, input SendMessageSchema, decrypted []byte) error
+	toMessage(chat ChatModel, keys *user.SharedKeys) (ChatMessage, error)
+	toSettings(settings ConversationSettingsModel) ConversationSettings
+	unread(peerId string) (int64, error)
+	updateSettings(peerId string, values map[string]any) response.Response[ConversationSettings]
+	sealReactions() error
+	sealedWith(keyId string) (bool, error)
+	upgrade(table, column, peerColumn, join string, skipped map[string]bool) error
+	UpgradeMessages()
+	visible(peerId string) *gorm.DB
 }
 
-func NewChatService(s *store.Store, db *gorm.DB, discoveryService *discovery.DiscoveryService) *ChatService {
-	return &ChatService{s: s, db: db, discoveryService: discoveryService}
+func NewChatService(s *store.Store, db *gorm.DB, keyring *user.Keyring, discoveryService *discovery.DiscoveryService, identityService *identity.IdentityService, meshService *mesh.MeshService, presenceService *presence.PresenceService, protocolService *protocol.ProtocolService, sessionService *session.SessionService) *ChatService {
+	cs := &ChatService{
+		s:                s,
+		db:               db,
+		keyring:          keyring,
+		discoveryService: discoveryService,
+		identityService:  identityService,
+		meshService:      meshService,
+		presenceService:  presenceService,
+		protocolService:  protocolService,
+		sessionService:   sessionService,
+		sendLimiter:      ratelimit.NewLimiter(SIGNAL_LIMIT, time.Minute),
+		recvLimiter:      ratelimit.NewLimiter(SIGNAL_LIMIT, time.Minute),
+		signals:          make(map[string]*time.Timer),
+		sent:             make(map[string]time.Time),
+	}
+
+	// receive chat frames over peer sessions
+	sessionService.Handle("chat:send", "/api/chat/send", cs.handleMessage)
+	sessionService.Handle("chat:signal", "/api/chat/signal", cs.handleSignal)
+	sessionService.Handle("chat:sync", "/api/chat/sync", cs.handleSync)
+	sessionService.Handle("mesh:forward", "/api/mesh/forward", cs.handleEnvelope)
+
+	// process what arrived while the session was locked
+	keyring.OnUnlock(cs.replayQueued)
+
+	return cs
+}
+
+// Shorten message to a single quoted line
+func preview(message string) string {
+	runes := []rune(message)
+	if len(runes) <= PREVIEW_LENGTH {
+		return message
+	}
+
+	return string(runes[:PREVIEW_LENGTH]) + "…"
+}
+
+func statusOf(err error) int {
+	switch err.Error() {
+	case "peer is not found", "message not found":
+		return 404
+	case "window expired", "edit window expired", "delete window expired":
+		return 403
+	case "invalid reaction", "invalid timer", "invalid query", "invalid settings":
+		return 400
+	case "peer too old":
+		return 426
+	case "peer is unreachable":
+		return 503
+	case "signature missing", "invalid signature":
+		return 401
+	default:
+		return 500
+	}
+}
+
+// React to a message in the conversation with a peer
+func (cs *ChatService) AddReaction(peerId, messageId, emoji string) response.Response[ChatMessage] {
+	return cs.react(peerId, messageId, emoji, false)
+}
+
+// Wipe message content, its revisions and reactions, leaving a tombstone
+func (cs *ChatService) applyDelete(chat *ChatModel) error {
+	return cs.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&ChatRevisionModel{}, "chat_id = ?", chat.ID).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(&ReactionModel{}, "chat_id = ?", chat.ID).Error
+		if err != nil {
+			return err
+		}
+
+		chat.Message = []byte{}
+		chat.Deleted = true
+
+		return tx.Model(chat).Updates(map[string]any{"message": chat.Message, "deleted": true}).Error
+	})
+}
+
+// Keep current content as a revision and replace it
+func (cs *ChatService) applyEdit(chat *ChatModel, encrypted []byte) error {
+	return cs.db.Transaction(func(tx *gorm.DB) error {
+		revision := ChatRevisionModel{
+			ChatID:  chat.ID,
+			Message: chat.Message,
+		}
+
+		err := tx.Create(&revision).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		chat.Message = encrypted
+		chat.EditedAt = &now
+
+		return tx.Model(chat).Updates(map[string]any{"message": encrypted, "edited_at": now}).Error
+	})
+}
+
+// End an active peer signal before it expires
+func (cs *ChatService) clearSignal(peerId, signal string) {
+	key := peerId + ":" + signal
+
+	cs.mu.Lock()
+	timer, ok := cs.signals[key]
+	if ok {
+		timer.Stop()
+		delete(cs.signals, key)
+	}
+	cs.mu.Unlock()
+
+	if ok {
+		runtime.EventsEmit(cs.ctx, "peer:typing", PeerSignal{PeerID: peerId, Signal: signal})
+	}
+}
+
+// Add a received message to the unread counter of its conversation
+func (cs *ChatService) countUnread(peerId string) {
+	conversation := ConversationModel{PeerID: peerId, Unread: 1}
+
+	err := cs.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "peer_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"unread":     gorm.Expr("unread + 1"),
+			"updated_at": gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&conversation).Error
+	if err != nil {
+		log.Println("failed to count unread message:", err)
+		return
+	}
+
+	unread, err := cs.unread(peerId)
+	if err != nil {
+		return
+	}
+
+	// notify frontend subscriber for unread count event
+	runtime.EventsEmit(cs.ctx, "chat:unread", UnreadEvent{PeerID: peerId, Unread: unread})
+}
+
+func (cs *ChatService) CreateChat(input SendMessageSchema) error {
+	var decoded, decrypted []byte
+
+	// keep the message encrypted until the session is unlocked
+	if cs.keyring.Locked() {
+		return cs.queue(QUEUED_MESSAGE, input.Sender, input)
+	}
+
+	// contacts whose identity key is known must sign, so the shared key alone cannot forge them
+	err := cs.identityService.Verify(input.Sender, identity.SIGNED_MESSAGE, input.signed(cs.s.GetString("user:id")), input.Signature)
+	if err != nil {
+		return err
+	}
+
+	decoded, err = base64.StdEncoding.DecodeString(input.Message)
+	if err != nil {
+		return errors.New("failed to decode message")
+	}
+
+	// keys retired by a rotation still open packets sent before it
+	decrypted, err = cs.keyring.Decrypt(input.Sender, decoded)
+	if err != nil {
+		if err.Error() != "failed to decrypt" {
+			return err
+		}
+
+		return errors.New("failed to decrypt message")
+	}
+
+	switch input.Type {
+	case "", MSG_TEXT:
+		return cs.receiveText(input, decrypted)
+	case MSG_EDIT:
+		return cs.receiveEdit(input, decrypted)
+	case MSG_DELETE:
+		return cs.receiveDelete(input, decrypted)
+	case MSG_REACT, MSG_UNREACT:
+		return cs.receiveReaction(input, decrypted)
+	case MSG_TIMER:
+		return cs.receiveTimer(input, decrypted)
+	default:
+		return errors.New("unsupported message type")
+	}
+}
+
+// Delete own message for both sides
+func (cs *ChatService) DeleteMessage(peerId, messageId string) response.Response[ChatMessage] {
+	var message ChatMessage
+
+	chat, err := cs.findOwnMessage(peerId, messageId, DELETE_WINDOW)
+	if err != nil {
+		return response.New(message).Status(statusOf(err))
+	}
+
+	err = cs.requireFeature(peerId, protocol.FEATURE_EDIT)
+	if err != nil {
+		return response.New(message).Status(statusOf(err))
+	}
+
+	// the ref is encrypted as the content, so the deletion cannot be forged without the shared key
+	_, encoded, err := cs.encrypt(peerId, messageId)
+	if err != nil {
+		return response.New(message).Status(500)
+	}
+
+	payload := SendMessageSchema{
+		ID:      ulid.Make().String(),
+		Sender:  cs.s.GetString("user:id"),
+		Type:    MSG_DELETE,
+		Ref:     messageId,
+		Message: encoded,
+	}
+
+	err = cs.deliver(peerId, payload)
+	if err != nil {
+		return response.New(message).Status(statusOf(err))
+	}
+
+	err = cs.applyDelete(&chat)
+	if err != nil {
+		return response.New(message).Status(500)
+	}
+
+	// show the change on the other devices of the user
+	go cs.syncDevices(peerId, payload)
+
+	message, _ = cs.toMessage(chat, nil)
+	return response.New(message)
+}
+
+// Sign payload and send it over the peer session, relaying it through the mesh if the peer is out of reach
+func (cs *ChatService) deliver(peerId string, payload SendMessageSchema) error {
+	signature, err := cs.keyring.Sign(payload.signed(peerId))
+	if err != nil {
+		return err
+	}
+
+	payload.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	peer := cs.discoveryService.GetPeer(peerId)
+	if peer.IP != "" {
+		err = cs.protocolService.RequireCompatible(peerId)
+		if err != nil && err.Error() == "peer too old" {
+			return err
+		}
+
+		// a peer that does not answer may still be reached through the mesh
+		if err == nil {
+			err = cs.sessionService.Send(peerId, "chat:send", payload)
+			if err == nil {
+				return nil
+			}
+		}
+	}
+
+	// relay through mutually paired contacts
+	meshErr := cs.meshService.Send(peerId, payload)
+	if meshErr != nil {
+		log.Println(meshErr)
+
+		if peer.IP == "" {
+			return errors.New("peer is not found")
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Get the disappearing message timer of a contact in seconds
+func (cs *ChatService) disappearAfter(peerId string) int64 {
+	var contact user.ContactModel
+
+	err := cs.db.First(&contact, "ID = ?", peerId).Error
+	if err != nil {
+		return 0
+	}
+
+	return contact.DisappearAfter
+}
+
+// Edit own message for both sides
+func (cs *ChatService) EditMessage(peerId, messageId, message string) response.Response[ChatMessage] {
+	var result ChatMessage
+
+	chat, err := cs.findOwnMessage(peerId, messageId, EDIT_WINDOW)
+	if err != nil {
+		return response.New(result).Status(statusOf(err))
+	}
+
+	err = cs.requireFeature(peerId, protocol.FEATURE_EDIT)
+	if err != nil {
+		return response.New(result).Status(statusOf(err))
+	}
+
+	encrypted, encoded, err := cs.encrypt(peerId, message)
+	if err != nil {
+		return response.New(result).Status(500)
+	}
+
+	payload := SendMessageSchema{
+		ID:      ulid.Make().String(),
+		Sender:  cs.s.GetString("user:id"),
+		Type:    MSG_EDIT,
+		Ref:     messageId,
+		Message: encoded,
+	}
+
+	err = cs.deliver(peerId, payload)
+	if err != nil {
+		return response.New(result).Status(statusOf(err))
+	}
+
+	err = cs.applyEdit(&chat, encrypted)
+	if err != nil {
+		return response.New(result).Status(500)
+	}
+
+	// show the change on the other devices of the user
+	go cs.syncDevices(peerId, payload)
+
+	result, _ = cs.toMessage(chat, nil)
+	result.Message = message
+
+	results := []ChatMessage{result}
+	cs.fillQuotes(peerId, results, nil)
+
+	return response.New(results[0])
+}
+
+// Encrypt message with the shared key, returning it sealed for storage and the base64
+// wire ciphertext, which stays in the format older peers read
+func (cs *ChatService) encrypt(peerId, message string) ([]byte, string, error) {
+	sharedKey, err := cs.keyring.SharedKey(peerId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	encrypted, err := encryption.AESEncrypt(sharedKey, []byte(message))
+	if err != nil {
+		return nil, "", errors.New("failed to encrypt message")
+	}
+
+	sealed, err := cs.seal(peerId, []byte(message))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sealed, base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// Resolve quoted previews of replies, the originals may be outside the current page
+func (cs *ChatService) fillQuotes(peerId string, messages []ChatMessage, keys *user.SharedKeys) error {
+	var originals []ChatModel
+	var ids []string
+
+	for _, message := range messages {
+		if message.ReplyTo != nil {
+			ids = append(ids, message.ReplyTo.MessageID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := cs.db.Find(&originals, "peer_id = ? AND message_id IN ?", peerId, ids).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	if keys == nil {
+		keys, err = cs.keyring.SharedKeys(peerId)
+		if err != nil {
+			return err
+		}
+	}
+
+	quotes := make(map[string]QuotedMessage)
+	for _, original := range originals {
+		quoted, err := cs.toMessage(original, keys)
+		if err != nil {
+			continue
+		}
+
+		quotes[original.MessageID] = QuotedMessage{
+			MessageID: original.MessageID,
+			Sender:    original.Sender,
+			Preview:   preview(quoted.Message),
+			Deleted:   original.Deleted,
+		}
+	}
+
+	for i := range messages {
+		if messages[i].ReplyTo == nil {
+			continue
+		}
+
+		// the original may never have reached this side
+		if quote, ok := quotes[messages[i].ReplyTo.MessageID]; ok {
+			messages[i].ReplyTo = &quote
+		}
+	}
+
+	return nil
+}
+
+// Summarise reactions of each message, grouped by emoji in order of first use
+func (cs *ChatService) fillReactions(messages []ChatMessage) error {
+	type row struct {
+		ChatID  uint64
+		Sender  string
+		Emoji   string
+		Content []byte
+		PeerID  string
+	}
+
+	var reactions []row
+	var ids []uint64
+
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := cs.db.Table("reaction_models AS r").Select("r.chat_id, r.sender, r.emoji, r.content, c.peer_id").
+		Joins("JOIN chat_models c ON c.id = r.chat_id").
+		Where("r.chat_id IN ?", ids).Order("r.id").Scan(&reactions).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	userId := cs.s.GetString("user:id")
+	summaries := make(map[uint64][]ReactionSummary)
+	keys := make(map[string]*user.SharedKeys)
+
+	for _, reaction := range reactions {
+		// sealed emoji are opened with the keys of the conversation, reactions no key opens are left out
+		if len(reaction.Content) > 0 {
+			sharedKeys, ok := keys[reaction.PeerID]
+			if !ok {
+				sharedKeys, err = cs.keyring.SharedKeys(reaction.PeerID)
+				if err != nil {
+					return err
+				}
+				keys[reaction.PeerID] = sharedKeys
+			}
+
+			decrypted, err := sharedKeys.Open(reaction.Content)
+			if err != nil {
+				continue
+			}
+
+			reaction.Emoji = string(decrypted)
+		}
+
+		list := summaries[reaction.ChatID]
+
+		i := 0
+		for i < len(list) && list[i].Emoji != reaction.Emoji {
+			i++
+		}
+
+		if i == len(list) {
+			list = append(list, ReactionSummary{Emoji: reaction.Emoji, Senders: []string{}})
+		}
+
+		list[i].Count++
+		list[i].Senders = append(list[i].Senders, reaction.Sender)
+		list[i].Mine = list[i].Mine || reaction.Sender == userId
+
+		summaries[reaction.ChatID] = list
+	}
+
+	for i := range messages {
+		messages[i].Reactions = summaries[messages[i].ID]
+	}
+
+	return nil
+}
+
+// Find a message sent by this user that is still within the given window
+func (cs *ChatService) findOwnMessage(peerId, messageId string, window time.Duration) (ChatModel, error) {
+	var chat ChatModel
+
+	err := cs.db.First(&chat, "peer_id = ? AND message_id = ? AND sender = ? AND deleted = ?", peerId, messageId, cs.s.GetString("user:id"), false).Error
+	if err != nil {
+		return chat, errors.New("message not found")
+	}
+
+	if time.Since(chat.CreatedAt) > window {
+		return chat, errors.New("window expired")
+	}
+
+	return chat, nil
+}
+
+// Get conversations of the archive or the inbox, pinned first then most recently active
+func (cs *ChatService) GetConversations(archived bool) response.Response[[]Conversation] {
+	var contacts []user.ContactModel
+	var conversations []ConversationModel
+	var settings []ConversationSettingsModel
+	var latest []ChatModel
+
+	results := []Conversation{}
+
+	err := cs.db.Find(&contacts).Error
+	if err != nil {
+		return response.New(results).Status(500)
+	}
+
+	err = cs.db.Find(&conversations).Error
+	if err != nil {
+		return response.New(results).Status(500)
+	}
+
+	err = cs.db.Find(&settings).Error
+	if err != nil {
+		return response.New(results).Status(500)
+	}
+
+	err = cs.db.Raw(`
+		SELECT * FROM chat_models WHERE id IN (
+			SELECT MAX(id) FROM chat_models WHERE expires_at IS NULL OR expires_at > ? GROUP BY peer_id
+		)`, time.Now()).Scan(&latest).Error
+	if err != nil {
+		return response.New(results).Status(500)
+	}
+
+	unread := make(map[string]int64)
+	for _, conversation := range conversations {
+		unread[conversation.PeerID] = conversation.Unread
+	}
+
+	last := make(map[string]ChatModel)
+	for _, chat := range latest {
+		last[chat.PeerID] = chat
+	}
+
+	preferences := make(map[string]ConversationSettingsModel)
+	for _, setting := range settings {
+		preferences[setting.PeerID] = setting
+	}
+
+	for _, contact := range contacts {
+		setting, ok := preferences[contact.ID]
+		if !ok {
+			setting = ConversationSettingsModel{PeerID: contact.ID}
+		}
+
+		if setting.Archived != archived {
+			continue
+		}
+
+		result := Conversation{
+			PeerID:   contact.ID,
+			Username: contact.Username,
+			Unread:   unread[contact.ID],
+			Settings: cs.toSettings(setting),
+		}
+
+		if chat, ok := last[contact.ID]; ok {
+			keys, _ := cs.keyring.SharedKeys(contact.ID)
+
+			// the preview is left empty if the key is unavailable
+			message, _ := cs.toMessage(chat, keys)
+			message.Message = preview(message.Message)
+
+			result.LastMessage = &message
+			result.LastActivity = message.CreatedAt
+		}
+
+		results = append(results, result)
+	}
+
+	// message IDs grow with time, conversations without messages go last
+	activity := func(c Conversation) uint64 {
+		if c.LastMessage == nil {
+			return 0
+		}
+		return c.LastMessage.ID
+	}
+
+	// unpinned conversations sort after every pinned one
+	pin := func(c Conversation) int {
+		if c.Settings.PinOrder == 0 {
+			return math.MaxInt
+		}
+		return c.Settings.PinOrder
+	}
+
+	slices.SortFunc(results, func(a, b Conversation) int {
+		return cmp.Or(
+			cmp.Compare(pin(a), pin(b)),
+			cmp.Compare(activity(b), activity(a)),
+			strings.Compare(a.Username, b.Username),
+		)
+	})
+
+	return response.New(results)
+}
+
+func (cs *ChatService) GetConversationSettings(peerId string) response.Response[ConversationSettings] {
+	settings, err := cs.settings(peerId)
+	if err != nil {
+		return response.New(ConversationSettings{PeerID: peerId}).Status(500)
+	}
+
+	return response.New(cs.toSettings(settings))
+}
+
+// Get a page of history around a cursor, message ID or date
+func (cs *ChatService) GetHistory(peerId string, query HistoryQuery) response.Response[MessagePage] {
+	page, err := cs.history(peerId, query)
+	if err != nil {
+		return response.New(page).Status(statusOf(err))
+	}
+
+	return response.New(page)
+}
+
+// Get messages older than the cursor, or the latest messages if the cursor is zero
+func (cs *ChatService) GetMessages(peerId string, cursor uint64) response.Response[[]ChatMessage] {
+	page, err := cs.history(peerId, HistoryQuery{Before: cursor})
+	if err != nil {
+		return response.New(page.Messages).Status(statusOf(err))
+	}
+
+	// check if no older messages
+	if len(page.Messages) == 0 {
+		return response.New(page.Messages).Status(404)
+	}
+
+	return response.New(page.Messages)
+}
+
+// Get previous contents of an edited message, oldest first
+func (cs *ChatService) GetRevisions(peerId, messageId string) response.Response[[]ChatRevision] {
+	var chat ChatModel
+	var revisions []ChatRevisionModel
+	var results []ChatRevision
+
+	err := cs.db.First(&chat, "peer_id = ? AND message_id = ?", peerId, messageId).Error
+	if err != nil {
+		return response.New(results).Status(404)
+	}
+
+	err = cs.db.Order("id").Find(&revisions, "chat_id = ?", chat.ID).Error
+	if err != nil {
+		return response.New(results).Status(500)
+	}
+
+	keys, err := cs.keyring.SharedKeys(peerId)
+	if err != nil {
+		return response.New(results).Status(500)
+	}
+
+	for _, revision := range revisions {
+		decrypted, err := keys.Open(revision.Message)
+		if err != nil {
+			return response.New(results).Status(500)
+		}
+
+		results = append(results, ChatRevision{
+			Message:   string(decrypted),
+			CreatedAt: revision.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return response.New(results)
+}
+
+// Get a message and every reply below it, oldest first
+func (cs *ChatService) GetThread(peerId, messageId string) response.Response[[]ChatMessage] {
+	var messages []ChatModel
+	var results []ChatMessage
+
+	err := cs.db.Raw(`
+		WITH RECURSIVE thread(message_id) AS (
+			SELECT ?
+			UNION
+			SELECT c.message_id FROM chat_models c JOIN thread t ON c.reply_to = t.message_id WHERE c.peer_id = ?
+		)
+		SELECT * FROM chat_models WHERE peer_id = ? AND message_id IN (SELECT message_id FROM thread)
+			AND (expires_at IS NULL OR expires_at > ?) ORDER BY id`,
+		messageId, peerId, peerId, time.Now()).Scan(&messages).Error
+	if err != nil {
+		return response.New(results).Status(500)
+	}
+
+	if len(messages) == 0 {
+		return response.New(results).Status(404)
+	}
+
+	keys, err := cs.keyring.SharedKeys(peerId)
+	if err != nil {
+		return response.New(results).Status(500)
+	}
+
+	for _, message := range messages {
+		result, err := cs.toMessage(message, keys)
+		if err != nil {
+			return response.New(results).Status(500)
+		}
+
+		results = append(results, result)
+	}
+
+	err = cs.fillQuotes(peerId, results, keys)
+	if err != nil {
+		return response.New(results).Status(500)
+	}
+
+	err = cs.fillReactions(results)
+	if err != nil {
+		return response.New(results).Status(500)
+	}
+
+	return response.New(results)
+}
+
+func (cs *ChatService) handleEnvelope(peerId string, data []byte) error {
+	var input mesh.PacketSchema
+
+	err := sonic.Unmarshal(data, &input)
+	if err != nil {
+		return errors.New("invalid envelope")
+	}
+
+	// the session is already authenticated as the forwarder
+	input.Sender = peerId
+
+	return cs.ReceiveEnvelope(input)
+}
+
+func (cs *ChatService) handleMessage(peerId string, data []byte) error {
+	var input SendMessageSchema
+
+	err := sonic.Unmarshal(data, &input)
+	if err != nil {
+		return errors.New("invalid chat message")
+	}
+
+	input.Sender = peerId
+
+	return cs.CreateChat(input)
+}
+
+// Decode a signal frame of the peer session, the sender is the authenticated peer
+func (cs *ChatService) handleSignal(peerId string, data []byte) error {
+	var input SignalSchema
+
+	err := sonic.Unmarshal(data, &input)
+	if err != nil {
+		return errors.New("invalid signal")
+	}
+
+	input.Sender = peerId
+
+	return cs.ReceiveSignal(input)
+}
+
+func (cs *ChatService) handleSync(peerId string, data []byte) error {
+	var input SyncSchema
+
+	err := sonic.Unmarshal(data, &input)
+	if err != nil {
+		return errors.New("invalid sync")
+	}
+
+	input.Sender = peerId
+
+	return cs.ReceiveSync(input)
+}
+
+// Load a page of history using keyset pagination over the message ID
+func (cs *ChatService) history(peerId string, query HistoryQuery) (MessagePage, error) {
+	var older, newer []ChatModel
+	var anchor ChatModel
+	var err error
+
+	page := MessagePage{Messages: []ChatMessage{}}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = PAGE_SIZE
+	}
+	limit = min(limit, MAX_PAGE_SIZE)
+
+	switch {
+	case query.Before > 0:
+		err = cs.visible(peerId).Where("id < ?", query.Before).Order("id DESC").Limit(limit).Find(&older).Error
+	case query.After > 0:
+		err = cs.visible(peerId).Where("id > ?", query.After).Order("id").Limit(limit).Find(&newer).Error
+	case query.Around != "" || query.Date != "":
+		if query.Around != "" {
+			err = cs.visible(peerId).Where("message_id = ?", query.Around).First(&anchor).Error
+			if err != nil {
+				return page, errors.New("message not found")
+			}
+		} else {
+			date, parseErr := time.Parse(time.RFC3339, query.Date)
+			if parseErr != nil {
+				return page, errors.New("invalid query")
+			}
+
+			// first message on or after the date, or the latest one before it
+			err = cs.visible(peerId).Where("created_at >= ?", date).Order("id").First(&anchor).Error
+			if err != nil {
+				err = cs.visible(peerId).Order("id DESC").First(&anchor).Error
+			}
+
+			// empty conversation
+			if err != nil {
+				err = nil
+				break
+			}
+		}
+
+		// center the page on the anchor, even the smallest page keeps the anchor and what came before it
+		err = cs.visible(peerId).Where("id < ?", anchor.ID).Order("id DESC").Limit(max(1, limit/2)).Find(&older).Error
+		if err == nil {
+			err = cs.visible(peerId).Where("id >= ?", anchor.ID).Order("id").Limit(max(1, limit-len(older))).Find(&newer).Error
+		}
+	default:
+		err = cs.visible(peerId).Order("id DESC").Limit(limit).Find(&older).Error
+	}
+	if err != nil {
+		return page, errors.New("db error")
+	}
+
+	// older messages were loaded newest first
+	messages := make([]ChatModel, 0, len(older)+len(newer))
+	for i := len(older) - 1; i >= 0; i-- {
+		messages = append(messages, older[i])
+	}
+	messages = append(messages, newer...)
+
+	err = cs.visible(peerId).Count(&page.Total).Error
+	if err != nil {
+		return page, errors.New("db error")
+	}
+
+	page.Unread, err = cs.unread(peerId)
+	if err != nil {
+		return page, err
+	}
+
+	if len(messages) == 0 {
+		return page, nil
+	}
+
+	// cursors are only set when there is more to load past the page
+	var before, after []uint64
+	first, last := messages[0].ID, messages[len(messages)-1].ID
+
+	cs.visible(peerId).Where("id < ?", first).Limit(1).Pluck("id", &before)
+	if len(before) > 0 {
+		page.Prev = first
+	}
+
+	cs.visible(peerId).Where("id > ?", last).Limit(1).Pluck("id", &after)
+	if len(after) > 0 {
+		page.Next = last
+	}
+
+	keys, err := cs.keyring.SharedKeys(peerId)
+	if err != nil {
+		return page, err
+	}
+
+	for _, message := range messages {
+		result, err := cs.toMessage(message, keys)
+		if err != nil {
+			return page, err
+		}
+
+		page.Messages = append(page.Messages, result)
+	}
+
+	err = cs.fillQuotes(peerId, page.Messages, keys)
+	if err != nil {
+		return page, err
+	}
+
+	err = cs.fillReactions(page.Messages)
+	if err != nil {
+		return page, err
+	}
+
+	return page, nil
+}
+
+// Report whether notifications of a conversation are silenced right now
+func (cs *ChatService) isMuted(peerId string) bool {
+	settings, err := cs.settings(peerId)
+	if err != nil || !settings.Muted {
+		return false
+	}
+
+	return settings.MutedUntil == nil || time.Now().Before(*settings.MutedUntil)
+}
+
+// Mark every conversation as read, returning the number of conversations updated
+func (cs *ChatService) MarkAllRead() response.Response[int64] {
+	var conversations []ConversationModel
+	var count int64
+
+	err := cs.db.Find(&conversations, "unread > ?", 0).Error
+	if err != nil {
+		return response.New(count).Status(500)
+	}
+
+	for _, conversation := range conversations {
+		res := cs.MarkConversationRead(conversation.PeerID)
+		if res.Code != 200 {
+			return response.New(count).Status(res.Code)
+		}
+
+		count++
+	}
+
+	return response.New(count)
+}
+
+// Mark a conversation as read up to its latest message
+func (cs *ChatService) MarkConversationRead(peerId string) response.Response[int64] {
+	var ids []uint64
+
+	err := cs.visible(peerId).Order("id DESC").Limit(1).Pluck("id", &ids).Error
+	if err != nil {
+		return response.New(int64(0)).Status(500)
+	}
+
+	if len(ids) == 0 {
+		return response.New(int64(0))
+	}
+
+	return cs.MarkRead(peerId, ids[0])
+}
+
+// Move the read marker of a conversation forward, returning the remaining unread count
+func (cs *ChatService) MarkRead(peerId string, id uint64) response.Response[int64] {
+	// reading a conversation counts as activity for auto-away and auto-lock
+	cs.presenceService.ReportActivity()
+
+	conversation := ConversationModel{PeerID: peerId, LastReadID: id}
+
+	err := cs.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "peer_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"last_read_id": gorm.Expr("MAX(last_read_id, excluded.last_read_id)"),
+			"updated_at":   gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&conversation).Error
+	if err != nil {
+		return response.New(int64(0)).Status(500)
+	}
+
+	unread, err := cs.recount(peerId)
+	if err != nil {
+		return response.New(unread).Status(500)
+	}
+
+	return response.New(unread)
+}
+
+// Store an incoming packet of a contact as received while the session is locked
+func (cs *ChatService) queue(kind, sender string, v any) error {
+	var contacts, queued int64
+
+	// other devices of the user are not contacts
+	if sender != cs.s.GetString("user:id") {
+		err := cs.db.Model(&user.ContactModel{}).Where("ID = ?", sender).Count(&contacts).Error
+		if err != nil {
+			return errors.New("db error")
+		}
+
+		if contacts == 0 {
+			return errors.New("shared key not found")
+		}
+	}
+
+	err := cs.db.Model(&QueuedPacketModel{}).Count(&queued).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	if queued >= MAX_QUEUED {
+		return errors.New("queue full")
+	}
+
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		return errors.New("failed to generate json")
+	}
+
+	err = cs.db.Create(&QueuedPacketModel{Kind: kind, Sender: sender, Data: data}).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+// Count unread messages again from the read marker, after messages were removed
+// or the marker moved
+func (cs *ChatService) recount(peerId string) (int64, error) {
+	var conversation ConversationModel
+	var count int64
+
+	err := cs.db.Limit(1).Find(&conversation, "peer_id = ?", peerId).Error
+	if err != nil {
+		return 0, errors.New("db error")
+	}
+
+	err = cs.visible(peerId).Where("sender = ? AND id > ? AND deleted = ?", peerId, conversation.LastReadID, false).Count(&count).Error
+	if err != nil {
+		return 0, errors.New("db error")
+	}
+
+	err = cs.db.Model(&ConversationModel{}).Where("peer_id = ?", peerId).Update("unread", count).Error
+	if err != nil {
+		return 0, errors.New("db error")
+	}
+
+	// notify frontend subscriber for unread count event
+	runtime.EventsEmit(cs.ctx, "chat:unread", UnreadEvent{PeerID: peerId, Unread: count})
+
+	return count, nil
+}
+
+// Add or remove own reaction on a message and sync it to the peer
+func (cs *ChatService) react(peerId, messageId, emoji string, remove bool) response.Response[ChatMessage] {
+	var result ChatMessage
+	var chat ChatModel
+
+	length := utf8.RuneCountInString(emoji)
+	if length == 0 || length > MAX_REACTION_LENGTH {
+		return response.New(result).Status(statusOf(errors.New("invalid reaction")))
+	}
+
+	err := cs.db.First(&chat, "peer_id = ? AND message_id = ? AND deleted = ?", peerId, messageId, false).Error
+	if err != nil {
+		return response.New(result).Status(statusOf(errors.New("message not found")))
+	}
+
+	err = cs.requireFeature(peerId, protocol.FEATURE_REACTION)
+	if err != nil {
+		return response.New(result).Status(statusOf(err))
+	}
+
+	_, encoded, err := cs.encrypt(peerId, emoji)
+	if err != nil {
+		return response.New(result).Status(500)
+	}
+
+	payload := SendMessageSchema{
+		ID:      ulid.Make().String(),
+		Sender:  cs.s.GetString("user:id"),
+		Type:    MSG_REACT,
+		Ref:     messageId,
+		Message: encoded,
+	}
+	if remove {
+		payload.Type = MSG_UNREACT
+	}
+
+	err = cs.deliver(peerId, payload)
+	if err != nil {
+		return response.New(result).Status(statusOf(err))
+	}
+
+	err = cs.storeReaction(chat, payload.Sender, emoji, remove)
+	if err != nil {
+		return response.New(result).Status(500)
+	}
+
+	// show the change on the other devices of the user
+	go cs.syncDevices(peerId, payload)
+
+	result, _ = cs.toMessage(chat, nil)
+
+	results := []ChatMessage{result}
+	err = cs.fillReactions(results)
+	if err != nil {
+		return response.New(result).Status(500)
+	}
+
+	return response.New(results[0])
+}
+
+// Delete expired messages together with their revisions and reactions
+func (cs *ChatService) reap() {
+	var expired []ChatModel
+
+	err := cs.db.Find(&expired, "expires_at IS NOT NULL AND expires_at <= ?", time.Now()).Error
+	if err != nil {
+		log.Println("failed to look up expired messages:", err)
+		return
+	}
+
+	peers := make(map[string]bool)
+	defer func() {
+		for peerId := range peers {
+			cs.recount(peerId)
+		}
+	}()
+
+	for _, chat := range expired {
+		err = cs.db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Delete(&ChatRevisionModel{}, "chat_id = ?", chat.ID).Error
+			if err != nil {
+				return err
+			}
+
+			err = tx.Delete(&ReactionModel{}, "chat_id = ?", chat.ID).Error
+			if err != nil {
+				return err
+			}
+
+			return tx.Delete(&ChatModel{}, chat.ID).Error
+		})
+		if err != nil {
+			log.Println("failed to delete expired message:", err)
+			continue
+		}
+
+		peers[chat.PeerID] = true
+		message, _ := cs.toMessage(chat, nil)
+
+		// notify frontend subscriber for expired message event
+		runtime.EventsEmit(cs.ctx, "msg:expired", message)
+	}
+}
+
+func (cs *ChatService) ReapMessages() {
+	ticker := time.NewTicker(REAP_PERIOD)
+	defer ticker.Stop()
+
+	cs.reap()
+
+	for {
+		select {
+		case <-ticker.C:
+			cs.reap()
+		case <-cs.ctx.Done():
+			return
+		}
+	}
+}
+
+func (cs *ChatService) receiveDelete(input SendMessageSchema, decrypted []byte) error {
+	var chat ChatModel
+
+	// the ref travels in the clear, only its encrypted copy proves the sender holds the shared key
+	if string(decrypted) != input.Ref {
+		return errors.New("invalid delete")
+	}
+
+	err := cs.db.First(&chat, "peer_id = ? AND message_id = ? AND sender = ?", input.Sender, input.Ref, input.Sender).Error
+	if err != nil {
+		return errors.New("message not found")
+	}
+
+	if time.Since(chat.CreatedAt) > DELETE_WINDOW+WINDOW_GRACE {
+		return errors.New("delete window expired")
+	}
+
+	err = cs.applyDelete(&chat)
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	cs.recount(input.Sender)
+
+	message, _ := cs.toMessage(chat, nil)
+
+	// notify frontend subscriber for deleted message event
+	runtime.EventsEmit(cs.ctx, "msg:delete", message)
+
+	return nil
+}
+
+func (cs *ChatService) receiveEdit(input SendMessageSchema, decrypted []byte) error {
+	var chat ChatModel
+
+	err := cs.db.First(&chat, "peer_id = ? AND message_id = ? AND sender = ? AND deleted = ?", input.Sender, input.Ref, input.Sender, false).Error
+	if err != nil {
+		return errors.New("message not found")
+	}
+
+	if time.Since(chat.CreatedAt) > EDIT_WINDOW+WINDOW_GRACE {
+		return errors.New("edit window expired")
+	}
+
+	sealed, err := cs.seal(input.Sender, decrypted)
+	if err != nil {
+		return err
+	}
+
+	err = cs.applyEdit(&chat, sealed)
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	message, _ := cs.toMessage(chat, nil)
+	message.Message = string(decrypted)
+
+	messages := []ChatMessage{message}
+	cs.fillQuotes(input.Sender, messages, nil)
+
+	// notify frontend subscriber for edited message event
+	runtime.EventsEmit(cs.ctx, "msg:edit", messages[0])
+
+	return nil
+}
+
+// Deliver envelope received from the mesh, relaying it if addressed to someone else
+func (cs *ChatService) ReceiveEnvelope(input mesh.PacketSchema) error {
+	var payload SendMessageSchema
+
+	// the hop key is needed to open the packet, keep it until the session is unlocked
+	if cs.keyring.Locked() {
+		return cs.queue(QUEUED_ENVELOPE, input.Sender, input)
+	}
+
+	env, err := cs.meshService.Receive(input)
+	if err != nil {
+		return err
+	}
+
+	// envelope was relayed or already seen
+	if env == nil {
+		return nil
+	}
+
+	err = sonic.Unmarshal(env.Data, &payload)
+	if err != nil {
+		return errors.New("invalid envelope")
+	}
+
+	payload.Sender = env.Origin
+
+	return cs.CreateChat(payload)
+}
+
+func (cs *ChatService) receiveReaction(input SendMessageSchema, decrypted []byte) error {
+	var chat ChatModel
+
+	emoji := string(decrypted)
+	length := utf8.RuneCountInString(emoji)
+	if length == 0 || length > MAX_REACTION_LENGTH {
+		return errors.New("invalid reaction")
+	}
+
+	err := cs.db.First(&chat, "peer_id = ? AND message_id = ? AND deleted = ?", input.Sender, input.Ref, false).Error
+	if err != nil {
+		return errors.New("message not found")
+	}
+
+	removed := input.Type == MSG_UNREACT
+
+	err = cs.storeReaction(chat, input.Sender, emoji, removed)
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	messages := []ChatMessage{{ID: chat.ID}}
+	cs.fillReactions(messages)
+
+	// notify frontend subscriber for reaction event
+	runtime.EventsEmit(cs.ctx, "msg:reaction", ReactionEvent{
+		PeerID:    input.Sender,
+		MessageID: chat.MessageID,
+		Sender:    input.Sender,
+		Emoji:     emoji,
+		Removed:   removed,
+		Reactions: messages[0].Reactions,
+	})
+
+	return nil
+}
+
+func (cs *ChatService) ReceiveSignal(input SignalSchema) error {
+	var data SignalData
+
+	if !cs.recvLimiter.Allow(input.Sender) {
+		return errors.New("rate limit exceeded")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(input.Payload)
+	if err != nil {
+		return errors.New("invalid signal")
+	}
+
+	// keys retired by a rotation still open packets sent before it
+	decrypted, err := cs.keyring.Decrypt(input.Sender, decoded)
+	if err != nil {
+		if err.Error() != "failed to decrypt" {
+			return errors.New("unknown peer")
+		}
+
+		return errors.New("invalid signal")
+	}
+
+	err = sonic.Unmarshal(decrypted, &data)
+	if err != nil {
+		return errors.New("invalid signal")
+	}
+
+	// late or replayed signals would outlive their meaning
+	age := time.Since(time.UnixMilli(data.SentAt))
+	if age > SIGNAL_TTL || age < -SIGNAL_TTL {
+		return nil
+	}
+
+	switch data.Type {
+	case SIGNAL_TYPING, SIGNAL_VIEWING:
+		cs.setSignal(input.Sender, data.Type)
+	case SIGNAL_STOPPED:
+		cs.clearSignal(input.Sender, SIGNAL_TYPING)
+	default:
+		return errors.New("invalid signal")
+	}
+
+	return nil
+}
+
+// Apply a message the user sent to a contact from another of their devices
+func (cs *ChatService) ReceiveSync(input SyncSchema) error {
+	var data SyncData
+	var decodedMsg, decryptedMsg []byte
+
+	// only other devices of the user hold the sync key
+	userId := cs.s.GetString("user:id")
+	if userId == "" || input.Sender != userId {
+		return errors.New("unknown peer")
+	}
+
+	// keep the message encrypted until the session is unlocked
+	if cs.keyring.Locked() {
+		return cs.queue(QUEUED_SYNC, input.Sender, input)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(input.Payload)
+	if err != nil {
+		return errors.New("invalid sync")
+	}
+
+	syncKey, err := cs.keyring.SyncKey()
+	if err != nil {
+		return err
+	}
+	defer clear(syncKey)
+
+	decrypted, err := encryption.AESDecrypt(syncKey, decoded)
+	if err != nil {
+		return errors.New("invalid sync")
+	}
+
+	err = sonic.Unmarshal(decrypted, &data)
+	if err != nil {
+		return errors.New("invalid sync")
+	}
+
+	message := data.Message
+
+	decodedMsg, err = base64.StdEncoding.DecodeString(message.Message)
+	if err != nil {
+		return errors.New("failed to decode message")
+	}
+
+	// content is encrypted for the contact, whose shared key this device holds too
+	decryptedMsg, err = cs.keyring.Decrypt(data.PeerID, decodedMsg)
+	if err != nil {
+		if err.Error() != "failed to decrypt" {
+			return errors.New("unknown peer")
+		}
+
+		return errors.New("failed to decrypt message")
+	}
+
+	switch message.Type {
+	case "", MSG_TEXT:
+		return cs.syncText(data.PeerID, message, decryptedMsg)
+	case MSG_EDIT:
+		var chat ChatModel
+
+		err = cs.db.First(&chat, "peer_id = ? AND message_id = ? AND sender = ? AND deleted = ?", data.PeerID, message.Ref, userId, false).Error
+		if err != nil {
+			return errors.New("message not found")
+		}
+
+		sealed, err := cs.seal(data.PeerID, decryptedMsg)
+		if err != nil {
+			return err
+		}
+
+		err = cs.applyEdit(&chat, sealed)
+		if err != nil {
+			return errors.New("db error")
+		}
+
+		result, _ := cs.toMessage(chat, nil)
+		result.Message = string(decryptedMsg)
+
+		messages := []ChatMessage{result}
+		cs.fillQuotes(data.PeerID, messages, nil)
+
+		// notify frontend subscriber for edited message event
+		runtime.EventsEmit(cs.ctx, "msg:edit", messages[0])
+	case MSG_DELETE:
+		var chat ChatModel
+
+		if string(decryptedMsg) != message.Ref {
+			return errors.New("invalid delete")
+		}
+
+		err = cs.db.First(&chat, "peer_id = ? AND message_id = ? AND sender = ?", data.PeerID, message.Ref, userId).Error
+		if err != nil {
+			return errors.New("message not found")
+		}
+
+		err = cs.applyDelete(&chat)
+		if err != nil {
+			return errors.New("db error")
+		}
+
+		result, _ := cs.toMessage(chat, nil)
+
+		// notify frontend subscriber for deleted message event
+		runtime.EventsEmit(cs.ctx, "msg:delete", result)
+	case MSG_REACT, MSG_UNREACT:
+		var chat ChatModel
+
+		emoji := string(decryptedMsg)
+		length := utf8.RuneCountInString(emoji)
+		if length == 0 || length > MAX_REACTION_LENGTH {
+			return errors.New("invalid reaction")
+		}
+
+		err = cs.db.First(&chat, "peer_id = ? AND message_id = ? AND deleted = ?", data.PeerID, message.Ref, false).Error
+		if err != nil {
+			return errors.New("message not found")
+		}
+
+		removed := message.Type == MSG_UNREACT
+
+		err = cs.storeReaction(chat, userId, emoji, removed)
+		if err != nil {
+			return errors.New("db error")
+		}
+
+		messages := []ChatMessage{{ID: chat.ID}}
+		cs.fillReactions(messages)
+
+		// notify frontend subscriber for reaction event
+		runtime.EventsEmit(cs.ctx, "msg:reaction", ReactionEvent{
+			PeerID:    data.PeerID,
+			MessageID: chat.MessageID,
+			Sender:    userId,
+			Emoji:     emoji,
+			Removed:   removed,
+			Reactions: messages[0].Reactions,
+		})
+	case MSG_TIMER:
+		seconds, err := strconv.ParseInt(string(decryptedMsg), 10, 64)
+		if err != nil || !validTimer(seconds) {
+			return errors.New("invalid timer")
+		}
+
+		err = cs.db.Model(&user.ContactModel{}).Where("ID = ?", data.PeerID).Update("disappear_after", seconds).Error
+		if err != nil {
+			return errors.New("db error")
+		}
+
+		// notify frontend subscriber for timer change event
+		runtime.EventsEmit(cs.ctx, "chat:timer", TimerEvent{PeerID: data.PeerID, DisappearAfter: seconds})
+	default:
+		return errors.New("unsupported message type")
+	}
+
+	return nil
+}
+
+func (cs *ChatService) receiveTimer(input SendMessageSchema, decrypted []byte) error {
+	seconds, err := strconv.ParseInt(string(decrypted), 10, 64)
+	if err != nil || !validTimer(seconds) {
+		return errors.New("invalid timer")
+	}
+
+	err = cs.db.Model(&user.ContactModel{}).Where("ID = ?", input.Sender).Update("disappear_after", seconds).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	// notify frontend subscriber for timer change event
+	runtime.EventsEmit(cs.ctx, "chat:timer", TimerEvent{PeerID: input.Sender, DisappearAfter: seconds})
+
+	return nil
+}
+
+func (cs *ChatService) receiveText(input SendMessageSchema, decrypted []byte) error {
+	// older clients do not assign message ids
+	messageId := input.ID
+	if messageId == "" {
+		messageId = ulid.Make().String()
+	}
+
+	// ignore duplicates delivered both directly and through the mesh
+	var count int64
+	cs.db.Model(&ChatModel{}).Where("peer_id = ? AND message_id = ?", input.Sender, messageId).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	// stored sealed with the current key rather than in the wire format
+	sealed, err := cs.seal(input.Sender, decrypted)
+	if err != nil {
+		return err
+	}
+
+	// store message to db
+	newMsg := ChatModel{
+		ID:        ulid.Now(),
+		MessageID: messageId,
+		PeerID:    input.Sender,
+		Sender:    input.Sender,
+		Message:   sealed,
+		ReplyTo:   input.ReplyTo,
+	}
+
+	// the sender's timer applies, counted from delivery
+	if input.ExpiresIn > 0 && validTimer(input.ExpiresIn) {
+		expiresAt := time.Now().Add(time.Duration(input.ExpiresIn) * time.Second)
+		newMsg.ExpiresAt = &expiresAt
+	}
+
+	err = cs.db.Create(&newMsg).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	message, _ := cs.toMessage(newMsg, nil)
+	message.Message = string(decrypted)
+
+	messages := []ChatMessage{message}
+	cs.fillQuotes(input.Sender, messages, nil)
+
+	// the message the peer was typing has arrived
+	cs.clearSignal(input.Sender, SIGNAL_TYPING)
+
+	cs.countUnread(input.Sender)
+
+	// notify frontend subscriber for new message event
+	runtime.EventsEmit(cs.ctx, "msg:new", messages[0])
+
+	// raise a notification unless the conversation is muted or we are in do-not-disturb
+	if !cs.isMuted(input.Sender) && cs.s.GetString("user:presence") != discovery.PRESENCE_DND {
+		runtime.EventsEmit(cs.ctx, "msg:notify", messages[0])
+	}
+
+	return nil
+}
+
+// Remove own reaction from a message
+func (cs *ChatService) RemoveReaction(peerId, messageId, emoji string) response.Response[ChatMessage] {
+	return cs.react(peerId, messageId, emoji, true)
+}
+
+// Process packets queued while the session was locked in the order they arrived
+func (cs *ChatService) replayQueued() {
+	var packets []QueuedPacketModel
+
+	// unlocks run their callbacks concurrently, a second replay waits and only sees what is left
+	cs.replaying.Lock()
+	defer cs.replaying.Unlock()
+
+	err := cs.db.Order("id").Find(&packets).Error
+	if err != nil {
+		log.Println("failed to load queued packets:", err)
+		return
+	}
+
+	for _, packet := range packets {
+		// locked again while replaying, the rest waits for the next unlock
+		if cs.keyring.Locked() {
+			return
+		}
+
+		// claimed before applying, a packet locked out again is queued anew by its handler
+		res := cs.db.Delete(&packet)
+		if res.Error != nil || res.RowsAffected == 0 {
+			continue
+		}
+
+		switch packet.Kind {
+		case QUEUED_MESSAGE:
+			var input SendMessageSchema
+			if err = sonic.Unmarshal(packet.Data, &input); err == nil {
+				err = cs.CreateChat(input)
+			}
+		case QUEUED_ENVELOPE:
+			var input mesh.PacketSchema
+			if err = sonic.Unmarshal(packet.Data, &input); err == nil {
+				err = cs.ReceiveEnvelope(input)
+			}
+		case QUEUED_SYNC:
+			var input SyncSchema
+			if err = sonic.Unmarshal(packet.Data, &input); err == nil {
+				err = cs.ReceiveSync(input)
+			}
+		}
+
+		if err != nil {
+			log.Println("failed to replay queued packet:", err)
+		}
+	}
+}
+
+// Require a feature from online peers, offline peers are reached through the mesh
+// which is only spoken by clients that already support it
+func (cs *ChatService) requireFeature(peerId, feature string) error {
+	if peer := cs.discoveryService.GetPeer(peerId); peer.IP == "" {
+		return nil
+	}
+
+	// unreachable peers are treated like offline ones
+	err := cs.protocolService.Require(peerId, feature)
+	if err != nil && err.Error() == "peer is unreachable" {
+		return nil
+	}
+
+	return err
+}
+
+// Seal content of a conversation for storage with the current shared key
+func (cs *ChatService) seal(peerId string, content []byte) ([]byte, error) {
+	keys, err := cs.keyring.SharedKeys(peerId)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := keys.Seal(content)
+	if err != nil {
+		return nil, errors.New("failed to encrypt message")
+	}
+
+	return sealed, nil
+}
+
+func (cs *ChatService) SendMessage(contact user.ContactModel, input SendMessageSchema) response.Response[ChatMessage] {
+	var message ChatMessage
+
+	cs.presenceService.ReportActivity()
+
+	// older clients would show a reply without what it answers
+	if input.ReplyTo != "" {
+		err := cs.requireFeature(contact.ID, protocol.FEATURE_REPLY)
+		if err != nil {
+			return response.New(message).Status(statusOf(err))
+		}
+	}
+
+	encrypted, encoded, err := cs.encrypt(contact.ID, input.Message)
+	if err != nil {
+		return response.New(message).Status(500)
+	}
+
+	payload := SendMessageSchema{
+		ID:        ulid.Make().String(),
+		Sender:    cs.s.GetString("user:id"),
+		Type:      MSG_TEXT,
+		ReplyTo:   input.ReplyTo,
+		Message:   encoded,
+		ExpiresIn: cs.disappearAfter(contact.ID),
+	}
+
+	err = cs.deliver(contact.ID, payload)
+	if err != nil {
+		return response.New(message).Status(statusOf(err))
+	}
+
+	// store message to db
+	newMsg := ChatModel{
+		ID:        ulid.Now(),
+		MessageID: payload.ID,
+		PeerID:    contact.ID,
+		Sender:    payload.Sender,
+		Message:   encrypted,
+		ReplyTo:   payload.ReplyTo,
+	}
+
+	if payload.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(payload.ExpiresIn) * time.Second)
+		newMsg.ExpiresAt = &expiresAt
+	}
+
+	err = cs.db.Create(&newMsg).Error
+	if err != nil {
+		return response.New(message).Status(500)
+	}
+
+	// show the change on the other devices of the user
+	go cs.syncDevices(contact.ID, payload)
+
+	message, _ = cs.toMessage(newMsg, nil)
+	message.Message = input.Message
+
+	messages := []ChatMessage{message}
+	cs.fillQuotes(contact.ID, messages, nil)
+
+	return response.New(messages[0])
 }
 
-func (cs *ChatService) CreateChat(input SendMessageSchema) error {
-	var contact user.ContactModel
+// Add or remove a reaction row, both are idempotent so repeated deliveries are harmless
+func (cs *ChatService) storeReaction(chat ChatModel, sender, emoji string, remove bool) error {
+	digest, err := cs.keyring.Digest([]byte(emoji))
+	if err != nil {
+		return err
+	}
+
+	// rows from before sealing still match by the plain emoji
+	if remove {
+		return cs.db.Delete(&ReactionModel{}, "chat_id = ? AND sender = ? AND (digest = ? OR emoji = ?)", chat.ID, sender, digest, emoji).Error
+	}
+
+	var legacy int64
+	err = cs.db.Model(&ReactionModel{}).Where("chat_id = ? AND sender = ? AND emoji = ?", chat.ID, sender, emoji).Count(&legacy).Error
+	if err != nil || legacy > 0 {
+		return err
+	}
 
-	err := cs.db.First(&contact, "ID = ?", input.Sender).Error
+	keys, err := cs.keyring.SharedKeys(chat.PeerID)
 	if err != nil {
-		return errors.New("shared key not found")
+		return err
 	}
 
-	if cs.s.Get("key:shared:"+contact.ID) == nil {
-		if cs.s.Get("user:password") == nil {
-			return errors.New("user password not found")
-		}
+	sealed, err := keys.Seal([]byte(emoji))
+	if err != nil {
+		return err
+	}
 
-		contact.SharedKey, err = encryption.PasswordDecrypt([]byte(cs.s.GetString("user:password")), contact.SharedKey)
-		if err != nil {
-			return errors.New("failed to decrypt shared key")
-		}
+	reaction := ReactionModel{
+		ChatID:  chat.ID,
+		Sender:  sender,
+		Digest:  &digest,
+		Content: sealed,
+	}
+
+	return cs.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction).Error
+}
 
-		cs.s.Set("key:shared:"+contact.ID, contact.SharedKey)
+// Pass a packet sent to a contact on to the other devices of the user, they hold the
+// shared key of the contact and apply it as sent from themselves
+func (cs *ChatService) syncDevices(peerId string, payload SendMessageSchema) {
+	userId := cs.s.GetString("user:id")
+	if len(cs.discoveryService.GetDevices(userId)) == 0 {
+		return
 	}
 
-	contact.SharedKey = cs.s.Get("key:shared:" + contact.ID)
+	data, err := sonic.Marshal(SyncData{PeerID: peerId, Message: payload})
+	if err != nil {
+		return
+	}
 
-	decoded, err := base64.StdEncoding.DecodeString(input.Message)
+	syncKey, err := cs.keyring.SyncKey()
 	if err != nil {
-		return errors.New("failed to decode message")
+		log.Println("failed to sync message:", err)
+		return
 	}
+	defer clear(syncKey)
 
-	decrypted, err := encryption.AESDecrypt(contact.SharedKey, decoded)
+	encrypted, err := encryption.AESEncrypt(syncKey, data)
 	if err != nil {
-		return errors.New("failed to decrypt message")
+		log.Println("failed to sync message:", err)
+		return
+	}
+
+	err = cs.sessionService.Send(userId, "chat:sync", SyncSchema{
+		Sender:  userId,
+		Payload: base64.StdEncoding.EncodeToString(encrypted),
+	})
+	if err != nil {
+		log.Println("failed to sync message:", err)
+	}
+}
+
+// Store a message the user sent from another device, it counts as read and raises no notification
+func (cs *ChatService) syncText(peerId string, input SendMessageSchema, decrypted []byte) error {
+	if input.ID == "" {
+		return errors.New("invalid sync")
+	}
+
+	// ignore duplicates of a message synced more than once
+	var count int64
+	cs.db.Model(&ChatModel{}).Where("peer_id = ? AND message_id = ?", peerId, input.ID).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	sealed, err := cs.seal(peerId, decrypted)
+	if err != nil {
+		return err
 	}
 
-	// store message to db
 	newMsg := ChatModel{
-		ID:      ulid.Now(),
-		PeerID:  input.Sender,
-		Sender:  input.Sender,
-		Message: decoded,
+		ID:        ulid.Now(),
+		MessageID: input.ID,
+		PeerID:    peerId,
+		Sender:    input.Sender,
+		Message:   sealed,
+		ReplyTo:   input.ReplyTo,
+	}
+
+	if input.ExpiresIn > 0 && validTimer(input.ExpiresIn) {
+		expiresAt := time.Now().Add(time.Duration(input.ExpiresIn) * time.Second)
+		newMsg.ExpiresAt = &expiresAt
 	}
+
 	err = cs.db.Create(&newMsg).Error
 	if err != nil {
 		return errors.New("db error")
 	}
 
-	message := ChatMessage{
-		ID:        newMsg.ID,
-		PeerID:    newMsg.PeerID,
-		Sender:    input.Sender,
-		Message:   string(decrypted),
-		CreatedAt: newMsg.CreatedAt.Format(time.RFC3339),
-	}
+	message, _ := cs.toMessage(newMsg, nil)
+	message.Message = string(decrypted)
+
+	messages := []ChatMessage{message}
+	cs.fillQuotes(peerId, messages, nil)
 
 	// notify frontend subscriber for new message event
-	runtime.EventsEmit(cs.ctx, "msg:new", message)
+	runtime.EventsEmit(cs.ctx, "msg:new", messages[0])
 
 	return nil
 }
 
-func (cs *ChatService) GetMessages(peerId string, cursor uint64) response.Response[[]ChatMessage] {
-	var messages []ChatModel
-	var results []ChatMessage
+// Seal reactions stored with the emoji in plain text, walking them by ID
+func (cs *ChatService) sealReactions() error {
+	type row struct {
+		ID     uint64
+		Emoji  string
+		PeerID string
+	}
+
+	keys := make(map[string]*user.SharedKeys)
+	cursor := uint64(0)
 
-	// limit the retrieved message to 20
-	limit := 20
+	for {
+		var rows []row
+
+		if cs.keyring.Locked() {
+			return errors.New("session locked")
+		}
 
-	if cursor == 0 {
-		err := cs.db.Find(&messages, "peer_id = ?", peerId).Limit(limit).Error
+		err := cs.db.Table("reaction_models AS r").Select("r.id, r.emoji, c.peer_id").
+			Joins("JOIN chat_models c ON c.id = r.chat_id").
+			Where("r.id > ? AND r.emoji != ''", cursor).
+			Order("r.id").Limit(UPGRADE_BATCH).Scan(&rows).Error
 		if err != nil {
-			return response.New(results).Status(500)
+			return err
 		}
-	} else {
-		err := cs.db.Find(&messages, "peer_id = ? AND id < ?", peerId, cursor).Limit(limit).Error
+
+		if len(rows) == 0 {
+			return nil
+		}
+
+		for _, r := range rows {
+			cursor = r.ID
+
+			sharedKeys, ok := keys[r.PeerID]
+			if !ok {
+				sharedKeys, err = cs.keyring.SharedKeys(r.PeerID)
+				if err != nil {
+					log.Println("failed to seal reactions of", r.PeerID+":", err)
+				}
+				keys[r.PeerID] = sharedKeys
+			}
+
+			// reactions of contacts whose keys cannot be opened wait for a later pass
+			if sharedKeys == nil {
+				continue
+			}
+
+			digest, err := cs.keyring.Digest([]byte(r.Emoji))
+			if err != nil {
+				return err
+			}
+
+			sealed, err := sharedKeys.Seal([]byte(r.Emoji))
+			if err != nil {
+				continue
+			}
+
+			err = cs.db.Model(&ReactionModel{}).Where("id = ? AND emoji = ?", r.ID, r.Emoji).
+				Updates(map[string]any{"digest": digest, "content": sealed, "emoji": ""}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Check whether stored messages, revisions or reactions are still sealed with a key
+func (cs *ChatService) sealedWith(keyId string) (bool, error) {
+	prefix := encryption.SealedPrefix(keyId)
+
+	for table, column := range map[string]string{"chat_models": "message", "chat_revision_models": "message", "reaction_models": "content"} {
+		var count int64
+
+		err := cs.db.Table(table).Where("substr("+column+", 1, ?) = ?", len(prefix), prefix).Limit(1).Count(&count).Error
 		if err != nil {
-			return response.New(results).Status(500)
+			return false, errors.New("db error")
+		}
+
+		if count > 0 {
+			return true, nil
 		}
 	}
 
-	// check if no older messages
-	if len(messages) == 0 {
-		return response.New(results).Status(404)
+	return false, nil
+}
+
+// Send an ephemeral signal to an online peer, repeats within the interval are dropped
+func (cs *ChatService) SendSignal(peerId, signal string) response.Response[bool] {
+	switch signal {
+	case SIGNAL_TYPING, SIGNAL_STOPPED, SIGNAL_VIEWING:
+	default:
+		return response.New(false).Status(400)
 	}
 
-	// retrieve shared key
-	var contact user.ContactModel
+	key := peerId + ":" + signal
 
-	err := cs.db.First(&contact, "ID = ?", peerId).Error
+	cs.mu.Lock()
+	last, ok := cs.sent[key]
+	if ok && time.Since(last) < SIGNAL_INTERVAL {
+		cs.mu.Unlock()
+		return response.New(true)
+	}
+	cs.sent[key] = time.Now()
+	cs.mu.Unlock()
+
+	if !cs.sendLimiter.Allow(peerId) {
+		return response.New(false).Status(429)
+	}
+
+	err := cs.protocolService.Require(peerId, protocol.FEATURE_SIGNAL)
 	if err != nil {
-		return response.New(results).Status(500)
+		return response.New(false).Status(statusOf(err))
 	}
 
-	if cs.s.Get("key:shared:"+contact.ID) == nil {
-		if cs.s.Get("user:password") == nil {
-			return response.New(results).Status(500)
+	data, err := sonic.Marshal(SignalData{Type: signal, SentAt: time.Now().UnixMilli()})
+	if err != nil {
+		return response.New(false).Status(500)
+	}
+
+	_, encoded, err := cs.encrypt(peerId, string(data))
+	if err != nil {
+		return response.New(false).Status(500)
+	}
+
+	payload := SignalSchema{
+		Sender:  cs.s.GetString("user:id"),
+		Payload: encoded,
+	}
+
+	err = cs.sessionService.Send(peerId, "chat:signal", payload)
+	if err != nil {
+		return response.New(false).Status(statusOf(err))
+	}
+
+	return response.New(true)
+}
+
+// Move a conversation in or out of the archive
+func (cs *ChatService) SetArchived(peerId string, archived bool) response.Response[ConversationSettings] {
+	return cs.updateSettings(peerId, map[string]any{"archived": archived})
+}
+
+// Set the disappearing message timer of a conversation for both sides, zero turns it off
+func (cs *ChatService) SetDisappearingTimer(peerId string, seconds int64) response.Response[int64] {
+	if !validTimer(seconds) {
+		return response.New(seconds).Status(statusOf(errors.New("invalid timer")))
+	}
+
+	err := cs.requireFeature(peerId, protocol.FEATURE_DISAPPEAR)
+	if err != nil {
+		return response.New(seconds).Status(statusOf(err))
+	}
+
+	_, encoded, err := cs.encrypt(peerId, strconv.FormatInt(seconds, 10))
+	if err != nil {
+		return response.New(seconds).Status(500)
+	}
+
+	payload := SendMessageSchema{
+		ID:      ulid.Make().String(),
+		Sender:  cs.s.GetString("user:id"),
+		Type:    MSG_TIMER,
+		Message: encoded,
+	}
+
+	err = cs.deliver(peerId, payload)
+	if err != nil {
+		return response.New(seconds).Status(statusOf(err))
+	}
+
+	err = cs.db.Model(&user.ContactModel{}).Where("ID = ?", peerId).Update("disappear_after", seconds).Error
+	if err != nil {
+		return response.New(seconds).Status(500)
+	}
+
+	// show the change on the other devices of the user
+	go cs.syncDevices(peerId, payload)
+
+	return response.New(seconds)
+}
+
+// Silence notifications of a conversation, until is an RFC3339 time and empty mutes indefinitely
+func (cs *ChatService) SetMuted(peerId string, muted bool, until string) response.Response[ConversationSettings] {
+	var mutedUntil *time.Time
+
+	if muted && until != "" {
+		parsed, err := time.Parse(time.RFC3339, until)
+		if err != nil || parsed.Before(time.Now()) {
+			return response.New(ConversationSettings{PeerID: peerId}).Status(statusOf(errors.New("invalid settings")))
 		}
 
-		contact.SharedKey, err = encryption.PasswordDecrypt([]byte(cs.s.GetString("user:password")), contact.SharedKey)
+		mutedUntil = &parsed
+	}
+
+	return cs.updateSettings(peerId, map[string]any{"muted": muted, "muted_until": mutedUntil})
+}
+
+// Pin a conversation after the already pinned ones, or unpin it
+func (cs *ChatService) SetPinned(peerId string, pinned bool) response.Response[ConversationSettings] {
+	if !pinned {
+		return cs.updateSettings(peerId, map[string]any{"pin_order": 0})
+	}
+
+	settings, err := cs.settings(peerId)
+	if err != nil {
+		return response.New(ConversationSettings{PeerID: peerId}).Status(500)
+	}
+
+	if settings.PinOrder > 0 {
+		return response.New(cs.toSettings(settings))
+	}
+
+	var last int
+	err = cs.db.Model(&ConversationSettingsModel{}).Select("COALESCE(MAX(pin_order), 0)").Scan(&last).Error
+	if err != nil {
+		return response.New(cs.toSettings(settings)).Status(500)
+	}
+
+	return cs.updateSettings(peerId, map[string]any{"pin_order": last + 1})
+}
+
+// Pin conversations in the given order, conversations left out are unpinned
+func (cs *ChatService) SetPinOrder(peerIds []string) response.Response[[]ConversationSettings] {
+	var contacts int64
+
+	results := []ConversationSettings{}
+
+	// every ID must be a contact and appear once
+	unique := make(map[string]bool)
+	for _, peerId := range peerIds {
+		unique[peerId] = true
+	}
+
+	if len(unique) != len(peerIds) {
+		return response.New(results).Status(statusOf(errors.New("invalid settings")))
+	}
+
+	if len(peerIds) > 0 {
+		err := cs.db.Model(&user.ContactModel{}).Where("ID IN ?", peerIds).Count(&contacts).Error
 		if err != nil {
 			return response.New(results).Status(500)
 		}
 
-		cs.s.Set("key:shared:"+contact.ID, contact.SharedKey)
+		if int(contacts) != len(peerIds) {
+			return response.New(results).Status(statusOf(errors.New("peer is not found")))
+		}
 	}
 
-	contact.SharedKey = cs.s.Get("key:shared:" + contact.ID)
+	err := cs.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&ConversationSettingsModel{}).Where("pin_order > ?", 0).Update("pin_order", 0).Error
+		if err != nil {
+			return err
+		}
+
+		for i, peerId := range peerIds {
+			settings := ConversationSettingsModel{PeerID: peerId, PinOrder: i + 1}
 
-	// decrypt messages
-	for _, message := range messages {
-		decrypted, err := encryption.AESDecrypt(contact.SharedKey, message.Message)
+			err = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "peer_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"pin_order", "updated_at"}),
+			}).Create(&settings).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return response.New(results).Status(500)
+	}
+
+	for _, peerId := range peerIds {
+		settings, err := cs.settings(peerId)
 		if err != nil {
-			response.New(results).Status(500)
+			return response.New(results).Status(500)
 		}
 
-		results = append(results, ChatMessage{
-			ID:        message.ID,
-			Sender:    message.Sender,
-			Message:   string(decrypted),
-			CreatedAt: message.CreatedAt.Format(time.RFC3339),
-		})
+		results = append(results, cs.toSettings(settings))
 	}
 
 	return response.New(results)
 }
 
-func (cs *ChatService) SendMessage(contact user.ContactModel, input SendMessageSchema) response.Response[ChatMessage] {
-	var message ChatMessage
-	var err error
+// Get settings of a conversation, defaults apply when none were saved
+func (cs *ChatService) settings(peerId string) (ConversationSettingsModel, error) {
+	settings := ConversationSettingsModel{PeerID: peerId}
 
-	peer := cs.discoveryService.GetPeer(contact.ID)
-	if peer.IP == "" {
-		return response.New(message).Status(404)
+	err := cs.db.Limit(1).Find(&settings, "peer_id = ?", peerId).Error
+	if err != nil {
+		return settings, errors.New("db error")
 	}
 
-	// retrieve shared key from memory
-	contact.SharedKey = cs.s.Get("key:shared:" + contact.ID)
-	if contact.SharedKey == nil {
-		// get shared key from db if not exist in memory
-		err = cs.db.First(&contact, "ID = ?", contact.ID).Error
-		if err != nil {
-			return response.New(message).Status(500)
-		}
+	return settings, nil
+}
+
+// Mark a peer signal active, it ends on its own unless refreshed
+func (cs *ChatService) setSignal(peerId, signal string) {
+	key := peerId + ":" + signal
+
+	cs.mu.Lock()
+	timer, ok := cs.signals[key]
+	if ok {
+		timer.Reset(SIGNAL_TTL)
+	} else {
+		cs.signals[key] = time.AfterFunc(SIGNAL_TTL, func() {
+			cs.clearSignal(peerId, signal)
+		})
+	}
+	cs.mu.Unlock()
+
+	if !ok {
+		runtime.EventsEmit(cs.ctx, "peer:typing", PeerSignal{PeerID: peerId, Signal: signal, Active: true})
+	}
+}
+
+func (cs *ChatService) Startup(ctx context.Context) {
+	cs.ctx = ctx
+}
+
+func validTimer(seconds int64) bool {
+	return seconds == 0 || (seconds >= int64(MIN_DISAPPEAR/time.Second) && seconds <= int64(MAX_DISAPPEAR/time.Second))
+}
 
-		if cs.s.Get("user:password") == nil {
-			return response.New(message).Status(500)
+func (cs *ChatService) toSettings(settings ConversationSettingsModel) ConversationSettings {
+	result := ConversationSettings{
+		PeerID:   settings.PeerID,
+		PinOrder: settings.PinOrder,
+		Archived: settings.Archived,
+	}
+
+	// an elapsed mute is reported as unmuted
+	if settings.Muted && (settings.MutedUntil == nil || time.Now().Before(*settings.MutedUntil)) {
+		result.Muted = true
+
+		if settings.MutedUntil != nil {
+			result.MutedUntil = settings.MutedUntil.Format(time.RFC3339)
 		}
+	}
+
+	return result
+}
+
+// Get the unread counter of a conversation
+func (cs *ChatService) unread(peerId string) (int64, error) {
+	var conversation ConversationModel
+
+	err := cs.db.Limit(1).Find(&conversation, "peer_id = ?", peerId).Error
+	if err != nil {
+		return 0, errors.New("db error")
+	}
+
+	return conversation.Unread, nil
+}
+
+// Save changed settings of a conversation, creating its row on first use
+func (cs *ChatService) updateSettings(peerId string, values map[string]any) response.Response[ConversationSettings] {
+	var contact user.ContactModel
+
+	err := cs.db.First(&contact, "ID = ?", peerId).Error
+	if err != nil {
+		return response.New(ConversationSettings{PeerID: peerId}).Status(statusOf(errors.New("peer is not found")))
+	}
 
-		contact.SharedKey, err = encryption.PasswordDecrypt([]byte(cs.s.GetString("user:password")), contact.SharedKey)
+	err = cs.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ConversationSettingsModel{PeerID: peerId}).Error
 		if err != nil {
-			return response.New(message).Status(500)
+			return err
 		}
 
-		cs.s.Set("key:shared:"+contact.ID, contact.SharedKey)
+		return tx.Model(&ConversationSettingsModel{PeerID: peerId}).Updates(values).Error
+	})
+	if err != nil {
+		return response.New(ConversationSettings{PeerID: peerId}).Status(500)
 	}
 
-	encrypted, err := encryption.AESEncrypt(contact.SharedKey, []byte(input.Message))
+	settings, err := cs.settings(peerId)
 	if err != nil {
-		return response.New(message).Status(500)
+		return response.New(ConversationSettings{PeerID: peerId}).Status(500)
 	}
 
-	// encode encrypted message
-	encoded := base64.StdEncoding.EncodeToString(encrypted)
+	return response.New(cs.toSettings(settings))
+}
 
-	message.Sender = cs.s.GetString("user:id")
-	message.Message = encoded
+// Reseal stored content of a table that is not in the current envelope format, walking it by ID
+// so content that cannot be opened is skipped instead of retried
+func (cs *ChatService) upgrade(table, column, peerColumn, join string, skipped map[string]bool) error {
+	type row struct {
+		ID      uint64
+		PeerID  string
+		Message []byte
+	}
 
-	payload, err := sonic.Marshal(message)
-	if err != nil {
-		return response.New(message).Status(500)
+	prefix := encryption.CurrentPrefix()
+	keys := make(map[string]*user.SharedKeys)
+	cursor := uint64(0)
+
+	for {
+		var rows []row
+
+		// the session may lock while upgrading, retired keys must not be pruned after an incomplete pass
+		if cs.keyring.Locked() {
+			return errors.New("session locked")
+		}
+
+		query := cs.db.Table(table + " AS t").Select("t.id, " + peerColumn + " AS peer_id, t." + column + " AS message")
+		if join != "" {
+			query = query.Joins(join)
+		}
+
+		// history of contacts with retired keys is checked row by row for the key it is sealed with
+		err := query.Where("t.id > ? AND length(t."+column+") > 0", cursor).
+			Where("substr(t."+column+", 1, ?) != ? OR "+peerColumn+" IN (SELECT contact_id FROM retired_key_models)", len(prefix), prefix).
+			Order("t.id").Limit(UPGRADE_BATCH).Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		if len(rows) == 0 {
+			return nil
+		}
+
+		for _, r := range rows {
+			cursor = r.ID
+
+			sharedKeys, ok := keys[r.PeerID]
+			if !ok {
+				// one contact whose keys cannot be loaded must not hold up the others
+				sharedKeys, err = cs.keyring.SharedKeys(r.PeerID)
+				if err != nil {
+					log.Println("failed to load shared keys of", r.PeerID+":", err)
+					skipped[r.PeerID] = true
+				}
+				keys[r.PeerID] = sharedKeys
+			}
+
+			if sharedKeys == nil || sharedKeys.Sealed(r.Message) {
+				continue
+			}
+
+			// content no key opens is left alone, keeping the keys would not help it
+			decrypted, err := sharedKeys.Open(r.Message)
+			if err != nil {
+				continue
+			}
+
+			sealed, err := sharedKeys.Seal(decrypted)
+			clear(decrypted)
+			if err != nil {
+				continue
+			}
+
+			// content edited or deleted meanwhile is left alone
+			err = cs.db.Table(table).Where("id = ? AND "+column+" = ?", r.ID, r.Message).Update(column, sealed).Error
+			if err != nil {
+				return err
+			}
+		}
 	}
+}
 
-	url := fmt.Sprintf("http://%s:%d/api/chat/send", peer.IP, discovery.SVC_PORT)
-	res, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
-	if err != nil {
-		return response.New(message).Status(500)
+// Reseal stored messages, revisions and reactions in the current envelope format
+func (cs *ChatService) UpgradeMessages() {
+	ticker := time.NewTicker(UPGRADE_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if cs.s.GetString("user:id") == "" || cs.keyring.Locked() {
+				continue
+			}
+
+			start := time.Now()
+			skipped := make(map[string]bool)
+
+			err := cs.upgrade("chat_models", "message", "t.peer_id", "", skipped)
+			if err != nil {
+				log.Println("failed to upgrade messages:", err)
+				continue
+			}
+
+			err = cs.upgrade("chat_revision_models", "message", "c.peer_id", "JOIN chat_models c ON c.id = t.chat_id", skipped)
+			if err != nil {
+				log.Println("failed to upgrade revisions:", err)
+				continue
+			}
+
+			err = cs.sealReactions()
+			if err != nil {
+				log.Println("failed to seal reactions:", err)
+				continue
+			}
+
+			err = cs.upgrade("reaction_models", "content", "c.peer_id", "JOIN chat_models c ON c.id = t.chat_id", skipped)
+			if err != nil {
+				log.Println("failed to upgrade reactions:", err)
+				continue
+			}
+
+			// keys retired before the pass are only kept for history that is still sealed with them,
+			// or of contacts skipped above whose history was not looked at
+			err = cs.keyring.PruneKeys(start, func(contactId, keyId string) (bool, error) {
+				if skipped[contactId] {
+					return true, nil
+				}
+
+				return cs.sealedWith(keyId)
+			})
+			if err != nil {
+				log.Println("failed to prune keys:", err)
+			}
+		case <-cs.ctx.Done():
+			return
+		}
 	}
+}
 
-	if res.StatusCode != http.StatusOK {
-		return response.New(message).Status(500)
+// Query messages of a conversation that have not expired yet
+func (cs *ChatService) visible(peerId string) *gorm.DB {
+	return cs.db.Model(&ChatModel{}).Where("peer_id = ? AND (expires_at IS NULL OR expires_at > ?)", peerId, time.Now())
+}
+
+// Convert stored message, content is only decrypted if shared keys are given
+func (cs *ChatService) toMessage(chat ChatModel, keys *user.SharedKeys) (ChatMessage, error) {
+	message := ChatMessage{
+		ID:        chat.ID,
+		MessageID: chat.MessageID,
+		Sender:    chat.Sender,
+		PeerID:    chat.PeerID,
+		Edited:    chat.EditedAt != nil,
+		Deleted:   chat.Deleted,
+		CreatedAt: chat.CreatedAt.Format(time.RFC3339),
 	}
 
-	// store message to db
-	newMsg := ChatModel{
-		ID:      ulid.Now(),
-		PeerID:  contact.ID,
-		Sender:  message.Sender,
-		Message: encrypted,
+	if chat.ExpiresAt != nil {
+		message.ExpiresAt = chat.ExpiresAt.Format(time.RFC3339)
 	}
-	err = cs.db.Create(&newMsg).Error
+
+	if chat.ReplyTo != "" {
+		message.ReplyTo = &QuotedMessage{MessageID: chat.ReplyTo}
+	}
+
+	if keys == nil || chat.Deleted {
+		return message, nil
+	}
+
+	decrypted, err := keys.Open(chat.Message)
 	if err != nil {
-		return response.New(message).Status(500)
+		return message, errors.New("failed to decrypt message")
 	}
 
-	message.ID = newMsg.ID
-	message.Message = input.Message
-	message.CreatedAt = newMsg.CreatedAt.Format(time.RFC3339)
-	return response.New(message)
-}
+	message.Message = string(decrypted)
 
-func (cs *ChatService) Startup(ctx context.Context) {
-	cs.ctx = ctx
+	return message, nil
 }
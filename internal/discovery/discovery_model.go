@@ -1,7 +1,44 @@
 package discovery
 
+import "time"
+
+// Presence states, peers that do not announce one are treated as available
+const (
+	PRESENCE_AVAILABLE = "available"
+	PRESENCE_AWAY      = "away"
+	PRESENCE_BUSY      = "busy"
+	PRESENCE_DND       = "dnd"
+)
+
 type PeerModel struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
 	IP       string `json:"ip"`
+	Presence string `json:"presence"`
+
+	// device announcing the peer, empty for clients from before linking
+	Device string `json:"device,omitempty"`
+}
+
+// Emitted with peer:presence when a peer changes its presence
+type PresenceEvent struct {
+	PeerID   string `json:"peer_id"`
+	Presence string `json:"presence"`
+}
+
+func ValidPresence(presence string) bool {
+	switch presence {
+	case PRESENCE_AVAILABLE, PRESENCE_AWAY, PRESENCE_BUSY, PRESENCE_DND:
+		return true
+	default:
+		return false
+	}
+}
+
+// Route to a peer that is not directly reachable, learned from contact gossip
+type RouteModel struct {
+	ID        string    `json:"id"`
+	Via       string    `json:"via,omitempty"`
+	Hops      int       `json:"hops"`
+	UpdatedAt time.Time `json:"-"`
 }
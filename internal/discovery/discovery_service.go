@@ -4,53 +4,205 @@ import (
 	"chat-client/pkg/response"
 	"chat-client/pkg/store"
 	"context"
+	"encoding/base64"
 	"log"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/grandcat/zeroconf"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 const (
 	SVC_NAME   = "_p2pchat._tcp"
 	SVC_DOMAIN = "local."
 	SVC_PORT   = 60606
+
+	// gossiped routes are dropped if not refreshed in time
+	ROUTE_TTL = time.Second * 90
 )
 
+// SignFunc signs the records of the own broadcast with the identity key
+type SignFunc func(payload []byte) ([]byte, error)
+
+// VerifyFunc checks the signature on the records of a resolved peer
+type VerifyFunc func(peerId string, payload, signature []byte) error
+
 type DiscoveryService struct {
-	ctx   context.Context
-	s     *store.Store
-	peers map[string]*PeerModel
-	mu    sync.Mutex
+	ctx     context.Context
+	s       *store.Store
+	peers   map[string]*PeerModel
+	devices map[string]*PeerModel
+	routes  map[string]map[string]*RouteModel
+	server  *zeroconf.Server
+	txt     []string
+	sign    SignFunc
+	verify  VerifyFunc
+	mu      sync.Mutex
 }
 
 type IDiscoveryService interface {
 	BroadcastService(username string)
+	FindPeer(peerId string) PeerModel
+	GetDevices(peerId string) []PeerModel
 	GetPeer(peerId string) PeerModel
 	GetPeers() response.Response[[]PeerModel]
+	GetReachable() []RouteModel
+	GetRoutes(peerId string) []RouteModel
 	getTxt(entry *zeroconf.ServiceEntry, key string) string
-	QueryService()
+	QueryService(ctx context.Context)
 	RefreshQuery()
+	Reset()
+	resolve(entry *zeroconf.ServiceEntry, username string)
+	setDevice(instance string, device PeerModel)
+	setPeer(instance string, peer PeerModel)
+	SetPeerPresence(peerId, presence string)
+	SetPresence(presence string)
+	SetRoutes(via string, routes []RouteModel)
+	SignRecords(sign SignFunc, verify VerifyFunc)
 	Startup(ctx context.Context)
+	verified(entry *zeroconf.ServiceEntry, peerId, peerName string) bool
 }
 
 func NewDiscoveryService(s *store.Store) *DiscoveryService {
 	peers := make(map[string]*PeerModel)
+	devices := make(map[string]*PeerModel)
+	routes := make(map[string]map[string]*RouteModel)
 
-	return &DiscoveryService{s: s, peers: peers}
+	return &DiscoveryService{s: s, peers: peers, devices: devices, routes: routes}
 }
 
-func (ds *DiscoveryService) BroadcastService(id, username string) {
+// Records covered by the broadcast signature. Presence changes while the session
+// may be locked, so it is left out and only trusted as a hint. The device ID only
+// picks which address of the user is dialed, sessions authenticate the device itself
+func recordPayload(id, username string) []byte {
+	return []byte("discovery\x00" + id + "\x00" + username)
+}
+
+// Announce the service until the context of the login ends
+func (ds *DiscoveryService) BroadcastService(ctx context.Context, id, username string) {
+	presence := ds.s.GetString("user:presence")
+	if presence == "" {
+		presence = PRESENCE_AVAILABLE
+	}
+
+	ds.mu.Lock()
+	sign := ds.sign
+	ds.mu.Unlock()
+
+	// every device of the user announces the same identity under its own instance
+	instance := id
+	device := ds.s.GetString("user:device")
+	if device != "" {
+		instance = id + "-" + device
+	}
+
 	txt := []string{"ID=" + id, "USERNAME=" + username}
-	server, err := zeroconf.Register(id, SVC_NAME, SVC_DOMAIN, SVC_PORT, txt, nil)
+	if device != "" {
+		txt = append(txt, "DEVICE="+device)
+	}
+
+	if sign != nil {
+		signature, err := sign(recordPayload(id, username))
+		if err != nil {
+			log.Println("Failed to sign service records:", err)
+		} else {
+			txt = append(txt, "SIG="+base64.StdEncoding.EncodeToString(signature))
+		}
+	}
+
+	server, err := zeroconf.Register(instance, SVC_NAME, SVC_DOMAIN, SVC_PORT, append(txt, "PRESENCE="+presence), nil)
 	if err != nil {
 		log.Println(err)
+		return
 	}
 	defer server.Shutdown()
 
-	<-ds.ctx.Done()
+	ds.mu.Lock()
+	ds.server = server
+	ds.txt = txt
+	ds.mu.Unlock()
+
+	<-ctx.Done()
 	log.Println("Shutting down service broadcast...")
+
+	ds.mu.Lock()
+	ds.server = nil
+	ds.txt = nil
+	ds.mu.Unlock()
+}
+
+// Look up a peer once without a login, used by a new device to find the one it links to.
+// The record is not verified, the link exchange authenticates both ends
+func (ds *DiscoveryService) FindPeer(peerId string) PeerModel {
+	var result PeerModel
+
+	resolver, err := zeroconf.NewResolver(nil)
+	if err != nil {
+		log.Println("Failed to initialize resolver:", err)
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ds.ctx, time.Second*5)
+	defer cancel()
+
+	entries := make(chan *zeroconf.ServiceEntry)
+	found := make(chan PeerModel, 1)
+
+	go func() {
+		for entry := range entries {
+			if len(entry.AddrIPv4) == 0 || ds.getTxt(entry, "ID") != peerId {
+				continue
+			}
+
+			select {
+			case found <- PeerModel{
+				ID:       peerId,
+				Username: ds.getTxt(entry, "USERNAME"),
+				IP:       entry.AddrIPv4[0].String(),
+				Device:   ds.getTxt(entry, "DEVICE"),
+			}:
+				cancel()
+			default:
+			}
+		}
+	}()
+
+	err = resolver.Browse(ctx, SVC_NAME, SVC_DOMAIN, entries)
+	if err != nil {
+		log.Println("Failed to start browse:", err.Error())
+		return result
+	}
+
+	select {
+	case result = <-found:
+	case <-ctx.Done():
+	}
+
+	return result
+}
+
+// Get every device a peer announces, the own user ID lists the other devices of the user
+func (ds *DiscoveryService) GetDevices(peerId string) []PeerModel {
+	var result []PeerModel
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	peers := ds.peers
+	if peerId == ds.s.GetString("user:id") {
+		peers = ds.devices
+	}
+
+	for _, peer := range peers {
+		if peer != nil && peer.ID == peerId {
+			result = append(result, *peer)
+		}
+	}
+
+	return result
 }
 
 func (ds *DiscoveryService) GetPeer(peerId string) PeerModel {
@@ -69,8 +221,16 @@ func (ds *DiscoveryService) GetPeer(peerId string) PeerModel {
 func (ds *DiscoveryService) GetPeers() response.Response[[]PeerModel] {
 	var result []PeerModel
 
+	// peers running on several devices are listed once
+	seen := make(map[string]bool)
+
 	ds.mu.Lock()
 	for _, peer := range ds.peers {
+		if seen[peer.ID] {
+			continue
+		}
+
+		seen[peer.ID] = true
 		result = append(result, *peer)
 	}
 	ds.mu.Unlock()
@@ -78,21 +238,69 @@ func (ds *DiscoveryService) GetPeers() response.Response[[]PeerModel] {
 	return response.New(result)
 }
 
+// Get the best known route for every reachable destination
+func (ds *DiscoveryService) GetReachable() []RouteModel {
+	var result []RouteModel
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	for _, vias := range ds.routes {
+		var best *RouteModel
+		for _, route := range vias {
+			if time.Since(route.UpdatedAt) > ROUTE_TTL {
+				continue
+			}
+
+			if best == nil || route.Hops < best.Hops {
+				best = route
+			}
+		}
+
+		if best != nil {
+			result = append(result, *best)
+		}
+	}
+
+	return result
+}
+
+// Get fresh routes to a peer, ordered by hop count
+func (ds *DiscoveryService) GetRoutes(peerId string) []RouteModel {
+	var result []RouteModel
+
+	ds.mu.Lock()
+	for _, route := range ds.routes[peerId] {
+		if time.Since(route.UpdatedAt) > ROUTE_TTL {
+			continue
+		}
+
+		result = append(result, *route)
+	}
+	ds.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Hops < result[j].Hops
+	})
+
+	return result
+}
+
 func (ds *DiscoveryService) getTxt(entry *zeroconf.ServiceEntry, key string) string {
 	fields := entry.Text
 	for _, field := range fields {
-		info := strings.Split(field, "=")
-		if len(info) == 2 {
-			if info[0] == key {
-				return info[1]
-			}
+		// values such as base64 signatures may contain the separator
+		name, value, ok := strings.Cut(field, "=")
+		if ok && name == key {
+			return value
 		}
 	}
 
 	return ""
 }
 
-func (ds *DiscoveryService) QueryService() {
+// Watch for peers until the context of the login ends
+func (ds *DiscoveryService) QueryService(ctx context.Context) {
 	resolver, err := zeroconf.NewResolver(nil)
 	if err != nil {
 		log.Println("Failed to initialize resolver:", err)
@@ -114,31 +322,15 @@ func (ds *DiscoveryService) QueryService() {
 					continue
 				}
 
-				peerId := ds.getTxt(entry, "ID")
-				peerName := ds.getTxt(entry, "USERNAME")
-
-				if peerName == username {
-					continue
-				}
-
-				if peerId != "" && peerName != "" {
-					ip := entry.AddrIPv4[0].String()
-					ds.mu.Lock()
-					ds.peers[entry.Instance] = &PeerModel{
-						ID:       peerId,
-						Username: peerName,
-						IP:       ip,
-					}
-					ds.mu.Unlock()
-				}
-			case <-ds.ctx.Done():
+				ds.resolve(entry, username)
+			case <-ctx.Done():
 				log.Println("Shutting down mDNS watcher...")
 				return
 			}
 		}
 	}()
 
-	err = resolver.Browse(ds.ctx, SVC_NAME, SVC_DOMAIN, entries)
+	err = resolver.Browse(ctx, SVC_NAME, SVC_DOMAIN, entries)
 	if err != nil {
 		log.Println("Failed to start browse:", err.Error())
 	}
@@ -164,23 +356,7 @@ func (ds *DiscoveryService) RefreshQuery() {
 				continue
 			}
 
-			peerId := ds.getTxt(entry, "ID")
-			peerName := ds.getTxt(entry, "USERNAME")
-
-			if peerName == username {
-				continue
-			}
-
-			if peerId != "" && peerName != "" {
-				ip := entry.AddrIPv4[0].String()
-				ds.mu.Lock()
-				ds.peers[entry.Instance] = &PeerModel{
-					ID:       peerId,
-					Username: peerName,
-					IP:       ip,
-				}
-				ds.mu.Unlock()
-			}
+			ds.resolve(entry, username)
 		}
 	}(entries)
 
@@ -194,6 +370,166 @@ func (ds *DiscoveryService) RefreshQuery() {
 	<-ctx.Done()
 }
 
+// Forget every peer and route, used when logging out
+func (ds *DiscoveryService) Reset() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.peers = make(map[string]*PeerModel)
+	ds.devices = make(map[string]*PeerModel)
+	ds.routes = make(map[string]map[string]*RouteModel)
+}
+
+// Store a resolved service entry as a peer, or as another device of the user
+func (ds *DiscoveryService) resolve(entry *zeroconf.ServiceEntry, username string) {
+	peerId := ds.getTxt(entry, "ID")
+	peerName := ds.getTxt(entry, "USERNAME")
+	device := ds.getTxt(entry, "DEVICE")
+
+	if peerId == "" || peerName == "" {
+		return
+	}
+
+	peer := PeerModel{
+		ID:       peerId,
+		Username: peerName,
+		IP:       entry.AddrIPv4[0].String(),
+		Presence: ds.getTxt(entry, "PRESENCE"),
+		Device:   device,
+	}
+
+	if peerId == ds.s.GetString("user:id") {
+		if device != "" && device != ds.s.GetString("user:device") && ds.verified(entry, peerId, peerName) {
+			ds.setDevice(entry.Instance, peer)
+		}
+
+		return
+	}
+
+	if peerName == username {
+		return
+	}
+
+	if ds.verified(entry, peerId, peerName) {
+		ds.setPeer(entry.Instance, peer)
+	}
+}
+
+// Store another device of the user
+func (ds *DiscoveryService) setDevice(instance string, device PeerModel) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.devices[instance] = &device
+}
+
+// Store a resolved peer, announcing presence changes to the frontend
+func (ds *DiscoveryService) setPeer(instance string, peer PeerModel) {
+	if !ValidPresence(peer.Presence) {
+		peer.Presence = PRESENCE_AVAILABLE
+	}
+
+	ds.mu.Lock()
+	old := ds.peers[instance]
+	ds.peers[instance] = &peer
+	ds.mu.Unlock()
+
+	if old == nil || old.Presence != peer.Presence {
+		runtime.EventsEmit(ds.ctx, "peer:presence", PresenceEvent{PeerID: peer.ID, Presence: peer.Presence})
+	}
+}
+
+// Update presence of a peer as announced over the peer channel
+func (ds *DiscoveryService) SetPeerPresence(peerId, presence string) {
+	changed := false
+
+	ds.mu.Lock()
+	for _, peer := range ds.peers {
+		if peer.ID == peerId && peer.Presence != presence {
+			peer.Presence = presence
+			changed = true
+		}
+	}
+	ds.mu.Unlock()
+
+	if changed {
+		runtime.EventsEmit(ds.ctx, "peer:presence", PresenceEvent{PeerID: peerId, Presence: presence})
+	}
+}
+
+// Update presence announced in the TXT record of the broadcast
+func (ds *DiscoveryService) SetPresence(presence string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.server == nil {
+		return
+	}
+
+	txt := append([]string{}, ds.txt...)
+	ds.server.SetText(append(txt, "PRESENCE="+presence))
+}
+
+// Replace every route learned through a contact with its latest advertisement
+func (ds *DiscoveryService) SetRoutes(via string, routes []RouteModel) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	for id, vias := range ds.routes {
+		delete(vias, via)
+		if len(vias) == 0 {
+			delete(ds.routes, id)
+		}
+	}
+
+	now := time.Now()
+	for _, route := range routes {
+		if _, ok := ds.routes[route.ID]; !ok {
+			ds.routes[route.ID] = make(map[string]*RouteModel)
+		}
+
+		ds.routes[route.ID][via] = &RouteModel{
+			ID:        route.ID,
+			Via:       via,
+			Hops:      route.Hops,
+			UpdatedAt: now,
+		}
+	}
+}
+
+// Sign the own broadcast and verify those of peers with the identity keys
+func (ds *DiscoveryService) SignRecords(sign SignFunc, verify VerifyFunc) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.sign = sign
+	ds.verify = verify
+}
+
 func (ds *DiscoveryService) Startup(ctx context.Context) {
 	ds.ctx = ctx
 }
+
+// Check the signed records of a resolved peer, peers that fail are not listed
+func (ds *DiscoveryService) verified(entry *zeroconf.ServiceEntry, peerId, peerName string) bool {
+	ds.mu.Lock()
+	verify := ds.verify
+	ds.mu.Unlock()
+
+	if verify == nil {
+		return true
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(ds.getTxt(entry, "SIG"))
+	if err != nil {
+		signature = nil
+	}
+
+	err = verify(peerId, recordPayload(peerId, peerName), signature)
+	if err != nil {
+		log.Println("Ignoring peer with invalid service records:", peerId, err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,47 @@
+package export
+
+const (
+	FORMAT_JSON = "json"
+	FORMAT_HTML = "html"
+	FORMAT_TEXT = "text"
+
+	// messages decrypted and written per batch
+	BATCH_SIZE = 200
+)
+
+// Export options, from and to are optional RFC3339 bounds of the date range
+type ExportOptions struct {
+	Format string `json:"format"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Zip    bool   `json:"zip"`
+}
+
+type ExportInfo struct {
+	PeerID     string `json:"peer_id"`
+	PeerName   string `json:"peer_name"`
+	UserID     string `json:"user_id"`
+	UserName   string `json:"user_name"`
+	From       string `json:"from,omitempty"`
+	To         string `json:"to,omitempty"`
+	ExportedAt string `json:"exported_at"`
+}
+
+type ExportMessage struct {
+	MessageID string `json:"message_id"`
+	Sender    string `json:"sender"`
+	Name      string `json:"name"`
+	Message   string `json:"message"`
+	ReplyTo   string `json:"reply_to,omitempty"`
+	Edited    bool   `json:"edited"`
+	Deleted   bool   `json:"deleted"`
+	CreatedAt string `json:"created_at"`
+
+	// content no kept key opens anymore, such as messages sealed with a pruned key
+	Unreadable bool `json:"unreadable,omitempty"`
+}
+
+type ExportResult struct {
+	Path     string `json:"path"`
+	Messages int    `json:"messages"`
+}
@@ -0,0 +1,235 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"chat-client/internal/chat"
+	"chat-client/internal/user"
+	"chat-client/pkg/response"
+	"chat-client/pkg/store"
+	"context"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+type ExportService struct {
+	ctx     context.Context
+	db      *gorm.DB
+	s       *store.Store
+	keyring *user.Keyring
+}
+
+type IExportService interface {
+	ExportConversation(peerId string, options ExportOptions) response.Response[ExportResult]
+	exportTo(path string, contact user.ContactModel, options ExportOptions) (int, error)
+	Startup(ctx context.Context)
+	transcript(w io.Writer, contact user.ContactModel, options ExportOptions) (int, error)
+}
+
+func NewExportService(s *store.Store, db *gorm.DB, keyring *user.Keyring) *ExportService {
+	return &ExportService{s: s, db: db, keyring: keyring}
+}
+
+func extension(format string) string {
+	if format == FORMAT_TEXT {
+		return "txt"
+	}
+
+	return format
+}
+
+// Export a conversation to a file picked by the user, an empty path means the dialog was cancelled
+func (es *ExportService) ExportConversation(peerId string, options ExportOptions) response.Response[ExportResult] {
+	var result ExportResult
+	var contact user.ContactModel
+
+	switch options.Format {
+	case FORMAT_JSON, FORMAT_HTML, FORMAT_TEXT:
+	default:
+		return response.New(result).Status(400)
+	}
+
+	for _, bound := range []string{options.From, options.To} {
+		if _, err := time.Parse(time.RFC3339, bound); bound != "" && err != nil {
+			return response.New(result).Status(400)
+		}
+	}
+
+	err := es.db.First(&contact, "ID = ?", peerId).Error
+	if err != nil {
+		return response.New(result).Status(404)
+	}
+
+	filename := "conversation-" + contact.Username + "." + extension(options.Format)
+	if options.Zip {
+		filename = "conversation-" + contact.Username + ".zip"
+	}
+
+	path, err := runtime.SaveFileDialog(es.ctx, runtime.SaveDialogOptions{
+		Title:           "Export conversation",
+		DefaultFilename: filename,
+	})
+	if err != nil {
+		return response.New(result).Status(500)
+	}
+
+	if path == "" {
+		return response.New(result)
+	}
+
+	count, err := es.exportTo(path, contact, options)
+	if err != nil {
+		log.Println("failed to export conversation:", err)
+		return response.New(result).Status(500)
+	}
+
+	return response.New(ExportResult{Path: path, Messages: count})
+}
+
+// Write the transcript to path, bundled into a zip archive if asked, removing the file on failure
+func (es *ExportService) exportTo(path string, contact user.ContactModel, options ExportOptions) (int, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := func() (int, error) {
+		buffered := bufio.NewWriter(file)
+
+		if !options.Zip {
+			count, err := es.transcript(buffered, contact, options)
+			if err != nil {
+				return count, err
+			}
+
+			return count, buffered.Flush()
+		}
+
+		// messages carry no attachments yet, the archive holds the transcript only
+		archive := zip.NewWriter(buffered)
+
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     "conversation-" + contact.Username + "." + extension(options.Format),
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		count, err := es.transcript(entry, contact, options)
+		if err != nil {
+			return count, err
+		}
+
+		err = archive.Close()
+		if err != nil {
+			return count, err
+		}
+
+		return count, buffered.Flush()
+	}()
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(path)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (es *ExportService) Startup(ctx context.Context) {
+	es.ctx = ctx
+}
+
+// Decrypt messages of a conversation in batches and stream them to w
+func (es *ExportService) transcript(w io.Writer, contact user.ContactModel, options ExportOptions) (int, error) {
+	var batch []chat.ChatModel
+	var count int
+
+	keys, err := es.keyring.SharedKeys(contact.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	userId := es.s.GetString("user:id")
+	names := map[string]string{
+		userId:     es.s.GetString("user:username"),
+		contact.ID: contact.Username,
+	}
+
+	info := ExportInfo{
+		PeerID:     contact.ID,
+		PeerName:   contact.Username,
+		UserID:     userId,
+		UserName:   names[userId],
+		From:       options.From,
+		To:         options.To,
+		ExportedAt: time.Now().Format(time.RFC3339),
+	}
+
+	writer := newWriter(options.Format, w)
+
+	err = writer.begin(info)
+	if err != nil {
+		return 0, err
+	}
+
+	query := es.db.Where("peer_id = ? AND (expires_at IS NULL OR expires_at > ?)", contact.ID, time.Now())
+	if options.From != "" {
+		from, _ := time.Parse(time.RFC3339, options.From)
+		query = query.Where("created_at >= ?", from)
+	}
+	if options.To != "" {
+		to, _ := time.Parse(time.RFC3339, options.To)
+		query = query.Where("created_at <= ?", to)
+	}
+
+	err = query.FindInBatches(&batch, BATCH_SIZE, func(tx *gorm.DB, _ int) error {
+		for _, chat := range batch {
+			message := ExportMessage{
+				MessageID: chat.MessageID,
+				Sender:    chat.Sender,
+				Name:      names[chat.Sender],
+				ReplyTo:   chat.ReplyTo,
+				Edited:    chat.EditedAt != nil,
+				Deleted:   chat.Deleted,
+				CreatedAt: chat.CreatedAt.Format(time.RFC3339),
+			}
+
+			if !chat.Deleted {
+				// one unreadable message is marked in place instead of failing the whole export
+				decrypted, err := keys.Open(chat.Message)
+				if err != nil {
+					message.Unreadable = true
+				} else {
+					message.Message = string(decrypted)
+				}
+			}
+
+			err := writer.write(message)
+			if err != nil {
+				return err
+			}
+
+			count++
+		}
+
+		return nil
+	}).Error
+	if err != nil {
+		return count, err
+	}
+
+	return count, writer.end()
+}
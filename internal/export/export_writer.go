@@ -0,0 +1,163 @@
+package export
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// Writes a transcript message by message so histories never have to be held in memory
+type transcriptWriter interface {
+	begin(info ExportInfo) error
+	write(message ExportMessage) error
+	end() error
+}
+
+func newWriter(format string, w io.Writer) transcriptWriter {
+	switch format {
+	case FORMAT_JSON:
+		return &jsonWriter{w: w}
+	case FORMAT_HTML:
+		return &htmlWriter{w: w}
+	default:
+		return &textWriter{w: w}
+	}
+}
+
+// Format an RFC3339 timestamp for people to read
+func readable(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return timestamp
+	}
+
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (jw *jsonWriter) begin(info ExportInfo) error {
+	data, err := sonic.Marshal(&info)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(jw.w, "{\"conversation\":%s,\"messages\":[", data)
+	return err
+}
+
+func (jw *jsonWriter) write(message ExportMessage) error {
+	data, err := sonic.Marshal(&message)
+	if err != nil {
+		return err
+	}
+
+	if jw.count > 0 {
+		_, err = io.WriteString(jw.w, ",")
+		if err != nil {
+			return err
+		}
+	}
+	jw.count++
+
+	_, err = jw.w.Write(data)
+	return err
+}
+
+func (jw *jsonWriter) end() error {
+	_, err := io.WriteString(jw.w, "]}\n")
+	return err
+}
+
+type textWriter struct {
+	w io.Writer
+}
+
+func (tw *textWriter) begin(info ExportInfo) error {
+	_, err := fmt.Fprintf(tw.w, "Conversation between %s and %s\nExported at %s\n\n", info.UserName, info.PeerName, readable(info.ExportedAt))
+	return err
+}
+
+func (tw *textWriter) write(message ExportMessage) error {
+	text := message.Message
+	if message.Deleted {
+		text = "<message deleted>"
+	} else if message.Unreadable {
+		text = "<message could not be decrypted>"
+	} else if message.Edited {
+		text += " (edited)"
+	}
+
+	if message.ReplyTo != "" {
+		text = fmt.Sprintf("(reply to %s) %s", message.ReplyTo, text)
+	}
+
+	_, err := fmt.Fprintf(tw.w, "[%s] %s: %s\n", readable(message.CreatedAt), message.Name, text)
+	return err
+}
+
+func (tw *textWriter) end() error {
+	return nil
+}
+
+// Self-contained transcript, styles are inlined so the file can be attached anywhere
+var htmlTemplates = template.Must(template.New("header").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Conversation with {{.PeerName}}</title>
+<style>
+body { font-family: sans-serif; max-width: 720px; margin: 2em auto; color: #1b2636; }
+header { border-bottom: 1px solid #ccc; margin-bottom: 1em; }
+.msg { margin: .5em 0; }
+.meta { color: #777; font-size: .8em; }
+.mine .name { color: #2563eb; }
+.deleted { font-style: italic; color: #999; }
+</style>
+</head>
+<body>
+<header>
+<h1>Conversation between {{.UserName}} and {{.PeerName}}</h1>
+<p class="meta">Exported at {{.ExportedAt}}</p>
+</header>
+`))
+
+func init() {
+	template.Must(htmlTemplates.New("message").Parse(`<div class="msg{{if .Mine}} mine{{end}}" id="{{.MessageID}}">
+<span class="meta">{{.Time}}</span> <strong class="name">{{.Name}}</strong>
+{{- if .ReplyTo}} <a class="meta" href="#{{.ReplyTo}}">in reply</a>{{end}}
+{{if .Deleted}}<span class="deleted">message deleted</span>{{else if .Unreadable}}<span class="deleted">message could not be decrypted</span>{{else}}<span>{{.Message}}</span>{{if .Edited}} <span class="meta">(edited)</span>{{end}}{{end}}
+</div>
+`))
+	template.Must(htmlTemplates.New("footer").Parse("</body>\n</html>\n"))
+}
+
+type htmlWriter struct {
+	w      io.Writer
+	userId string
+}
+
+func (hw *htmlWriter) begin(info ExportInfo) error {
+	hw.userId = info.UserID
+	info.ExportedAt = readable(info.ExportedAt)
+
+	return htmlTemplates.ExecuteTemplate(hw.w, "header", info)
+}
+
+func (hw *htmlWriter) write(message ExportMessage) error {
+	return htmlTemplates.ExecuteTemplate(hw.w, "message", struct {
+		ExportMessage
+		Mine bool
+		Time string
+	}{message, message.Sender == hw.userId, readable(message.CreatedAt)})
+}
+
+func (hw *htmlWriter) end() error {
+	return htmlTemplates.ExecuteTemplate(hw.w, "footer", nil)
+}
@@ -0,0 +1,44 @@
+package identity
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type IdentityController struct {
+	identityService *IdentityService
+}
+
+type IIdentityController interface {
+	ReceiveRekey(c *fiber.Ctx) error
+}
+
+func NewIdentityController(identityService *IdentityService) *IdentityController {
+	return &IdentityController{identityService}
+}
+
+func (ic *IdentityController) ReceiveRekey(c *fiber.Ctx) error {
+	var input RekeySchema
+
+	err := c.BodyParser(&input)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid rekey"})
+	}
+
+	err = ic.identityService.ReceiveRekey(input)
+	if err != nil {
+		switch err.Error() {
+		case "unknown peer":
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case "identity mismatch", "invalid signature":
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		default:
+			log.Println(err)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid rekey"})
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "rekey received successfully"})
+}
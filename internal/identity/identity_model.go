@@ -0,0 +1,43 @@
+package identity
+
+import "time"
+
+// how often online contacts whose identity key is unknown are asked to exchange keys
+const REKEY_PERIOD = time.Second * 30
+
+// Kinds of signed packets, reported when a signature does not verify
+const (
+	SIGNED_DISCOVERY = "discovery"
+	SIGNED_MESSAGE   = "message"
+	SIGNED_PROFILE   = "profile"
+	SIGNED_REKEY     = "rekey"
+	SIGNED_ROTATE    = "rotate"
+)
+
+// Re-keying packet, payload is the encrypted RekeyData
+type RekeySchema struct {
+	Sender  string `json:"sender" validate:"required,alphanum"`
+	Payload string `json:"payload" validate:"required,base64"`
+}
+
+// Identity key of the sender, proof is its signature over the exchange and known
+// tells whether the sender already has the key of the receiver
+type RekeyData struct {
+	SignKey string `json:"sign_key"`
+	Proof   string `json:"proof"`
+	Known   bool   `json:"known"`
+}
+
+// Emitted with identity:invalid when a packet of a contact fails verification
+type InvalidEvent struct {
+	PeerID string `json:"peer_id"`
+	Kind   string `json:"kind"`
+	Error  string `json:"error"`
+}
+
+// Fingerprints of both identity keys, read out to each other to verify a contact.
+// The peer fingerprint is empty until the contact's key is known
+type Fingerprints struct {
+	Own  string `json:"own"`
+	Peer string `json:"peer"`
+}
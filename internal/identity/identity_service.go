@@ -0,0 +1,322 @@
+package identity
+
+import (
+	"bytes"
+	"chat-client/internal/discovery"
+	"chat-client/internal/protocol"
+	"chat-client/internal/session"
+	"chat-client/internal/user"
+	"chat-client/pkg/encryption"
+	"chat-client/pkg/response"
+	"chat-client/pkg/store"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// IdentityService verifies what contacts sign with their identity keys and
+// exchanges the keys with contacts paired before signing
+type IdentityService struct {
+	ctx              context.Context
+	db               *gorm.DB
+	s                *store.Store
+	keyring          *user.Keyring
+	discoveryService *discovery.DiscoveryService
+	protocolService  *protocol.ProtocolService
+	sessionService   *session.SessionService
+}
+
+type IIdentityService interface {
+	GetFingerprints(peerId string) response.Response[Fingerprints]
+	handleRekey(peerId string, data []byte) error
+	rekey(peerId string) error
+	ReceiveRekey(input RekeySchema) error
+	reject(peerId, kind string, err error) error
+	Startup(ctx context.Context)
+	syncIdentities()
+	Verify(peerId, kind string, payload []byte, signature string) error
+	verifyRecord(peerId string, payload, signature []byte) error
+	WatchIdentities()
+}
+
+func NewIdentityService(s *store.Store, db *gorm.DB, keyring *user.Keyring, discoveryService *discovery.DiscoveryService, protocolService *protocol.ProtocolService, sessionService *session.SessionService) *IdentityService {
+	is := &IdentityService{
+		s:                s,
+		db:               db,
+		keyring:          keyring,
+		discoveryService: discoveryService,
+		protocolService:  protocolService,
+		sessionService:   sessionService,
+	}
+
+	sessionService.Handle("identity:rekey", "/api/identity/rekey", is.handleRekey)
+
+	// sign the own broadcast and check those of contacts
+	discoveryService.SignRecords(keyring.Sign, is.verifyRecord)
+
+	return is
+}
+
+// Bytes signed to prove possession of the key, bound to both ends of the exchange
+func rekeyProof(sender, recipient string, signKey []byte) []byte {
+	return []byte("rekey\x00" + sender + "\x00" + recipient + "\x00" + string(signKey))
+}
+
+// Get the fingerprints of the own identity key and that of a contact
+func (is *IdentityService) GetFingerprints(peerId string) response.Response[Fingerprints] {
+	var result Fingerprints
+	var contact user.ContactModel
+
+	signKey, err := is.keyring.SigningKey()
+	if err != nil {
+		return response.New(result).Status(404)
+	}
+
+	err = is.db.First(&contact, "ID = ?", peerId).Error
+	if err != nil {
+		return response.New(result).Status(404)
+	}
+
+	result.Own = encryption.Fingerprint(signKey)
+	if len(contact.SignKey) > 0 {
+		result.Peer = encryption.Fingerprint(contact.SignKey)
+	}
+
+	return response.New(result)
+}
+
+func (is *IdentityService) handleRekey(peerId string, data []byte) error {
+	var input RekeySchema
+
+	err := sonic.Unmarshal(data, &input)
+	if err != nil {
+		return errors.New("invalid rekey")
+	}
+
+	input.Sender = peerId
+
+	return is.ReceiveRekey(input)
+}
+
+// Send own identity key to a contact, encrypted with the shared key
+func (is *IdentityService) rekey(peerId string) error {
+	var contact user.ContactModel
+
+	userId := is.s.GetString("user:id")
+	signKey := is.s.Get("key:sign")
+	if userId == "" || signKey == nil {
+		return errors.New("signing key not found")
+	}
+
+	err := is.db.First(&contact, "ID = ?", peerId).Error
+	if err != nil {
+		return errors.New("unknown peer")
+	}
+
+	proof, err := is.keyring.Sign(rekeyProof(userId, peerId, signKey))
+	if err != nil {
+		return err
+	}
+
+	data, err := sonic.Marshal(RekeyData{
+		SignKey: base64.StdEncoding.EncodeToString(signKey),
+		Proof:   base64.StdEncoding.EncodeToString(proof),
+		Known:   len(contact.SignKey) > 0,
+	})
+	if err != nil {
+		return errors.New("failed to generate json")
+	}
+
+	sharedKey, err := is.keyring.SharedKey(peerId)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := encryption.AESEncrypt(sharedKey, data)
+	if err != nil {
+		return errors.New("failed to encrypt rekey")
+	}
+
+	payload := RekeySchema{
+		Sender:  userId,
+		Payload: base64.StdEncoding.EncodeToString(encrypted),
+	}
+
+	return is.sessionService.Send(peerId, "identity:rekey", payload)
+}
+
+// Store the identity key a contact sent over the shared key. A key is only taken
+// while none is known, a different one is rejected as an identity mismatch
+func (is *IdentityService) ReceiveRekey(input RekeySchema) error {
+	var data RekeyData
+	var contact user.ContactModel
+
+	decoded, err := base64.StdEncoding.DecodeString(input.Payload)
+	if err != nil {
+		return errors.New("invalid rekey")
+	}
+
+	// keys retired by a rotation still open packets sent before it
+	decrypted, err := is.keyring.Decrypt(input.Sender, decoded)
+	if err != nil {
+		if err.Error() != "failed to decrypt" {
+			return errors.New("unknown peer")
+		}
+
+		return errors.New("invalid rekey")
+	}
+
+	err = sonic.Unmarshal(decrypted, &data)
+	if err != nil {
+		return errors.New("invalid rekey")
+	}
+
+	signKey, err := base64.StdEncoding.DecodeString(data.SignKey)
+	if err != nil || len(signKey) != ed25519.PublicKeySize {
+		return errors.New("invalid rekey")
+	}
+
+	proof, err := base64.StdEncoding.DecodeString(data.Proof)
+	if err != nil || !ed25519.Verify(signKey, rekeyProof(input.Sender, is.s.GetString("user:id"), signKey), proof) {
+		return is.reject(input.Sender, SIGNED_REKEY, errors.New("invalid signature"))
+	}
+
+	err = is.db.First(&contact, "ID = ?", input.Sender).Error
+	if err != nil {
+		return errors.New("unknown peer")
+	}
+
+	if len(contact.SignKey) == 0 {
+		err = is.db.Model(&contact).Update("sign_key", signKey).Error
+		if err != nil {
+			return errors.New("db error")
+		}
+
+		contact.SharedKey = nil
+
+		// notify frontend subscriber for updated contact event
+		runtime.EventsEmit(is.ctx, "contact:updated", contact)
+	} else if !bytes.Equal(contact.SignKey, signKey) {
+		return is.reject(input.Sender, SIGNED_REKEY, errors.New("identity mismatch"))
+	}
+
+	// the contact does not have our key yet, answer with it
+	if !data.Known {
+		go func() {
+			err := is.rekey(input.Sender)
+			if err != nil {
+				log.Println("failed to answer rekey:", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// Surface a packet that failed verification and return the error it is rejected with
+func (is *IdentityService) reject(peerId, kind string, err error) error {
+	log.Println("rejected", kind, "of", peerId+":", err)
+
+	// notify frontend subscriber for failed verification event
+	runtime.EventsEmit(is.ctx, "identity:invalid", InvalidEvent{PeerID: peerId, Kind: kind, Error: err.Error()})
+
+	return err
+}
+
+func (is *IdentityService) Startup(ctx context.Context) {
+	is.ctx = ctx
+}
+
+// Exchange identity keys with online contacts whose key is not known yet
+func (is *IdentityService) syncIdentities() {
+	var contacts []user.ContactModel
+
+	if is.s.Get("key:sign") == nil || is.keyring.Locked() {
+		return
+	}
+
+	err := is.db.Where("sign_key IS NULL OR length(sign_key) = 0").Find(&contacts).Error
+	if err != nil {
+		return
+	}
+
+	for _, contact := range contacts {
+		if peer := is.discoveryService.GetPeer(contact.ID); peer.IP == "" {
+			continue
+		}
+
+		if !is.protocolService.Supports(contact.ID, protocol.FEATURE_IDENTITY) {
+			continue
+		}
+
+		err = is.rekey(contact.ID)
+		if err != nil {
+			log.Println("failed to rekey:", err)
+		}
+	}
+}
+
+// Check the base64 signature of a contact on payload, surfacing failures
+func (is *IdentityService) Verify(peerId, kind string, payload []byte, signature string) error {
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return is.reject(peerId, kind, errors.New("invalid signature"))
+	}
+
+	err = is.keyring.Verify(peerId, payload, decoded)
+	if err != nil {
+		if err.Error() == "unknown peer" {
+			return err
+		}
+
+		return is.reject(peerId, kind, err)
+	}
+
+	return nil
+}
+
+// Check the broadcast of a peer, peers that are not contacts have no key to check against.
+// Other devices of the user sign with the own identity key
+func (is *IdentityService) verifyRecord(peerId string, payload, signature []byte) error {
+	if peerId == is.s.GetString("user:id") {
+		signKey := is.s.Get("key:sign")
+		if len(signKey) != ed25519.PublicKeySize || !ed25519.Verify(signKey, payload, signature) {
+			return is.reject(peerId, SIGNED_DISCOVERY, errors.New("invalid signature"))
+		}
+
+		return nil
+	}
+
+	err := is.keyring.Verify(peerId, payload, signature)
+	if err != nil {
+		if err.Error() == "unknown peer" {
+			return nil
+		}
+
+		return is.reject(peerId, SIGNED_DISCOVERY, err)
+	}
+
+	return nil
+}
+
+// Exchange identity keys with contacts paired before signing as they come online
+func (is *IdentityService) WatchIdentities() {
+	ticker := time.NewTicker(REKEY_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			is.syncIdentities()
+		case <-is.ctx.Done():
+			return
+		}
+	}
+}
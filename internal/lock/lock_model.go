@@ -0,0 +1,20 @@
+package lock
+
+import "time"
+
+const (
+	// how often inactivity is checked
+	LOCK_PERIOD = time.Second * 15
+
+	// upper bound of the auto-lock timer
+	MAX_AUTO_LOCK_MINUTES = 24 * 60
+
+	// unlock attempts allowed per minute
+	UNLOCK_LIMIT = 5
+)
+
+type LockStatus struct {
+	Locked          bool  `json:"locked"`
+	AutoLockMinutes int   `json:"auto_lock_minutes"`
+	Queued          int64 `json:"queued"`
+}
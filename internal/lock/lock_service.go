@@ -0,0 +1,213 @@
+package lock
+
+import (
+	"chat-client/internal/chat"
+	"chat-client/internal/presence"
+	"chat-client/internal/user"
+	"chat-client/pkg/encryption"
+	"chat-client/pkg/ratelimit"
+	"chat-client/pkg/response"
+	"chat-client/pkg/store"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+type LockService struct {
+	ctx             context.Context
+	db              *gorm.DB
+	s               *store.Store
+	keyring         *user.Keyring
+	presenceService *presence.PresenceService
+	limiter         *ratelimit.Limiter
+	userId          string
+	autoLock        int
+	mu              sync.Mutex
+}
+
+type ILockService interface {
+	GetLockStatus() response.Response[LockStatus]
+	load() bool
+	Lock() response.Response[LockStatus]
+	SetAutoLock(minutes int) response.Response[LockStatus]
+	Startup(ctx context.Context)
+	status() LockStatus
+	Unlock(password string) response.Response[LockStatus]
+	WatchLock()
+}
+
+func NewLockService(s *store.Store, db *gorm.DB, keyring *user.Keyring, presenceService *presence.PresenceService) *LockService {
+	return &LockService{
+		s:               s,
+		db:              db,
+		keyring:         keyring,
+		presenceService: presenceService,
+		limiter:         ratelimit.NewLimiter(UNLOCK_LIMIT, time.Minute),
+	}
+}
+
+func (ls *LockService) GetLockStatus() response.Response[LockStatus] {
+	if !ls.load() {
+		return response.New(LockStatus{}).Status(404)
+	}
+
+	return response.New(ls.status())
+}
+
+// Load the auto-lock timer of the logged in user, returns false while logged out
+func (ls *LockService) load() bool {
+	var profile user.UserModel
+
+	userId := ls.s.GetString("user:id")
+	if userId == "" {
+		return false
+	}
+
+	ls.mu.Lock()
+	loaded := ls.userId == userId
+	ls.mu.Unlock()
+
+	if loaded {
+		return true
+	}
+
+	err := ls.db.First(&profile, "ID = ?", userId).Error
+	if err != nil {
+		return false
+	}
+
+	ls.mu.Lock()
+	ls.userId = userId
+	ls.autoLock = profile.AutoLockMinutes
+	ls.mu.Unlock()
+
+	return true
+}
+
+// Lock the session, wiping the data key from memory. Incoming
+// messages are queued encrypted until unlocked
+func (ls *LockService) Lock() response.Response[LockStatus] {
+	if !ls.load() {
+		return response.New(LockStatus{}).Status(404)
+	}
+
+	if !ls.keyring.Locked() {
+		ls.keyring.Lock()
+
+		// notify frontend subscriber for session locked event
+		runtime.EventsEmit(ls.ctx, "session:locked", true)
+	}
+
+	return response.New(ls.status())
+}
+
+// Set the minutes of inactivity before the session locks, zero turns it off
+func (ls *LockService) SetAutoLock(minutes int) response.Response[LockStatus] {
+	if minutes < 0 || minutes > MAX_AUTO_LOCK_MINUTES {
+		return response.New(LockStatus{}).Status(400)
+	}
+
+	if !ls.load() {
+		return response.New(LockStatus{}).Status(404)
+	}
+
+	err := ls.db.Model(&user.UserModel{}).Where("ID = ?", ls.s.GetString("user:id")).Update("auto_lock_minutes", minutes).Error
+	if err != nil {
+		return response.New(LockStatus{}).Status(500)
+	}
+
+	ls.mu.Lock()
+	ls.autoLock = minutes
+	ls.mu.Unlock()
+
+	return response.New(ls.status())
+}
+
+func (ls *LockService) Startup(ctx context.Context) {
+	ls.ctx = ctx
+}
+
+func (ls *LockService) status() LockStatus {
+	var queued int64
+
+	ls.db.Model(&chat.QueuedPacketModel{}).Count(&queued)
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	return LockStatus{
+		Locked:          ls.keyring.Locked(),
+		AutoLockMinutes: ls.autoLock,
+		Queued:          queued,
+	}
+}
+
+// Unlock the session with the password, queued messages are processed afterwards
+func (ls *LockService) Unlock(password string) response.Response[LockStatus] {
+	var profile user.UserModel
+
+	if !ls.load() {
+		return response.New(LockStatus{}).Status(404)
+	}
+
+	if !ls.keyring.Locked() {
+		return response.New(ls.status())
+	}
+
+	if !ls.limiter.Allow("unlock") {
+		return response.New(ls.status()).Status(429)
+	}
+
+	err := ls.db.First(&profile, "ID = ?", ls.s.GetString("user:id")).Error
+	if err != nil {
+		return response.New(ls.status()).Status(404)
+	}
+
+	ok, _, err := encryption.VerifyPassword([]byte(password), profile.Password)
+	if err != nil || !ok {
+		return response.New(ls.status()).Status(401)
+	}
+
+	ls.limiter.Reset("unlock")
+
+	err = ls.keyring.Unlock(profile, password)
+	if err != nil {
+		return response.New(ls.status()).Status(500)
+	}
+
+	// the idle time would otherwise lock again right away
+	ls.presenceService.ReportActivity()
+
+	// notify frontend subscriber for session unlocked event
+	runtime.EventsEmit(ls.ctx, "session:unlocked", true)
+
+	return response.New(ls.status())
+}
+
+// Lock the session after the configured inactivity
+func (ls *LockService) WatchLock() {
+	ticker := time.NewTicker(LOCK_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !ls.load() || ls.keyring.Locked() {
+				continue
+			}
+
+			ls.mu.Lock()
+			autoLock := ls.autoLock
+			ls.mu.Unlock()
+
+			if autoLock > 0 && ls.presenceService.Idle() >= time.Duration(autoLock)*time.Minute {
+				ls.Lock()
+			}
+		case <-ls.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package mesh
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type MeshController struct {
+	meshService *MeshService
+}
+
+type IMeshController interface {
+	ReceiveRoutes(c *fiber.Ctx) error
+}
+
+func NewMeshController(meshService *MeshService) *MeshController {
+	return &MeshController{meshService}
+}
+
+func (mc *MeshController) ReceiveRoutes(c *fiber.Ctx) error {
+	var input PacketSchema
+
+	err := c.BodyParser(&input)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid routes packet"})
+	}
+
+	err = mc.meshService.ReceiveRoutes(input)
+	if err != nil {
+		switch err.Error() {
+		case "rate limit exceeded":
+			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+		case "mesh disabled", "unknown forwarder":
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid routes packet"})
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "routes received successfully"})
+}
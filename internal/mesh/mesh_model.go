@@ -0,0 +1,19 @@
+package mesh
+
+import "encoding/json"
+
+// Hop-by-hop packet, payload is encrypted with the shared key of sender and receiver
+type PacketSchema struct {
+	Sender  string `json:"sender" validate:"required,alphanum"`
+	Payload string `json:"payload" validate:"required,base64"`
+}
+
+// End-to-end envelope, data carries a payload whose content is encrypted with the
+// shared key of origin and recipient
+type EnvelopeSchema struct {
+	ID        string          `json:"id"`
+	Origin    string          `json:"origin"`
+	Recipient string          `json:"recipient"`
+	Hops      int             `json:"hops"`
+	Data      json.RawMessage `json:"data"`
+}
@@ -0,0 +1,383 @@
+package mesh
+
+import (
+	"chat-client/internal/discovery"
+	"chat-client/internal/protocol"
+	"chat-client/internal/session"
+	"chat-client/internal/user"
+	"chat-client/pkg/encryption"
+	"chat-client/pkg/ratelimit"
+	"chat-client/pkg/response"
+	"chat-client/pkg/store"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	MAX_HOPS      = 4
+	SEEN_TTL      = time.Minute * 5
+	GOSSIP_PERIOD = time.Second * 30
+
+	// packets accepted from a single forwarder per window
+	FORWARD_LIMIT  = 60
+	FORWARD_WINDOW = time.Minute
+)
+
+type MeshService struct {
+	ctx              context.Context
+	db               *gorm.DB
+	s                *store.Store
+	keyring          *user.Keyring
+	discoveryService *discovery.DiscoveryService
+	protocolService  *protocol.ProtocolService
+	sessionService   *session.SessionService
+	limiter          *ratelimit.Limiter
+}
+
+type IMeshService interface {
+	decrypt(input PacketSchema, v any) error
+	encrypt(peerId string, v any) (PacketSchema, error)
+	forward(env EnvelopeSchema, from string) error
+	GetMeshMode() response.Response[bool]
+	gossip()
+	GossipRoutes()
+	handleRoutes(peerId string, data []byte) error
+	isEnabled() bool
+	Receive(input PacketSchema) (*EnvelopeSchema, error)
+	ReceiveRoutes(input PacketSchema) error
+	Send(recipient string, v any) error
+	SetMeshMode(enabled bool) response.Response[bool]
+	Startup(ctx context.Context)
+}
+
+func NewMeshService(s *store.Store, db *gorm.DB, keyring *user.Keyring, discoveryService *discovery.DiscoveryService, protocolService *protocol.ProtocolService, sessionService *session.SessionService) *MeshService {
+	ms := &MeshService{
+		s:                s,
+		db:               db,
+		keyring:          keyring,
+		discoveryService: discoveryService,
+		protocolService:  protocolService,
+		sessionService:   sessionService,
+		limiter:          ratelimit.NewLimiter(FORWARD_LIMIT, FORWARD_WINDOW),
+	}
+
+	// receive route gossip over peer sessions
+	sessionService.Handle("mesh:routes", "/api/mesh/routes", ms.handleRoutes)
+
+	return ms
+}
+
+// Decrypt hop-by-hop packet using the shared key of its sender
+func (ms *MeshService) decrypt(input PacketSchema, v any) error {
+	decoded, err := base64.StdEncoding.DecodeString(input.Payload)
+	if err != nil {
+		return errors.New("invalid packet")
+	}
+
+	// keys retired by a rotation still open packets sent before it
+	decrypted, err := ms.keyring.Decrypt(input.Sender, decoded)
+	if err != nil {
+		if err.Error() != "failed to decrypt" {
+			return errors.New("unknown forwarder")
+		}
+
+		return errors.New("invalid packet")
+	}
+
+	err = sonic.Unmarshal(decrypted, v)
+	if err != nil {
+		return errors.New("invalid packet")
+	}
+
+	return nil
+}
+
+// Encrypt hop-by-hop packet using the shared key of the next hop
+func (ms *MeshService) encrypt(peerId string, v any) (PacketSchema, error) {
+	var packet PacketSchema
+
+	key, err := ms.keyring.SharedKey(peerId)
+	if err != nil {
+		return packet, err
+	}
+
+	payload, err := sonic.Marshal(v)
+	if err != nil {
+		return packet, errors.New("failed to generate json")
+	}
+
+	encrypted, err := encryption.AESEncrypt(key, payload)
+	if err != nil {
+		return packet, errors.New("failed to encrypt packet")
+	}
+
+	packet.Sender = ms.s.GetString("user:id")
+	packet.Payload = base64.StdEncoding.EncodeToString(encrypted)
+
+	return packet, nil
+}
+
+// Pass envelope to the recipient or to the nearest contact that can reach it
+func (ms *MeshService) forward(env EnvelopeSchema, from string) error {
+	var hops []string
+
+	// prefer direct delivery when the recipient is visible on this network
+	if peer := ms.discoveryService.GetPeer(env.Recipient); peer.IP != "" {
+		hops = append(hops, env.Recipient)
+	}
+
+	for _, route := range ms.discoveryService.GetRoutes(env.Recipient) {
+		if route.Via == from || route.Via == env.Origin || route.Hops > env.Hops {
+			continue
+		}
+
+		hops = append(hops, route.Via)
+	}
+
+	for _, hop := range hops {
+		if !ms.protocolService.Supports(hop, protocol.FEATURE_MESH) {
+			continue
+		}
+
+		packet, err := ms.encrypt(hop, env)
+		if err != nil {
+			continue
+		}
+
+		err = ms.sessionService.Send(hop, "mesh:forward", packet)
+		if err != nil {
+			log.Println("Failed to forward envelope:", err)
+			continue
+		}
+
+		return nil
+	}
+
+	return errors.New("no route to peer")
+}
+
+func (ms *MeshService) GetMeshMode() response.Response[bool] {
+	return response.New(ms.isEnabled())
+}
+
+// Advertise reachable peers to every online contact
+func (ms *MeshService) gossip() {
+	userId := ms.s.GetString("user:id")
+	if userId == "" || !ms.isEnabled() {
+		return
+	}
+
+	var contacts []user.ContactModel
+	err := ms.db.Find(&contacts).Error
+	if err != nil {
+		return
+	}
+
+	peers := ms.discoveryService.GetPeers()
+	reachable := ms.discoveryService.GetReachable()
+
+	for _, contact := range contacts {
+		if peer := ms.discoveryService.GetPeer(contact.ID); peer.IP == "" {
+			continue
+		}
+
+		if !ms.protocolService.Supports(contact.ID, protocol.FEATURE_MESH) {
+			continue
+		}
+
+		best := make(map[string]int)
+		for _, peer := range peers.Data {
+			best[peer.ID] = 1
+		}
+
+		for _, route := range reachable {
+			// split horizon, never advertise a route back to where it came from
+			if route.Via == contact.ID || route.Hops >= MAX_HOPS {
+				continue
+			}
+
+			if hops, ok := best[route.ID]; !ok || route.Hops < hops {
+				best[route.ID] = route.Hops
+			}
+		}
+
+		delete(best, contact.ID)
+
+		routes := make([]discovery.RouteModel, 0, len(best))
+		for id, hops := range best {
+			routes = append(routes, discovery.RouteModel{ID: id, Hops: hops})
+		}
+
+		packet, err := ms.encrypt(contact.ID, routes)
+		if err != nil {
+			continue
+		}
+
+		err = ms.sessionService.Send(contact.ID, "mesh:routes", packet)
+		if err != nil {
+			log.Println("Failed to gossip routes:", err)
+		}
+	}
+}
+
+func (ms *MeshService) GossipRoutes() {
+	ticker := time.NewTicker(GOSSIP_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ms.gossip()
+		case <-ms.ctx.Done():
+			log.Println("Shutting down mesh gossip...")
+			return
+		}
+	}
+}
+
+func (ms *MeshService) handleRoutes(peerId string, data []byte) error {
+	var input PacketSchema
+
+	err := sonic.Unmarshal(data, &input)
+	if err != nil {
+		return errors.New("invalid routes packet")
+	}
+
+	// the session is already authenticated as the advertising contact
+	input.Sender = peerId
+
+	return ms.ReceiveRoutes(input)
+}
+
+func (ms *MeshService) isEnabled() bool {
+	var result user.UserModel
+
+	err := ms.db.First(&result).Error
+	if err != nil {
+		return false
+	}
+
+	return result.MeshEnabled
+}
+
+// Handle incoming packet, returns the envelope only if it is addressed to this user
+func (ms *MeshService) Receive(input PacketSchema) (*EnvelopeSchema, error) {
+	var env EnvelopeSchema
+
+	if !ms.limiter.Allow("forward:" + input.Sender) {
+		return nil, errors.New("rate limit exceeded")
+	}
+
+	err := ms.decrypt(input, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	// drop envelopes that already passed through this node
+	if ms.s.Get("mesh:seen:"+env.ID) != nil {
+		return nil, nil
+	}
+	ms.s.SetEx("mesh:seen:"+env.ID, []byte(input.Sender), SEEN_TTL)
+
+	if env.Recipient == ms.s.GetString("user:id") {
+		return &env, nil
+	}
+
+	if !ms.isEnabled() {
+		return nil, errors.New("mesh disabled")
+	}
+
+	env.Hops--
+	if env.Hops <= 0 {
+		return nil, errors.New("hop limit reached")
+	}
+
+	return nil, ms.forward(env, input.Sender)
+}
+
+// Store routes advertised by a contact
+func (ms *MeshService) ReceiveRoutes(input PacketSchema) error {
+	var routes []discovery.RouteModel
+
+	if !ms.limiter.Allow("routes:" + input.Sender) {
+		return errors.New("rate limit exceeded")
+	}
+
+	if !ms.isEnabled() {
+		return errors.New("mesh disabled")
+	}
+
+	err := ms.decrypt(input, &routes)
+	if err != nil {
+		return err
+	}
+
+	userId := ms.s.GetString("user:id")
+
+	accepted := make([]discovery.RouteModel, 0, len(routes))
+	for _, route := range routes {
+		if route.ID == "" || route.ID == userId || route.Hops < 1 || route.Hops >= MAX_HOPS {
+			continue
+		}
+
+		// one more hop to go through the advertising contact
+		route.Hops++
+		accepted = append(accepted, route)
+	}
+
+	ms.discoveryService.SetRoutes(input.Sender, accepted)
+
+	return nil
+}
+
+// Send end-to-end encrypted payload through the mesh
+func (ms *MeshService) Send(recipient string, v any) error {
+	if !ms.isEnabled() {
+		return errors.New("mesh disabled")
+	}
+
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		return errors.New("failed to generate json")
+	}
+
+	env := EnvelopeSchema{
+		ID:        ulid.Make().String(),
+		Origin:    ms.s.GetString("user:id"),
+		Recipient: recipient,
+		Hops:      MAX_HOPS,
+		Data:      data,
+	}
+
+	// never accept our own envelope back from the mesh
+	ms.s.SetEx("mesh:seen:"+env.ID, []byte(env.Origin), SEEN_TTL)
+
+	return ms.forward(env, "")
+}
+
+func (ms *MeshService) SetMeshMode(enabled bool) response.Response[bool] {
+	var result user.UserModel
+
+	err := ms.db.First(&result).Error
+	if err != nil {
+		return response.New(false).Status(404)
+	}
+
+	err = ms.db.Model(&result).Update("mesh_enabled", enabled).Error
+	if err != nil {
+		return response.New(result.MeshEnabled).Status(500)
+	}
+
+	return response.New(enabled)
+}
+
+func (ms *MeshService) Startup(ctx context.Context) {
+	ms.ctx = ctx
+}
@@ -0,0 +1,41 @@
+package presence
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PresenceController struct {
+	presenceService *PresenceService
+}
+
+type IPresenceController interface {
+	ReceivePresence(c *fiber.Ctx) error
+}
+
+func NewPresenceController(presenceService *PresenceService) *PresenceController {
+	return &PresenceController{presenceService}
+}
+
+func (pc *PresenceController) ReceivePresence(c *fiber.Ctx) error {
+	var input PresenceSchema
+
+	err := c.BodyParser(&input)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid presence"})
+	}
+
+	err = pc.presenceService.ReceivePresence(input)
+	if err != nil {
+		if err.Error() == "unknown peer" {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		log.Println(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid presence"})
+	}
+
+	return c.JSON(fiber.Map{"status": "presence received successfully"})
+}
@@ -0,0 +1,30 @@
+package presence
+
+import "time"
+
+const (
+	// how often inactivity is checked and the presence is pushed to contacts that missed it
+	PRESENCE_PERIOD = time.Second * 15
+
+	// upper bound of the auto-away timer
+	MAX_AUTO_AWAY_MINUTES = 24 * 60
+)
+
+// Presence packet, payload is the encrypted PresenceData
+type PresenceSchema struct {
+	Sender  string `json:"sender" validate:"required,alphanum"`
+	Payload string `json:"payload" validate:"required,base64"`
+}
+
+type PresenceData struct {
+	Presence string `json:"presence"`
+	SentAt   int64  `json:"sent_at"`
+}
+
+// Own presence, away is set while the auto-away timer overrides the chosen presence
+type PresenceSettings struct {
+	Presence        string `json:"presence"`
+	Chosen          string `json:"chosen"`
+	Away            bool   `json:"away"`
+	AutoAwayMinutes int    `json:"auto_away_minutes"`
+}
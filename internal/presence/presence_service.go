@@ -0,0 +1,429 @@
+package presence
+
+import (
+	"chat-client/internal/discovery"
+	"chat-client/internal/protocol"
+	"chat-client/internal/session"
+	"chat-client/internal/user"
+	"chat-client/pkg/encryption"
+	"chat-client/pkg/response"
+	"chat-client/pkg/store"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+type PresenceService struct {
+	ctx              context.Context
+	db               *gorm.DB
+	s                *store.Store
+	keyring          *user.Keyring
+	discoveryService *discovery.DiscoveryService
+	protocolService  *protocol.ProtocolService
+	sessionService   *session.SessionService
+	userId           string
+	chosen           string
+	away             bool
+	autoAway         int
+	lastActivity     time.Time
+	pushed           map[string]string
+	received         map[string]int64
+	queued           map[string]PresenceSchema
+	mu               sync.Mutex
+}
+
+type IPresenceService interface {
+	apply()
+	current() string
+	GetPresence() response.Response[PresenceSettings]
+	handlePresence(peerId string, data []byte) error
+	Idle() time.Duration
+	load() bool
+	push(peerId, userId, presence string) error
+	queue(input PresenceSchema) error
+	ReceivePresence(input PresenceSchema) error
+	replayQueued()
+	ReportActivity()
+	SetAutoAway(minutes int) response.Response[PresenceSettings]
+	SetPresence(presence string) response.Response[PresenceSettings]
+	settings() PresenceSettings
+	Startup(ctx context.Context)
+	syncPresence()
+	WatchPresence()
+}
+
+func NewPresenceService(s *store.Store, db *gorm.DB, keyring *user.Keyring, discoveryService *discovery.DiscoveryService, protocolService *protocol.ProtocolService, sessionService *session.SessionService) *PresenceService {
+	ps := &PresenceService{
+		s:                s,
+		db:               db,
+		keyring:          keyring,
+		discoveryService: discoveryService,
+		protocolService:  protocolService,
+		sessionService:   sessionService,
+		chosen:           discovery.PRESENCE_AVAILABLE,
+		lastActivity:     time.Now(),
+		pushed:           make(map[string]string),
+		received:         make(map[string]int64),
+		queued:           make(map[string]PresenceSchema),
+	}
+
+	sessionService.Handle("presence:update", "/api/presence/update", ps.handlePresence)
+	keyring.OnUnlock(ps.replayQueued)
+
+	return ps
+}
+
+// Publish the current presence locally, in the broadcast and to online contacts
+func (ps *PresenceService) apply() {
+	presence := ps.current()
+	settings := ps.settings()
+
+	// read by the chat service to hold back notifications while in do-not-disturb
+	ps.s.Set("user:presence", []byte(presence))
+	ps.discoveryService.SetPresence(presence)
+
+	// notify frontend subscriber for own presence event
+	runtime.EventsEmit(ps.ctx, "presence:changed", settings)
+
+	go ps.syncPresence()
+}
+
+func (ps *PresenceService) current() string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.away {
+		return discovery.PRESENCE_AWAY
+	}
+
+	return ps.chosen
+}
+
+func (ps *PresenceService) GetPresence() response.Response[PresenceSettings] {
+	if !ps.load() {
+		return response.New(PresenceSettings{}).Status(404)
+	}
+
+	return response.New(ps.settings())
+}
+
+func (ps *PresenceService) handlePresence(peerId string, data []byte) error {
+	var input PresenceSchema
+
+	err := sonic.Unmarshal(data, &input)
+	if err != nil {
+		return errors.New("invalid presence")
+	}
+
+	input.Sender = peerId
+
+	return ps.ReceivePresence(input)
+}
+
+// Time since the frontend last reported user activity
+func (ps *PresenceService) Idle() time.Duration {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return time.Since(ps.lastActivity)
+}
+
+// Load the saved presence of the logged in user, returns false while logged out
+func (ps *PresenceService) load() bool {
+	var profile user.UserModel
+
+	userId := ps.s.GetString("user:id")
+	if userId == "" {
+		return false
+	}
+
+	// the store is cleared on logout, a new login publishes the presence again
+	ps.mu.Lock()
+	loaded := ps.userId == userId && ps.s.Get("user:presence") != nil
+	ps.mu.Unlock()
+
+	if loaded {
+		return true
+	}
+
+	err := ps.db.First(&profile, "ID = ?", userId).Error
+	if err != nil {
+		return false
+	}
+
+	ps.mu.Lock()
+	ps.userId = userId
+	ps.chosen = profile.Presence
+	if !discovery.ValidPresence(ps.chosen) {
+		ps.chosen = discovery.PRESENCE_AVAILABLE
+	}
+	ps.away = false
+	ps.autoAway = profile.AutoAwayMinutes
+	ps.lastActivity = time.Now()
+	ps.pushed = make(map[string]string)
+	ps.received = make(map[string]int64)
+	ps.mu.Unlock()
+
+	ps.apply()
+
+	return true
+}
+
+// Send own presence encrypted with the shared key of the contact
+func (ps *PresenceService) push(peerId, userId, presence string) error {
+	data, err := sonic.Marshal(PresenceData{Presence: presence, SentAt: time.Now().UnixMilli()})
+	if err != nil {
+		return errors.New("failed to generate json")
+	}
+
+	sharedKey, err := ps.keyring.SharedKey(peerId)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := encryption.AESEncrypt(sharedKey, data)
+	if err != nil {
+		return errors.New("failed to encrypt presence")
+	}
+
+	payload := PresenceSchema{
+		Sender:  userId,
+		Payload: base64.StdEncoding.EncodeToString(encrypted),
+	}
+
+	return ps.sessionService.Send(peerId, "presence:update", payload)
+}
+
+// Hold a presence push of a contact until the session is unlocked, only the latest one matters
+func (ps *PresenceService) queue(input PresenceSchema) error {
+	var contacts int64
+
+	err := ps.db.Model(&user.ContactModel{}).Where("ID = ?", input.Sender).Count(&contacts).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	if contacts == 0 {
+		return errors.New("unknown peer")
+	}
+
+	ps.mu.Lock()
+	ps.queued[input.Sender] = input
+	ps.mu.Unlock()
+
+	return nil
+}
+
+// Store the presence a contact announced over the peer channel
+func (ps *PresenceService) ReceivePresence(input PresenceSchema) error {
+	var data PresenceData
+
+	if ps.keyring.Locked() {
+		return ps.queue(input)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(input.Payload)
+	if err != nil {
+		return errors.New("invalid presence")
+	}
+
+	// keys retired by a rotation still open packets sent before it
+	decrypted, err := ps.keyring.Decrypt(input.Sender, decoded)
+	if err != nil {
+		if err.Error() != "failed to decrypt" {
+			return errors.New("unknown peer")
+		}
+
+		return errors.New("invalid presence")
+	}
+
+	err = sonic.Unmarshal(decrypted, &data)
+	if err != nil || !discovery.ValidPresence(data.Presence) {
+		return errors.New("invalid presence")
+	}
+
+	// pushes can overtake each other on the session and the mesh, an older one must not win
+	ps.mu.Lock()
+	if data.SentAt <= ps.received[input.Sender] {
+		ps.mu.Unlock()
+		return nil
+	}
+	ps.received[input.Sender] = data.SentAt
+	ps.discoveryService.SetPeerPresence(input.Sender, data.Presence)
+	ps.mu.Unlock()
+
+	return nil
+}
+
+// Apply presence pushes of contacts received while the session was locked
+func (ps *PresenceService) replayQueued() {
+	ps.mu.Lock()
+	queued := ps.queued
+	ps.queued = make(map[string]PresenceSchema)
+	ps.mu.Unlock()
+
+	for _, input := range queued {
+		err := ps.ReceivePresence(input)
+		if err != nil {
+			log.Println("failed to replay queued presence:", err)
+		}
+	}
+}
+
+// Called on user input in the frontend and when chatting, ends an automatic away
+func (ps *PresenceService) ReportActivity() {
+	ps.mu.Lock()
+	ps.lastActivity = time.Now()
+	away := ps.away
+	ps.away = false
+	ps.mu.Unlock()
+
+	if away {
+		ps.apply()
+	}
+}
+
+// Set the minutes of inactivity before turning away, zero turns it off
+func (ps *PresenceService) SetAutoAway(minutes int) response.Response[PresenceSettings] {
+	if minutes < 0 || minutes > MAX_AUTO_AWAY_MINUTES {
+		return response.New(PresenceSettings{}).Status(400)
+	}
+
+	if !ps.load() {
+		return response.New(PresenceSettings{}).Status(404)
+	}
+
+	err := ps.db.Model(&user.UserModel{}).Where("ID = ?", ps.s.GetString("user:id")).Update("auto_away_minutes", minutes).Error
+	if err != nil {
+		return response.New(PresenceSettings{}).Status(500)
+	}
+
+	ps.mu.Lock()
+	ps.autoAway = minutes
+	ps.mu.Unlock()
+
+	return response.New(ps.settings())
+}
+
+// Choose own presence, which also ends an automatic away
+func (ps *PresenceService) SetPresence(presence string) response.Response[PresenceSettings] {
+	if !discovery.ValidPresence(presence) {
+		return response.New(PresenceSettings{}).Status(400)
+	}
+
+	if !ps.load() {
+		return response.New(PresenceSettings{}).Status(404)
+	}
+
+	err := ps.db.Model(&user.UserModel{}).Where("ID = ?", ps.s.GetString("user:id")).Update("presence", presence).Error
+	if err != nil {
+		return response.New(PresenceSettings{}).Status(500)
+	}
+
+	ps.mu.Lock()
+	ps.chosen = presence
+	ps.away = false
+	ps.lastActivity = time.Now()
+	ps.mu.Unlock()
+
+	ps.apply()
+
+	return response.New(ps.settings())
+}
+
+func (ps *PresenceService) settings() PresenceSettings {
+	presence := ps.current()
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return PresenceSettings{
+		Presence:        presence,
+		Chosen:          ps.chosen,
+		Away:            ps.away,
+		AutoAwayMinutes: ps.autoAway,
+	}
+}
+
+func (ps *PresenceService) Startup(ctx context.Context) {
+	ps.ctx = ctx
+}
+
+// Push own presence to online contacts that have not received the current one
+func (ps *PresenceService) syncPresence() {
+	userId := ps.s.GetString("user:id")
+	if userId == "" {
+		return
+	}
+
+	presence := ps.current()
+
+	peers := ps.discoveryService.GetPeers()
+	for _, peer := range peers.Data {
+		ps.mu.Lock()
+		pushed := ps.pushed[peer.ID]
+		ps.mu.Unlock()
+
+		if pushed == presence {
+			continue
+		}
+
+		// only contacts share a key to encrypt the presence with
+		if _, err := ps.keyring.SharedKey(peer.ID); err != nil {
+			continue
+		}
+
+		if !ps.protocolService.Supports(peer.ID, protocol.FEATURE_PRESENCE) {
+			continue
+		}
+
+		err := ps.push(peer.ID, userId, presence)
+		if err != nil {
+			log.Println("failed to push presence:", err)
+			continue
+		}
+
+		ps.mu.Lock()
+		ps.pushed[peer.ID] = presence
+		ps.mu.Unlock()
+	}
+}
+
+// Turn away after the configured inactivity while available and keep contacts up to date
+func (ps *PresenceService) WatchPresence() {
+	ticker := time.NewTicker(PRESENCE_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !ps.load() {
+				continue
+			}
+
+			ps.mu.Lock()
+			idle := ps.autoAway > 0 && time.Since(ps.lastActivity) >= time.Duration(ps.autoAway)*time.Minute
+			changed := idle && !ps.away && ps.chosen == discovery.PRESENCE_AVAILABLE
+			if changed {
+				ps.away = true
+			}
+			ps.mu.Unlock()
+
+			if changed {
+				ps.apply()
+				continue
+			}
+
+			ps.syncPresence()
+		case <-ps.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package profile
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ProfileController struct {
+	profileService *ProfileService
+}
+
+type IProfileController interface {
+	ReceiveProfile(c *fiber.Ctx) error
+}
+
+func NewProfileController(profileService *ProfileService) *ProfileController {
+	return &ProfileController{profileService}
+}
+
+func (pc *ProfileController) ReceiveProfile(c *fiber.Ctx) error {
+	var input ProfileSchema
+
+	err := c.BodyParser(&input)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid profile"})
+	}
+
+	err = pc.profileService.ReceiveProfile(input)
+	if err != nil {
+		switch err.Error() {
+		case "unknown peer":
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case "signature missing", "invalid signature":
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		default:
+			log.Println(err)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid profile"})
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "profile received successfully"})
+}
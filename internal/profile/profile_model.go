@@ -0,0 +1,56 @@
+package profile
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MAX_DISPLAY_NAME_LENGTH = 48
+	MAX_STATUS_LENGTH       = 140
+
+	// largest image accepted before resizing
+	MAX_AVATAR_INPUT = 5 << 20
+
+	// avatars are cropped to a square of this many pixels and stored as JPEG
+	AVATAR_SIZE    = 128
+	AVATAR_QUALITY = 85
+
+	// how often online contacts that missed the latest profile are caught up
+	PROFILE_SYNC_PERIOD = time.Second * 30
+
+	// profile pushes kept while the session is locked
+	MAX_QUEUED_PROFILES = 500
+)
+
+// Avatar is a PNG, JPEG or GIF image as base64 or data URL, empty keeps the current one
+type UpdateProfileSchema struct {
+	DisplayName  string `json:"display_name"`
+	StatusText   string `json:"status_text"`
+	Avatar       string `json:"avatar,omitempty"`
+	RemoveAvatar bool   `json:"remove_avatar"`
+}
+
+// Profile packet, payload is the encrypted ProfileData
+type ProfileSchema struct {
+	Sender  string `json:"sender" validate:"required,alphanum"`
+	Payload string `json:"payload" validate:"required,base64"`
+}
+
+type ProfileData struct {
+	DisplayName string `json:"display_name"`
+	StatusText  string `json:"status_text"`
+	Avatar      string `json:"avatar"`
+	Version     int64  `json:"version"`
+
+	// identity signature over the other fields, omitted by clients from before signing
+	Signature string `json:"signature,omitempty"`
+}
+
+// Bytes covered by the signature, bound to the sender
+func (pd ProfileData) signed(sender string) []byte {
+	return []byte(strings.Join([]string{
+		"profile", sender, pd.DisplayName, pd.StatusText, pd.Avatar, strconv.FormatInt(pd.Version, 10),
+	}, "\x00"))
+}
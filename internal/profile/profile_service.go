@@ -0,0 +1,413 @@
+package profile
+
+import (
+	"bytes"
+	"chat-client/internal/discovery"
+	"chat-client/internal/identity"
+	"chat-client/internal/protocol"
+	"chat-client/internal/session"
+	"chat-client/internal/user"
+	"chat-client/pkg/encryption"
+	"chat-client/pkg/response"
+	"chat-client/pkg/store"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bytedance/sonic"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"golang.org/x/image/draw"
+	"gorm.io/gorm"
+)
+
+// largest width or height decoded, guards against decompression bombs
+const MAX_AVATAR_DIMENSION = 8192
+
+type ProfileService struct {
+	ctx              context.Context
+	db               *gorm.DB
+	s                *store.Store
+	keyring          *user.Keyring
+	discoveryService *discovery.DiscoveryService
+	identityService  *identity.IdentityService
+	protocolService  *protocol.ProtocolService
+	sessionService   *session.SessionService
+	pushed           map[string]int64
+	queued           []ProfileSchema
+	mu               sync.Mutex
+}
+
+type IProfileService interface {
+	handleProfile(peerId string, data []byte) error
+	push(peerId string, profile user.UserModel) error
+	PushProfiles()
+	queue(input ProfileSchema) error
+	ReceiveProfile(input ProfileSchema) error
+	replayQueued()
+	Startup(ctx context.Context)
+	syncProfiles()
+	UpdateProfile(input UpdateProfileSchema) response.Response[user.UserProfile]
+}
+
+func NewProfileService(s *store.Store, db *gorm.DB, keyring *user.Keyring, discoveryService *discovery.DiscoveryService, identityService *identity.IdentityService, protocolService *protocol.ProtocolService, sessionService *session.SessionService) *ProfileService {
+	ps := &ProfileService{
+		s:                s,
+		db:               db,
+		keyring:          keyring,
+		discoveryService: discoveryService,
+		identityService:  identityService,
+		protocolService:  protocolService,
+		sessionService:   sessionService,
+		pushed:           make(map[string]int64),
+	}
+
+	sessionService.Handle("profile:update", "/api/profile/update", ps.handleProfile)
+	keyring.OnUnlock(ps.replayQueued)
+
+	return ps
+}
+
+// Crop an image to a centered square, scale it to the avatar size and encode it as a JPEG data URL
+func processAvatar(encoded string) (string, error) {
+	// accept data URLs as produced by the browser
+	if _, data, ok := strings.Cut(encoded, ","); ok && strings.HasPrefix(encoded, "data:") {
+		encoded = data
+	}
+
+	if base64.StdEncoding.DecodedLen(len(encoded)) > MAX_AVATAR_INPUT {
+		return "", errors.New("avatar too large")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.New("invalid avatar")
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(decoded))
+	if err != nil || config.Width > MAX_AVATAR_DIMENSION || config.Height > MAX_AVATAR_DIMENSION {
+		return "", errors.New("invalid avatar")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(decoded))
+	if err != nil {
+		return "", errors.New("invalid avatar")
+	}
+
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	if side == 0 {
+		return "", errors.New("invalid avatar")
+	}
+
+	origin := bounds.Min.Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+	crop := image.Rectangle{Min: origin, Max: origin.Add(image.Pt(side, side))}
+
+	// transparent areas turn white since JPEG has no alpha
+	avatar := image.NewRGBA(image.Rect(0, 0, AVATAR_SIZE, AVATAR_SIZE))
+	draw.Draw(avatar, avatar.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(avatar, avatar.Bounds(), img, crop, draw.Over, nil)
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, avatar, &jpeg.Options{Quality: AVATAR_QUALITY})
+	if err != nil {
+		return "", errors.New("failed to encode avatar")
+	}
+
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func validText(displayName, statusText string) bool {
+	return utf8.ValidString(displayName) && utf8.ValidString(statusText) &&
+		utf8.RuneCountInString(displayName) <= MAX_DISPLAY_NAME_LENGTH &&
+		utf8.RuneCountInString(statusText) <= MAX_STATUS_LENGTH
+}
+
+func (ps *ProfileService) handleProfile(peerId string, data []byte) error {
+	var input ProfileSchema
+
+	err := sonic.Unmarshal(data, &input)
+	if err != nil {
+		return errors.New("invalid profile")
+	}
+
+	input.Sender = peerId
+
+	return ps.ReceiveProfile(input)
+}
+
+// Send own profile signed and encrypted with the shared key of the contact
+func (ps *ProfileService) push(peerId string, profile user.UserModel) error {
+	update := ProfileData{
+		DisplayName: profile.DisplayName,
+		StatusText:  profile.StatusText,
+		Avatar:      profile.Avatar,
+		Version:     profile.ProfileVersion,
+	}
+
+	signature, err := ps.keyring.Sign(update.signed(profile.ID))
+	if err != nil {
+		return err
+	}
+
+	update.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	data, err := sonic.Marshal(update)
+	if err != nil {
+		return errors.New("failed to generate json")
+	}
+
+	sharedKey, err := ps.keyring.SharedKey(peerId)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := encryption.AESEncrypt(sharedKey, data)
+	if err != nil {
+		return errors.New("failed to encrypt profile")
+	}
+
+	payload := ProfileSchema{
+		Sender:  profile.ID,
+		Payload: base64.StdEncoding.EncodeToString(encrypted),
+	}
+
+	return ps.sessionService.Send(peerId, "profile:update", payload)
+}
+
+func (ps *ProfileService) PushProfiles() {
+	ticker := time.NewTicker(PROFILE_SYNC_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ps.syncProfiles()
+		case <-ps.ctx.Done():
+			return
+		}
+	}
+}
+
+// Hold a profile push of a contact until the session is unlocked, versions sort them out on replay
+func (ps *ProfileService) queue(input ProfileSchema) error {
+	var contacts int64
+
+	err := ps.db.Model(&user.ContactModel{}).Where("ID = ?", input.Sender).Count(&contacts).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	if contacts == 0 {
+		return errors.New("unknown peer")
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if len(ps.queued) >= MAX_QUEUED_PROFILES {
+		return errors.New("queue full")
+	}
+
+	ps.queued = append(ps.queued, input)
+
+	return nil
+}
+
+// Cache the profile of a contact unless a newer one is already known
+func (ps *ProfileService) ReceiveProfile(input ProfileSchema) error {
+	var data ProfileData
+	var contact user.ContactModel
+
+	if ps.keyring.Locked() {
+		return ps.queue(input)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(input.Payload)
+	if err != nil {
+		return errors.New("invalid profile")
+	}
+
+	// keys retired by a rotation still open packets sent before it
+	decrypted, err := ps.keyring.Decrypt(input.Sender, decoded)
+	if err != nil {
+		if err.Error() != "failed to decrypt" {
+			return errors.New("unknown peer")
+		}
+
+		return errors.New("invalid profile")
+	}
+
+	err = sonic.Unmarshal(decrypted, &data)
+	if err != nil || !validText(data.DisplayName, data.StatusText) {
+		return errors.New("invalid profile")
+	}
+
+	err = ps.identityService.Verify(input.Sender, identity.SIGNED_PROFILE, data.signed(input.Sender), data.Signature)
+	if err != nil {
+		return err
+	}
+
+	err = ps.db.First(&contact, "ID = ?", input.Sender).Error
+	if err != nil {
+		return errors.New("unknown peer")
+	}
+
+	// pushes may arrive out of order
+	if data.Version <= contact.ProfileVersion {
+		return nil
+	}
+
+	// avatars of contacts are normalized like our own so nothing unexpected is rendered
+	if data.Avatar != "" {
+		data.Avatar, err = processAvatar(data.Avatar)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ps.db.Model(&contact).Updates(map[string]any{
+		"display_name":    data.DisplayName,
+		"status_text":     data.StatusText,
+		"avatar":          data.Avatar,
+		"profile_version": data.Version,
+	}).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	contact.SharedKey = nil
+
+	// notify frontend subscriber for updated contact event
+	runtime.EventsEmit(ps.ctx, "contact:updated", contact)
+
+	return nil
+}
+
+// Apply profile pushes received while the session was locked in the order they arrived
+func (ps *ProfileService) replayQueued() {
+	ps.mu.Lock()
+	queued := ps.queued
+	ps.queued = nil
+	ps.mu.Unlock()
+
+	for _, input := range queued {
+		err := ps.ReceiveProfile(input)
+		if err != nil {
+			log.Println("failed to replay queued profile:", err)
+		}
+	}
+}
+
+func (ps *ProfileService) Startup(ctx context.Context) {
+	ps.ctx = ctx
+}
+
+// Push own profile to online contacts that have not received the latest version
+func (ps *ProfileService) syncProfiles() {
+	var profile user.UserModel
+
+	userId := ps.s.GetString("user:id")
+	if userId == "" {
+		return
+	}
+
+	err := ps.db.First(&profile, "ID = ?", userId).Error
+	if err != nil || profile.ProfileVersion == 0 {
+		return
+	}
+
+	peers := ps.discoveryService.GetPeers()
+	for _, peer := range peers.Data {
+		ps.mu.Lock()
+		pushed := ps.pushed[peer.ID]
+		ps.mu.Unlock()
+
+		if pushed >= profile.ProfileVersion {
+			continue
+		}
+
+		// only contacts share a key to encrypt the profile with
+		if _, err := ps.keyring.SharedKey(peer.ID); err != nil {
+			continue
+		}
+
+		if !ps.protocolService.Supports(peer.ID, protocol.FEATURE_PROFILE) {
+			continue
+		}
+
+		err = ps.push(peer.ID, profile)
+		if err != nil {
+			log.Println("failed to push profile:", err)
+			continue
+		}
+
+		ps.mu.Lock()
+		ps.pushed[peer.ID] = profile.ProfileVersion
+		ps.mu.Unlock()
+	}
+}
+
+// Update own display name, status text and avatar and push them to contacts
+func (ps *ProfileService) UpdateProfile(input UpdateProfileSchema) response.Response[user.UserProfile] {
+	var profile user.UserModel
+	var result user.UserProfile
+
+	input.DisplayName = strings.TrimSpace(input.DisplayName)
+	input.StatusText = strings.TrimSpace(input.StatusText)
+
+	if !validText(input.DisplayName, input.StatusText) {
+		return response.New(result).Status(400)
+	}
+
+	err := ps.db.First(&profile, "ID = ?", ps.s.GetString("user:id")).Error
+	if err != nil {
+		return response.New(result).Status(404)
+	}
+
+	avatar := profile.Avatar
+	if input.RemoveAvatar {
+		avatar = ""
+	} else if input.Avatar != "" {
+		avatar, err = processAvatar(input.Avatar)
+		if err != nil {
+			return response.New(result).Status(400)
+		}
+	}
+
+	profile.DisplayName = input.DisplayName
+	profile.StatusText = input.StatusText
+	profile.Avatar = avatar
+	profile.ProfileVersion++
+
+	err = ps.db.Model(&profile).Updates(map[string]any{
+		"display_name":    profile.DisplayName,
+		"status_text":     profile.StatusText,
+		"avatar":          profile.Avatar,
+		"profile_version": profile.ProfileVersion,
+	}).Error
+	if err != nil {
+		return response.New(result).Status(500)
+	}
+
+	go ps.syncProfiles()
+
+	result = user.UserProfile{
+		ID:             profile.ID,
+		Username:       profile.Username,
+		DisplayName:    profile.DisplayName,
+		StatusText:     profile.StatusText,
+		Avatar:         profile.Avatar,
+		ProfileVersion: profile.ProfileVersion,
+	}
+
+	return response.New(result)
+}
@@ -0,0 +1,21 @@
+package protocol
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type ProtocolController struct {
+	protocolService *ProtocolService
+}
+
+type IProtocolController interface {
+	GetInfo(c *fiber.Ctx) error
+}
+
+func NewProtocolController(protocolService *ProtocolService) *ProtocolController {
+	return &ProtocolController{protocolService}
+}
+
+func (pc *ProtocolController) GetInfo(c *fiber.Ctx) error {
+	return c.JSON(pc.protocolService.GetInfo())
+}
@@ -0,0 +1,62 @@
+package protocol
+
+const (
+	APP_VERSION      = "1.0.0"
+	PROTOCOL_VERSION = 2
+
+	// oldest protocol this client can still talk to, announced so newer peers can
+	// refuse this client once they drop it
+	MIN_PROTOCOL_VERSION = 1
+)
+
+// Optional capabilities announced to peers, version 1 clients announce none
+const (
+	FEATURE_DISAPPEAR = "disappear"
+	FEATURE_EDIT      = "edit"
+	FEATURE_IDENTITY  = "identity"
+	FEATURE_MESH      = "mesh"
+	FEATURE_PRESENCE  = "presence"
+	FEATURE_PROFILE   = "profile"
+	FEATURE_REACTION  = "reaction"
+	FEATURE_REPLY     = "reply"
+	FEATURE_ROTATE    = "rotate"
+	FEATURE_SESSION   = "session"
+	FEATURE_SIGNAL    = "signal"
+)
+
+var Features = []string{
+	FEATURE_DISAPPEAR,
+	FEATURE_EDIT,
+	FEATURE_IDENTITY,
+	FEATURE_MESH,
+	FEATURE_PRESENCE,
+	FEATURE_PROFILE,
+	FEATURE_REACTION,
+	FEATURE_REPLY,
+	FEATURE_ROTATE,
+	FEATURE_SESSION,
+	FEATURE_SIGNAL,
+}
+
+type InfoSchema struct {
+	Protocol    int      `json:"protocol"`
+	MinProtocol int      `json:"min_protocol,omitempty"`
+	AppVersion  string   `json:"app_version"`
+	Features    []string `json:"features"`
+}
+
+// Check both ways that the peer and this client speak a protocol the other accepts,
+// peers from before the minimum was announced accept any version
+func (is InfoSchema) Compatible() bool {
+	return is.Protocol >= MIN_PROTOCOL_VERSION && is.MinProtocol <= PROTOCOL_VERSION
+}
+
+func (is InfoSchema) Supports(feature string) bool {
+	for _, f := range is.Features {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
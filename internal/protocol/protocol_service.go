@@ -0,0 +1,174 @@
+package protocol
+
+import (
+	"chat-client/internal/discovery"
+	"chat-client/pkg/response"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// cached peer info is refreshed after this duration
+const INFO_TTL = time.Minute * 10
+
+type cachedInfo struct {
+	ip        string
+	info      InfoSchema
+	fetchedAt time.Time
+}
+
+type ProtocolService struct {
+	ctx              context.Context
+	discoveryService *discovery.DiscoveryService
+	client           *http.Client
+	cache            map[string]*cachedInfo
+	mu               sync.Mutex
+}
+
+type IProtocolService interface {
+	fetchInfo(peer discovery.PeerModel) (InfoSchema, error)
+	GetInfo() InfoSchema
+	GetPeerInfo(peerId string) response.Response[InfoSchema]
+	peerInfo(peerId string) (InfoSchema, error)
+	Require(peerId, feature string) error
+	RequireCompatible(peerId string) error
+	Startup(ctx context.Context)
+	Supports(peerId, feature string) bool
+}
+
+func NewProtocolService(discoveryService *discovery.DiscoveryService) *ProtocolService {
+	return &ProtocolService{
+		discoveryService: discoveryService,
+		client:           &http.Client{Timeout: time.Second * 5},
+		cache:            make(map[string]*cachedInfo),
+	}
+}
+
+func (ps *ProtocolService) fetchInfo(peer discovery.PeerModel) (InfoSchema, error) {
+	var result InfoSchema
+
+	url := fmt.Sprintf("http://%s:%d/api/info", peer.IP, discovery.SVC_PORT)
+	res, err := ps.client.Get(url)
+	if err != nil {
+		return result, errors.New("peer is unreachable")
+	}
+	defer res.Body.Close()
+
+	// clients before the handshake existed speak the first protocol version
+	if res.StatusCode == http.StatusNotFound {
+		return InfoSchema{Protocol: 1, Features: []string{}}, nil
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return result, errors.New("failed to get peer info")
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return result, errors.New("failed to read response body")
+	}
+
+	err = sonic.Unmarshal(body, &result)
+	if err != nil || result.Protocol < 1 {
+		return result, errors.New("failed to read response info schema")
+	}
+
+	return result, nil
+}
+
+// Get protocol info of this client
+func (ps *ProtocolService) GetInfo() InfoSchema {
+	return InfoSchema{
+		Protocol:    PROTOCOL_VERSION,
+		MinProtocol: MIN_PROTOCOL_VERSION,
+		AppVersion:  APP_VERSION,
+		Features:    Features,
+	}
+}
+
+// Get protocol info of a peer
+func (ps *ProtocolService) GetPeerInfo(peerId string) response.Response[InfoSchema] {
+	info, err := ps.peerInfo(peerId)
+	if err != nil {
+		switch err.Error() {
+		case "peer is not found":
+			return response.New(info).Status(404)
+		case "peer is unreachable":
+			return response.New(info).Status(503)
+		}
+
+		return response.New(info).Status(500)
+	}
+
+	return response.New(info)
+}
+
+// Return cached peer info, fetching it again if stale or if the peer moved
+func (ps *ProtocolService) peerInfo(peerId string) (InfoSchema, error) {
+	peer := ps.discoveryService.GetPeer(peerId)
+	if peer.IP == "" {
+		return InfoSchema{}, errors.New("peer is not found")
+	}
+
+	ps.mu.Lock()
+	cached, ok := ps.cache[peerId]
+	ps.mu.Unlock()
+
+	if ok && cached.ip == peer.IP && time.Since(cached.fetchedAt) < INFO_TTL {
+		return cached.info, nil
+	}
+
+	info, err := ps.fetchInfo(peer)
+	if err != nil {
+		return info, err
+	}
+
+	ps.mu.Lock()
+	ps.cache[peerId] = &cachedInfo{ip: peer.IP, info: info, fetchedAt: time.Now()}
+	ps.mu.Unlock()
+
+	return info, nil
+}
+
+// Return an error unless the peer announces the feature
+func (ps *ProtocolService) Require(peerId, feature string) error {
+	info, err := ps.peerInfo(peerId)
+	if err != nil {
+		return err
+	}
+
+	if !info.Compatible() || !info.Supports(feature) {
+		return errors.New("peer too old")
+	}
+
+	return nil
+}
+
+// Return an error if the peer and this client cannot talk to each other. A peer that
+// cannot be reached is reported as unreachable, not as too old
+func (ps *ProtocolService) RequireCompatible(peerId string) error {
+	info, err := ps.peerInfo(peerId)
+	if err != nil {
+		return err
+	}
+
+	if !info.Compatible() {
+		return errors.New("peer too old")
+	}
+
+	return nil
+}
+
+func (ps *ProtocolService) Startup(ctx context.Context) {
+	ps.ctx = ctx
+}
+
+func (ps *ProtocolService) Supports(peerId, feature string) bool {
+	return ps.Require(peerId, feature) == nil
+}
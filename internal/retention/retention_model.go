@@ -0,0 +1,34 @@
+package retention
+
+import "time"
+
+const (
+	// key of the policy every conversation falls back to
+	DEFAULT_POLICY = "default"
+
+	// how often policies are enforced
+	RETENTION_PERIOD = time.Hour
+
+	// messages deleted per statement
+	PRUNE_BATCH = 500
+)
+
+// Retention limits of a conversation. Limits left nil in a contact override fall back
+// to the default policy, zero means unlimited. The quota is only read from the default
+// policy and bounds the stored message content of all conversations together
+type RetentionPolicyModel struct {
+	PeerID      string    `json:"peer_id" gorm:"primaryKey"`
+	MaxAgeDays  *int      `json:"max_age_days"`
+	MaxMessages *int      `json:"max_messages"`
+	QuotaMB     *int64    `json:"quota_mb"`
+	UpdatedAt   time.Time `json:"-"`
+}
+
+// Messages removed by a retention run and the space returned to the file system
+type RetentionReport struct {
+	Expired    int64  `json:"expired"`
+	Trimmed    int64  `json:"trimmed"`
+	OverQuota  int64  `json:"over_quota"`
+	FreedBytes int64  `json:"freed_bytes"`
+	RanAt      string `json:"ran_at"`
+}
@@ -0,0 +1,369 @@
+package retention
+
+import (
+	"chat-client/internal/chat"
+	"chat-client/internal/user"
+	"chat-client/pkg/response"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+type RetentionService struct {
+	ctx context.Context
+	db  *gorm.DB
+	mu  sync.Mutex
+}
+
+type IRetentionService interface {
+	chatSize() (int64, error)
+	DeleteRetentionPolicy(peerId string) response.Response[bool]
+	deleteChats(ids []uint64) (int64, error)
+	enforce() (RetentionReport, error)
+	EnforcePolicies()
+	fileSize() int64
+	GetRetentionPolicies() response.Response[[]RetentionPolicyModel]
+	RunRetention() response.Response[RetentionReport]
+	SetRetentionPolicy(policy RetentionPolicyModel) response.Response[RetentionPolicyModel]
+	Startup(ctx context.Context)
+	vacuum() error
+}
+
+func NewRetentionService(db *gorm.DB) *RetentionService {
+	return &RetentionService{db: db}
+}
+
+// Resolve a limit of a contact override, falling back to the default policy
+func limit(override, fallback *int) int {
+	if override != nil {
+		return *override
+	}
+
+	if fallback != nil {
+		return *fallback
+	}
+
+	return 0
+}
+
+// Size of the stored message content including edit history
+func (rs *RetentionService) chatSize() (int64, error) {
+	var size int64
+
+	err := rs.db.Raw(`SELECT
+		(SELECT COALESCE(SUM(LENGTH(message)), 0) FROM chat_models) +
+		(SELECT COALESCE(SUM(LENGTH(message)), 0) FROM chat_revision_models)`).Scan(&size).Error
+
+	return size, err
+}
+
+// Remove the override of a contact so the default policy applies again
+func (rs *RetentionService) DeleteRetentionPolicy(peerId string) response.Response[bool] {
+	if peerId == DEFAULT_POLICY {
+		return response.New(false).Status(400)
+	}
+
+	err := rs.db.Delete(&RetentionPolicyModel{}, "peer_id = ?", peerId).Error
+	if err != nil {
+		return response.New(false).Status(500)
+	}
+
+	return response.New(true)
+}
+
+// Delete messages with their revisions and reactions
+func (rs *RetentionService) deleteChats(ids []uint64) (int64, error) {
+	var deleted int64
+
+	for start := 0; start < len(ids); start += PRUNE_BATCH {
+		batch := ids[start:min(start+PRUNE_BATCH, len(ids))]
+
+		err := rs.db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Delete(&chat.ChatRevisionModel{}, "chat_id IN ?", batch).Error
+			if err != nil {
+				return err
+			}
+
+			err = tx.Delete(&chat.ReactionModel{}, "chat_id IN ?", batch).Error
+			if err != nil {
+				return err
+			}
+
+			res := tx.Delete(&chat.ChatModel{}, "id IN ?", batch)
+			deleted += res.RowsAffected
+
+			return res.Error
+		})
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// Prune messages by age, count per conversation and total quota, oldest first
+func (rs *RetentionService) enforce() (RetentionReport, error) {
+	var policies []RetentionPolicyModel
+	var contacts []user.ContactModel
+	var ids []uint64
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	report := RetentionReport{RanAt: time.Now().Format(time.RFC3339)}
+	sizeBefore := rs.fileSize()
+
+	err := rs.db.Find(&policies).Error
+	if err != nil {
+		return report, errors.New("db error")
+	}
+
+	err = rs.db.Find(&contacts).Error
+	if err != nil {
+		return report, errors.New("db error")
+	}
+
+	defaults := RetentionPolicyModel{PeerID: DEFAULT_POLICY}
+	overrides := make(map[string]RetentionPolicyModel)
+	for _, policy := range policies {
+		if policy.PeerID == DEFAULT_POLICY {
+			defaults = policy
+		} else {
+			overrides[policy.PeerID] = policy
+		}
+	}
+
+	for _, contact := range contacts {
+		override := overrides[contact.ID]
+
+		maxAge := limit(override.MaxAgeDays, defaults.MaxAgeDays)
+		if maxAge > 0 {
+			ids = nil
+			cutoff := time.Now().AddDate(0, 0, -maxAge)
+
+			err = rs.db.Model(&chat.ChatModel{}).Where("peer_id = ? AND created_at < ?", contact.ID, cutoff).Pluck("id", &ids).Error
+			if err != nil {
+				return report, errors.New("db error")
+			}
+
+			count, err := rs.deleteChats(ids)
+			report.Expired += count
+			if err != nil {
+				return report, errors.New("db error")
+			}
+		}
+
+		maxMessages := limit(override.MaxMessages, defaults.MaxMessages)
+		if maxMessages > 0 {
+			ids = nil
+
+			// everything past the newest messages that are kept
+			err = rs.db.Model(&chat.ChatModel{}).Where("peer_id = ?", contact.ID).Order("id DESC").Offset(maxMessages).Limit(-1).Pluck("id", &ids).Error
+			if err != nil {
+				return report, errors.New("db error")
+			}
+
+			count, err := rs.deleteChats(ids)
+			report.Trimmed += count
+			if err != nil {
+				return report, errors.New("db error")
+			}
+		}
+	}
+
+	if defaults.QuotaMB != nil && *defaults.QuotaMB > 0 {
+		used, err := rs.chatSize()
+		if err != nil {
+			return report, errors.New("db error")
+		}
+
+		excess := used - *defaults.QuotaMB*1024*1024
+		for excess > 0 {
+			var oldest []struct {
+				ID   uint64
+				Size int64
+			}
+
+			err = rs.db.Raw(`SELECT id, LENGTH(message) +
+				(SELECT COALESCE(SUM(LENGTH(r.message)), 0) FROM chat_revision_models r WHERE r.chat_id = chat_models.id) AS size
+				FROM chat_models ORDER BY id LIMIT ?`, PRUNE_BATCH).Scan(&oldest).Error
+			if err != nil {
+				return report, errors.New("db error")
+			}
+
+			if len(oldest) == 0 {
+				break
+			}
+
+			ids = nil
+			for _, row := range oldest {
+				if excess <= 0 {
+					break
+				}
+
+				ids = append(ids, row.ID)
+				excess -= row.Size
+			}
+
+			count, err := rs.deleteChats(ids)
+			report.OverQuota += count
+			if err != nil {
+				return report, errors.New("db error")
+			}
+		}
+	}
+
+	if report.Expired+report.Trimmed+report.OverQuota == 0 {
+		return report, nil
+	}
+
+	// unread counters may include pruned messages
+	err = rs.db.Exec(`UPDATE conversation_models SET unread = (
+		SELECT COUNT(*) FROM chat_models c WHERE c.peer_id = conversation_models.peer_id
+			AND c.sender = conversation_models.peer_id AND c.id > conversation_models.last_read_id AND c.deleted = false
+	)`).Error
+	if err != nil {
+		log.Println("failed to recount unread messages:", err)
+	}
+
+	err = rs.vacuum()
+	if err != nil {
+		log.Println("failed to vacuum database:", err)
+	}
+
+	report.FreedBytes = max(sizeBefore-rs.fileSize(), 0)
+
+	return report, nil
+}
+
+func (rs *RetentionService) EnforcePolicies() {
+	ticker := time.NewTicker(RETENTION_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		rs.RunRetention()
+
+		select {
+		case <-ticker.C:
+		case <-rs.ctx.Done():
+			return
+		}
+	}
+}
+
+// Size of the database file in bytes
+func (rs *RetentionService) fileSize() int64 {
+	var pageCount, pageSize int64
+
+	rs.db.Raw("PRAGMA page_count").Scan(&pageCount)
+	rs.db.Raw("PRAGMA page_size").Scan(&pageSize)
+
+	return pageCount * pageSize
+}
+
+// Get the default policy followed by the contact overrides
+func (rs *RetentionService) GetRetentionPolicies() response.Response[[]RetentionPolicyModel] {
+	var policies []RetentionPolicyModel
+
+	err := rs.db.Order("peer_id").Find(&policies).Error
+	if err != nil {
+		return response.New(policies).Status(500)
+	}
+
+	results := []RetentionPolicyModel{{PeerID: DEFAULT_POLICY}}
+	for _, policy := range policies {
+		if policy.PeerID == DEFAULT_POLICY {
+			results[0] = policy
+		} else {
+			results = append(results, policy)
+		}
+	}
+
+	return response.New(results)
+}
+
+// Enforce retention policies now and report what was removed
+func (rs *RetentionService) RunRetention() response.Response[RetentionReport] {
+	report, err := rs.enforce()
+	if err != nil {
+		log.Println("failed to enforce retention policies:", err)
+		return response.New(report).Status(500)
+	}
+
+	if report.Expired+report.Trimmed+report.OverQuota > 0 {
+		log.Printf("Retention removed %d expired, %d trimmed and %d over quota messages, freeing %d bytes\n",
+			report.Expired, report.Trimmed, report.OverQuota, report.FreedBytes)
+
+		// notify frontend subscriber for pruned history event
+		runtime.EventsEmit(rs.ctx, "retention:report", report)
+	}
+
+	return response.New(report)
+}
+
+// Save the default policy or the override of a contact
+func (rs *RetentionService) SetRetentionPolicy(policy RetentionPolicyModel) response.Response[RetentionPolicyModel] {
+	if policy.PeerID == "" {
+		policy.PeerID = DEFAULT_POLICY
+	}
+
+	if (policy.MaxAgeDays != nil && *policy.MaxAgeDays < 0) ||
+		(policy.MaxMessages != nil && *policy.MaxMessages < 0) ||
+		(policy.QuotaMB != nil && *policy.QuotaMB < 0) {
+		return response.New(policy).Status(400)
+	}
+
+	if policy.PeerID != DEFAULT_POLICY {
+		var contact user.ContactModel
+
+		err := rs.db.First(&contact, "ID = ?", policy.PeerID).Error
+		if err != nil {
+			return response.New(policy).Status(404)
+		}
+
+		// the quota is shared by all conversations
+		policy.QuotaMB = nil
+	}
+
+	err := rs.db.Save(&policy).Error
+	if err != nil {
+		return response.New(policy).Status(500)
+	}
+
+	return response.New(policy)
+}
+
+func (rs *RetentionService) Startup(ctx context.Context) {
+	rs.ctx = ctx
+}
+
+// Return free pages to the file system. Databases created before incremental vacuum
+// was enabled are converted with a full vacuum once
+func (rs *RetentionService) vacuum() error {
+	return rs.db.Connection(func(tx *gorm.DB) error {
+		var mode int
+
+		err := tx.Raw("PRAGMA auto_vacuum").Scan(&mode).Error
+		if err != nil {
+			return err
+		}
+
+		// 2 is incremental
+		if mode != 2 {
+			err = tx.Exec("PRAGMA auto_vacuum = INCREMENTAL").Error
+			if err != nil {
+				return err
+			}
+
+			return tx.Exec("VACUUM").Error
+		}
+
+		return tx.Exec("PRAGMA incremental_vacuum").Error
+	})
+}
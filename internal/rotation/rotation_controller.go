@@ -0,0 +1,48 @@
+package rotation
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RotationController struct {
+	rotationService *RotationService
+}
+
+type IRotationController interface {
+	ReceiveRotate(c *fiber.Ctx) error
+}
+
+func NewRotationController(rotationService *RotationService) *RotationController {
+	return &RotationController{rotationService}
+}
+
+func (rc *RotationController) ReceiveRotate(c *fiber.Ctx) error {
+	var input RotateSchema
+
+	err := c.BodyParser(&input)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid rotation"})
+	}
+
+	err = rc.rotationService.ReceiveRotate(input)
+	if err != nil {
+		switch err.Error() {
+		case "unknown peer":
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case "signature missing", "invalid signature":
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		case "rotation in progress", "unknown offer", "key already rotated":
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		case "session locked":
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		default:
+			log.Println(err)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid rotation"})
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "rotation received successfully"})
+}
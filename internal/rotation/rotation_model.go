@@ -0,0 +1,47 @@
+package rotation
+
+import "time"
+
+const (
+	// how often contacts are checked for a due rotation
+	ROTATE_PERIOD = time.Minute
+
+	// a shared key is rotated after this many messages or once it is this old
+	ROTATE_MESSAGES = 1000
+	ROTATE_AGE      = time.Hour * 24 * 7
+
+	// how long an offer waits for its answer, older offers and answers are dropped
+	OFFER_TTL = time.Minute
+)
+
+// Rotation packet, payload is the RotateData encrypted with the current shared key
+type RotateSchema struct {
+	Sender  string `json:"sender" validate:"required,alphanum"`
+	Payload string `json:"payload" validate:"required,base64"`
+}
+
+// Ephemeral public key offered for a new shared key, or accepting an offer with the
+// same key ID. The signature of the sender's identity key covers every other field
+type RotateData struct {
+	KeyID     string `json:"key_id"`
+	Pubkey    string `json:"pubkey"`
+	Accept    bool   `json:"accept"`
+	SentAt    string `json:"sent_at"`
+	Signature string `json:"signature"`
+}
+
+// Rotation state of the shared key with a contact
+type RotationStatus struct {
+	PeerID    string `json:"peer_id"`
+	KeyID     string `json:"key_id"`
+	RotatedAt string `json:"rotated_at"`
+	Messages  int64  `json:"messages"`
+	Retired   int64  `json:"retired"`
+	Pending   bool   `json:"pending"`
+}
+
+// Emitted with key:rotated once both ends switched to the new shared key
+type RotatedEvent struct {
+	PeerID string `json:"peer_id"`
+	KeyID  string `json:"key_id"`
+}
@@ -0,0 +1,518 @@
+package rotation
+
+import (
+	"chat-client/internal/chat"
+	"chat-client/internal/discovery"
+	"chat-client/internal/identity"
+	"chat-client/internal/protocol"
+	"chat-client/internal/session"
+	"chat-client/internal/user"
+	"chat-client/pkg/encryption"
+	"chat-client/pkg/response"
+	"chat-client/pkg/store"
+	"context"
+	"crypto/ecdh"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/oklog/ulid/v2"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// RotationService replaces the shared key of contacts with one agreed over a fresh
+// ephemeral key exchange, authenticated by both identity keys
+type RotationService struct {
+	ctx              context.Context
+	db               *gorm.DB
+	s                *store.Store
+	keyring          *user.Keyring
+	discoveryService *discovery.DiscoveryService
+	identityService  *identity.IdentityService
+	protocolService  *protocol.ProtocolService
+	sessionService   *session.SessionService
+	userService      *user.UserService
+	pending          map[string]rotateOffer
+	mu               sync.Mutex
+}
+
+// Offer sent to a contact, waiting for the answer
+type rotateOffer struct {
+	keyId  string
+	priv   *ecdh.PrivateKey
+	sentAt time.Time
+}
+
+type IRotationService interface {
+	accept(peerId string, data RotateData, remote *ecdh.PublicKey) error
+	answer(peerId string, data RotateData, remote *ecdh.PublicKey)
+	due(contact user.ContactModel) bool
+	GetRotation(peerId string) response.Response[RotationStatus]
+	handleRotate(peerId string, data []byte) error
+	offer(peerId string) error
+	pendingOffer(peerId string) bool
+	ReceiveRotate(input RotateSchema) error
+	rotated(peerId, keyId string)
+	RotateKey(peerId string) response.Response[RotationStatus]
+	send(peerId string, data RotateData) error
+	Startup(ctx context.Context)
+	status(peerId string) (RotationStatus, error)
+	syncRotation()
+	WatchRotation()
+}
+
+func NewRotationService(s *store.Store, db *gorm.DB, keyring *user.Keyring, discoveryService *discovery.DiscoveryService, identityService *identity.IdentityService, protocolService *protocol.ProtocolService, sessionService *session.SessionService, userService *user.UserService) *RotationService {
+	rs := &RotationService{
+		s:                s,
+		db:               db,
+		keyring:          keyring,
+		discoveryService: discoveryService,
+		identityService:  identityService,
+		protocolService:  protocolService,
+		sessionService:   sessionService,
+		userService:      userService,
+		pending:          make(map[string]rotateOffer),
+	}
+
+	sessionService.Handle("key:rotate", "/api/key/rotate", rs.handleRotate)
+
+	return rs
+}
+
+// Bytes signed by the sender, bound to both ends so a packet cannot be replayed to another contact
+func rotatePayload(sender, recipient string, data RotateData) []byte {
+	return []byte("rotate\x00" + sender + "\x00" + recipient + "\x00" + data.KeyID + "\x00" + data.Pubkey + "\x00" +
+		strconv.FormatBool(data.Accept) + "\x00" + data.SentAt)
+}
+
+func statusOf(err error) int {
+	switch err.Error() {
+	case "peer is not found":
+		return 404
+	case "rotation in progress", "key already rotated", "identity key unknown":
+		return 409
+	case "peer too old":
+		return 426
+	case "peer is offline", "peer is unreachable", "session locked":
+		return 503
+	default:
+		return 500
+	}
+}
+
+// Switch to the key agreed with our pending offer once the contact accepted it
+func (rs *RotationService) accept(peerId string, data RotateData, remote *ecdh.PublicKey) error {
+	rs.mu.Lock()
+	pending, ok := rs.pending[peerId]
+	if ok && pending.keyId == data.KeyID {
+		delete(rs.pending, peerId)
+	}
+	rs.mu.Unlock()
+
+	if !ok || pending.keyId != data.KeyID || time.Since(pending.sentAt) > OFFER_TTL {
+		var contact user.ContactModel
+
+		// an accept is sent again when its acknowledgement got lost, the contact only switches
+		// keys once it is acknowledged so the offer it already completed is acknowledged again
+		err := rs.db.First(&contact, "ID = ?", peerId).Error
+		if err == nil && contact.KeyID == data.KeyID {
+			return nil
+		}
+
+		return errors.New("unknown offer")
+	}
+
+	shared, err := encryption.GenerateSharedKey(pending.priv, remote)
+	if err != nil {
+		return errors.New("invalid rotation")
+	}
+	defer clear(shared)
+
+	err = rs.keyring.Rotate(peerId, data.KeyID, shared)
+	if err != nil {
+		return err
+	}
+
+	rs.rotated(peerId, data.KeyID)
+
+	return nil
+}
+
+// Accept an offer of a contact. The new key is only taken once the contact
+// acknowledged the answer, until then both ends keep using the current one
+func (rs *RotationService) answer(peerId string, data RotateData, remote *ecdh.PublicKey) {
+	priv, err := encryption.GeneratePrivateKey()
+	if err != nil {
+		log.Println("failed to answer rotation:", err)
+		return
+	}
+
+	shared, err := encryption.GenerateSharedKey(priv, remote)
+	if err != nil {
+		log.Println("failed to answer rotation:", err)
+		return
+	}
+	defer clear(shared)
+
+	err = rs.send(peerId, RotateData{
+		KeyID:  data.KeyID,
+		Pubkey: base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes()),
+		Accept: true,
+	})
+	if err != nil {
+		log.Println("failed to answer rotation:", err)
+		return
+	}
+
+	err = rs.keyring.Rotate(peerId, data.KeyID, shared)
+	if err != nil {
+		log.Println("failed to rotate key:", err)
+		return
+	}
+
+	rs.rotated(peerId, data.KeyID)
+}
+
+// Check whether the shared key with a contact carried enough messages or is old enough to rotate
+func (rs *RotationService) due(contact user.ContactModel) bool {
+	var messages int64
+
+	// keys from before rotation have no age and are rotated right away
+	if contact.KeyRotatedAt == nil || time.Since(*contact.KeyRotatedAt) >= ROTATE_AGE {
+		return true
+	}
+
+	err := rs.db.Model(&chat.ChatModel{}).Where("peer_id = ? AND created_at > ?", contact.ID, *contact.KeyRotatedAt).Count(&messages).Error
+	if err != nil {
+		return false
+	}
+
+	return messages >= ROTATE_MESSAGES
+}
+
+// Get the rotation state of the shared key with a contact
+func (rs *RotationService) GetRotation(peerId string) response.Response[RotationStatus] {
+	result, err := rs.status(peerId)
+	if err != nil {
+		return response.New(result).Status(statusOf(err))
+	}
+
+	return response.New(result)
+}
+
+func (rs *RotationService) handleRotate(peerId string, data []byte) error {
+	var input RotateSchema
+
+	err := sonic.Unmarshal(data, &input)
+	if err != nil {
+		return errors.New("invalid rotation")
+	}
+
+	input.Sender = peerId
+
+	return rs.ReceiveRotate(input)
+}
+
+// Offer a fresh ephemeral key to a contact, the shared key changes once it is accepted
+func (rs *RotationService) offer(peerId string) error {
+	if rs.keyring.Locked() {
+		return errors.New("session locked")
+	}
+
+	priv, err := encryption.GeneratePrivateKey()
+	if err != nil {
+		return err
+	}
+
+	pending := rotateOffer{keyId: ulid.Make().String(), priv: priv, sentAt: time.Now()}
+
+	rs.mu.Lock()
+	if current, ok := rs.pending[peerId]; ok && time.Since(current.sentAt) <= OFFER_TTL {
+		rs.mu.Unlock()
+		return errors.New("rotation in progress")
+	}
+	rs.pending[peerId] = pending
+	rs.mu.Unlock()
+
+	err = rs.send(peerId, RotateData{
+		KeyID:  pending.keyId,
+		Pubkey: base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes()),
+	})
+	if err != nil {
+		rs.mu.Lock()
+		if rs.pending[peerId].keyId == pending.keyId {
+			delete(rs.pending, peerId)
+		}
+		rs.mu.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+func (rs *RotationService) pendingOffer(peerId string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	pending, ok := rs.pending[peerId]
+
+	return ok && time.Since(pending.sentAt) <= OFFER_TTL
+}
+
+// Handle an offer or answer of a contact, sent over the current shared key and
+// signed with its identity key
+func (rs *RotationService) ReceiveRotate(input RotateSchema) error {
+	var data RotateData
+	var contact user.ContactModel
+
+	decoded, err := base64.StdEncoding.DecodeString(input.Payload)
+	if err != nil {
+		return errors.New("invalid rotation")
+	}
+
+	err = rs.db.First(&contact, "ID = ?", input.Sender).Error
+	if err != nil {
+		return errors.New("unknown peer")
+	}
+
+	// rotations are never taken unsigned, keys of contacts without an identity key stay as paired
+	if len(contact.SignKey) == 0 {
+		return errors.New("signature missing")
+	}
+
+	// keys retired by a rotation still open packets sent before it
+	decrypted, err := rs.keyring.Decrypt(input.Sender, decoded)
+	if err != nil {
+		switch err.Error() {
+		case "failed to decrypt":
+			return errors.New("invalid rotation")
+		case "session locked":
+			return err
+		default:
+			return errors.New("unknown peer")
+		}
+	}
+
+	err = sonic.Unmarshal(decrypted, &data)
+	if err != nil {
+		return errors.New("invalid rotation")
+	}
+
+	userId := rs.s.GetString("user:id")
+
+	err = rs.identityService.Verify(input.Sender, identity.SIGNED_ROTATE, rotatePayload(input.Sender, userId, data), data.Signature)
+	if err != nil {
+		return err
+	}
+
+	// a replayed packet would switch to a key whose private half is long gone
+	sentAt, err := time.Parse(time.RFC3339, data.SentAt)
+	if err != nil || time.Since(sentAt) > OFFER_TTL || time.Until(sentAt) > OFFER_TTL {
+		return errors.New("invalid rotation")
+	}
+
+	pubkey, err := base64.StdEncoding.DecodeString(data.Pubkey)
+	if err != nil {
+		return errors.New("invalid rotation")
+	}
+
+	remote, err := ecdh.P256().NewPublicKey(pubkey)
+	if err != nil {
+		return errors.New("invalid rotation")
+	}
+
+	if data.Accept {
+		return rs.accept(input.Sender, data, remote)
+	}
+
+	// both ends offered at once, the offer of the lower user ID wins
+	rs.mu.Lock()
+	if pending, ok := rs.pending[input.Sender]; ok && time.Since(pending.sentAt) <= OFFER_TTL {
+		if userId < input.Sender {
+			rs.mu.Unlock()
+			return errors.New("rotation in progress")
+		}
+
+		delete(rs.pending, input.Sender)
+	}
+	rs.mu.Unlock()
+
+	// answered outside the handler, the contact acknowledges the answer only after switching keys
+	go rs.answer(input.Sender, data, remote)
+
+	return nil
+}
+
+func (rs *RotationService) rotated(peerId, keyId string) {
+	// notify frontend subscriber for rotated key event
+	runtime.EventsEmit(rs.ctx, "key:rotated", RotatedEvent{PeerID: peerId, KeyID: keyId})
+
+	// the other devices of the user need the new key to keep talking to the contact
+	go rs.userService.SyncContact(peerId)
+}
+
+// Rotate the shared key with a contact now
+func (rs *RotationService) RotateKey(peerId string) response.Response[RotationStatus] {
+	var contact user.ContactModel
+
+	err := rs.db.First(&contact, "ID = ?", peerId).Error
+	if err != nil {
+		return response.New(RotationStatus{}).Status(404)
+	}
+
+	// the exchange is only authenticated once the identity key of the contact is known
+	if len(contact.SignKey) == 0 {
+		return response.New(RotationStatus{}).Status(statusOf(errors.New("identity key unknown")))
+	}
+
+	if peer := rs.discoveryService.GetPeer(peerId); peer.IP == "" {
+		return response.New(RotationStatus{}).Status(statusOf(errors.New("peer is offline")))
+	}
+
+	err = rs.protocolService.Require(peerId, protocol.FEATURE_ROTATE)
+	if err != nil {
+		return response.New(RotationStatus{}).Status(statusOf(err))
+	}
+
+	err = rs.offer(peerId)
+	if err != nil {
+		log.Println("failed to rotate key:", err)
+		return response.New(RotationStatus{}).Status(statusOf(err))
+	}
+
+	result, err := rs.status(peerId)
+	if err != nil {
+		return response.New(result).Status(statusOf(err))
+	}
+
+	return response.New(result)
+}
+
+// Sign data, encrypt it with the current shared key and send it to a contact
+func (rs *RotationService) send(peerId string, data RotateData) error {
+	userId := rs.s.GetString("user:id")
+	if userId == "" {
+		return errors.New("user not found")
+	}
+
+	data.SentAt = time.Now().Format(time.RFC3339)
+
+	signature, err := rs.keyring.Sign(rotatePayload(userId, peerId, data))
+	if err != nil {
+		return err
+	}
+
+	data.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	payload, err := sonic.Marshal(data)
+	if err != nil {
+		return errors.New("failed to generate json")
+	}
+
+	sharedKey, err := rs.keyring.SharedKey(peerId)
+	if err != nil {
+		return err
+	}
+	defer clear(sharedKey)
+
+	encrypted, err := encryption.AESEncrypt(sharedKey, payload)
+	if err != nil {
+		return errors.New("failed to encrypt rotation")
+	}
+
+	return rs.sessionService.Send(peerId, "key:rotate", RotateSchema{
+		Sender:  userId,
+		Payload: base64.StdEncoding.EncodeToString(encrypted),
+	})
+}
+
+func (rs *RotationService) Startup(ctx context.Context) {
+	rs.ctx = ctx
+}
+
+func (rs *RotationService) status(peerId string) (RotationStatus, error) {
+	var contact user.ContactModel
+
+	result := RotationStatus{PeerID: peerId}
+
+	err := rs.db.First(&contact, "ID = ?", peerId).Error
+	if err != nil {
+		return result, errors.New("peer is not found")
+	}
+
+	result.KeyID = contact.KeyID
+	result.Pending = rs.pendingOffer(peerId)
+
+	query := rs.db.Model(&chat.ChatModel{}).Where("peer_id = ?", peerId)
+	if contact.KeyRotatedAt != nil {
+		result.RotatedAt = contact.KeyRotatedAt.Format(time.RFC3339)
+		query = query.Where("created_at > ?", *contact.KeyRotatedAt)
+	}
+
+	err = query.Count(&result.Messages).Error
+	if err != nil {
+		return result, err
+	}
+
+	err = rs.db.Model(&user.RetiredKeyModel{}).Where("contact_id = ?", peerId).Count(&result.Retired).Error
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Offer new keys to online contacts whose key is due, the lower user ID of a pair offers
+func (rs *RotationService) syncRotation() {
+	var contacts []user.ContactModel
+
+	userId := rs.s.GetString("user:id")
+	if userId == "" || rs.keyring.Locked() || rs.s.Get("key:sign") == nil {
+		return
+	}
+
+	err := rs.db.Where("ID > ? AND sign_key IS NOT NULL AND length(sign_key) > 0", userId).Find(&contacts).Error
+	if err != nil {
+		return
+	}
+
+	for _, contact := range contacts {
+		if !rs.due(contact) || rs.pendingOffer(contact.ID) {
+			continue
+		}
+
+		if peer := rs.discoveryService.GetPeer(contact.ID); peer.IP == "" {
+			continue
+		}
+
+		if !rs.protocolService.Supports(contact.ID, protocol.FEATURE_ROTATE) {
+			continue
+		}
+
+		err = rs.offer(contact.ID)
+		if err != nil {
+			log.Println("failed to rotate key:", err)
+		}
+	}
+}
+
+// Rotate shared keys of online contacts once they carried enough messages or grew old
+func (rs *RotationService) WatchRotation() {
+	ticker := time.NewTicker(ROTATE_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rs.syncRotation()
+		case <-rs.ctx.Done():
+			return
+		}
+	}
+}
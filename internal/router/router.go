@@ -2,6 +2,13 @@ package router
 
 import (
 	"chat-client/internal/chat"
+	"chat-client/internal/identity"
+	"chat-client/internal/mesh"
+	"chat-client/internal/presence"
+	"chat-client/internal/profile"
+	"chat-client/internal/protocol"
+	"chat-client/internal/rotation"
+	"chat-client/internal/session"
 	"chat-client/internal/user"
 
 	"github.com/bytedance/sonic"
@@ -9,9 +16,16 @@ import (
 )
 
 type Router struct {
-	app            *fiber.App
-	chatController *chat.ChatController
-	userController *user.UserController
+	app                *fiber.App
+	chatController     *chat.ChatController
+	userController     *user.UserController
+	identityController *identity.IdentityController
+	meshController     *mesh.MeshController
+	presenceController *presence.PresenceController
+	profileController  *profile.ProfileController
+	protocolController *protocol.ProtocolController
+	rotationController *rotation.RotationController
+	sessionController  *session.SessionController
 }
 
 type IRouter interface {
@@ -25,16 +39,39 @@ func DefaultConfig() fiber.Config {
 	}
 }
 
-func NewRouter(app *fiber.App, chatController *chat.ChatController, userController *user.UserController) *Router {
-	return &Router{app, chatController, userController}
+func NewRouter(app *fiber.App, chatController *chat.ChatController, userController *user.UserController, identityController *identity.IdentityController, meshController *mesh.MeshController, presenceController *presence.PresenceController, profileController *profile.ProfileController, protocolController *protocol.ProtocolController, rotationController *rotation.RotationController, sessionController *session.SessionController) *Router {
+	return &Router{app, chatController, userController, identityController, meshController, presenceController, profileController, protocolController, rotationController, sessionController}
 }
 
 func (r *Router) Handle() {
 	api := r.app.Group("/api")
+	api.Get("/info", r.protocolController.GetInfo)
 
 	chatRouter := api.Group("/chat")
 	chatRouter.Post("/send", r.chatController.CreateChat)
+	chatRouter.Post("/signal", r.chatController.ReceiveSignal)
+	chatRouter.Post("/sync", r.chatController.ReceiveSync)
 
 	userRouter := api.Group("/user")
 	userRouter.Post("/pair", r.userController.HandleUserPairing)
+	userRouter.Post("/link", r.userController.HandleDeviceLink)
+	userRouter.Post("/contact", r.userController.ReceiveContact)
+
+	identityRouter := api.Group("/identity")
+	identityRouter.Post("/rekey", r.identityController.ReceiveRekey)
+
+	keyRouter := api.Group("/key")
+	keyRouter.Post("/rotate", r.rotationController.ReceiveRotate)
+
+	meshRouter := api.Group("/mesh")
+	meshRouter.Post("/forward", r.chatController.ReceiveEnvelope)
+	meshRouter.Post("/routes", r.meshController.ReceiveRoutes)
+
+	presenceRouter := api.Group("/presence")
+	presenceRouter.Post("/update", r.presenceController.ReceivePresence)
+
+	profileRouter := api.Group("/profile")
+	profileRouter.Post("/update", r.profileController.ReceiveProfile)
+
+	api.Get("/session", r.sessionController.HandleSession)
 }
@@ -0,0 +1,33 @@
+package session
+
+import (
+	"net/http"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+type SessionController struct {
+	sessionService *SessionService
+	upgrader       fiber.Handler
+}
+
+type ISessionController interface {
+	HandleSession(c *fiber.Ctx) error
+}
+
+func NewSessionController(sessionService *SessionService) *SessionController {
+	upgrader := websocket.New(func(c *websocket.Conn) {
+		sessionService.Accept(c.Conn)
+	}, websocket.Config{HandshakeTimeout: HANDSHAKE_WAIT})
+
+	return &SessionController{sessionService, upgrader}
+}
+
+func (sc *SessionController) HandleSession(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(http.StatusUpgradeRequired).JSON(fiber.Map{"error": "websocket upgrade required"})
+	}
+
+	return sc.upgrader(c)
+}
@@ -0,0 +1,27 @@
+package session
+
+import "encoding/json"
+
+type FrameSchema struct {
+	Type string          `json:"type"`
+	ID   string          `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+type ChallengeSchema struct {
+	Nonce string `json:"nonce"`
+}
+
+// Proof is the challenge nonce of the other side encrypted with the shared key, or
+// with the sync key between devices of the same user. Device is empty for clients
+// from before linking
+type HelloSchema struct {
+	Sender string `json:"sender"`
+	Device string `json:"device,omitempty"`
+	Nonce  string `json:"nonce,omitempty"`
+	Proof  string `json:"proof"`
+}
+
+type AckSchema struct {
+	Error string `json:"error,omitempty"`
+}
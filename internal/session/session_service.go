@@ -0,0 +1,828 @@
+package session
+
+import (
+	"bytes"
+	"chat-client/internal/discovery"
+	"chat-client/internal/protocol"
+	"chat-client/pkg/encryption"
+	"chat-client/pkg/response"
+	"chat-client/pkg/store"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/fasthttp/websocket"
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	SESSION_PATH    = "/api/session"
+	HANDSHAKE_WAIT  = time.Second * 5
+	WRITE_WAIT      = time.Second * 10
+	ACK_WAIT        = time.Second * 10
+	PING_PERIOD     = time.Second * 15
+	PONG_WAIT       = time.Second * 45
+	MAINTAIN_PERIOD = time.Second * 10
+	MAX_BACKOFF     = time.Minute * 2
+	MAX_FRAME_SIZE  = 1 << 20
+
+	// frames queued per session before senders fall back to http
+	SEND_BUFFER = 64
+)
+
+// KeyProvider resolves the shared key used to authenticate a peer
+type KeyProvider interface {
+	Decrypt(peerId string, data []byte) ([]byte, error)
+	SharedKey(peerId string) ([]byte, error)
+	SyncKey() ([]byte, error)
+}
+
+// HandlerFunc handles a frame received from an authenticated peer
+type HandlerFunc func(peerId string, data []byte) error
+
+type peerSession struct {
+	peerId  string
+	device  string
+	dialer  string
+	conn    *websocket.Conn
+	send    chan FrameSchema
+	pending map[string]chan AckSchema
+	done    chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+}
+
+type retry struct {
+	delay time.Duration
+	at    time.Time
+}
+
+type SessionService struct {
+	ctx              context.Context
+	s                *store.Store
+	keyring          KeyProvider
+	discoveryService *discovery.DiscoveryService
+	protocolService  *protocol.ProtocolService
+	sessions         map[string]*peerSession
+	handlers         map[string]HandlerFunc
+	routes           map[string]string
+	retries          map[string]*retry
+	client           *http.Client
+	dialer           *websocket.Dialer
+	mu               sync.Mutex
+}
+
+type ISessionService interface {
+	Accept(conn *websocket.Conn)
+	backoff(peerId string)
+	CloseAll()
+	connect(peer discovery.PeerModel) (*peerSession, error)
+	decrypt(peerId string, data []byte) ([]byte, error)
+	dial(peer discovery.PeerModel, userId string) (*peerSession, error)
+	dispatch(peerId string, frame FrameSchema) error
+	getSession(key string) *peerSession
+	Handle(frameType, path string, handler HandlerFunc)
+	IsConnected(peerId string) bool
+	maintain()
+	MaintainSessions()
+	post(peer discovery.PeerModel, frameType string, data []byte) error
+	proof(peerId, nonce string) (string, error)
+	readLoop(sess *peerSession)
+	register(sess *peerSession) bool
+	Send(peerId, frameType string, v any) error
+	sendDevice(peer discovery.PeerModel, frameType string, data []byte) error
+	serve(sess *peerSession)
+	sharedKey(peerId string) ([]byte, error)
+	Startup(ctx context.Context)
+	unregister(sess *peerSession)
+	verify(peerId, nonce, proof string) error
+	writeLoop(sess *peerSession)
+}
+
+func NewSessionService(s *store.Store, keyring KeyProvider, discoveryService *discovery.DiscoveryService, protocolService *protocol.ProtocolService) *SessionService {
+	return &SessionService{
+		s:                s,
+		keyring:          keyring,
+		discoveryService: discoveryService,
+		protocolService:  protocolService,
+		sessions:         make(map[string]*peerSession),
+		handlers:         make(map[string]HandlerFunc),
+		routes:           make(map[string]string),
+		retries:          make(map[string]*retry),
+		client:           &http.Client{Timeout: time.Second * 10},
+		dialer:           &websocket.Dialer{HandshakeTimeout: HANDSHAKE_WAIT},
+	}
+}
+
+func newPeerSession(peerId, device, dialer string, conn *websocket.Conn) *peerSession {
+	return &peerSession{
+		peerId:  peerId,
+		device:  device,
+		dialer:  dialer,
+		conn:    conn,
+		send:    make(chan FrameSchema, SEND_BUFFER),
+		pending: make(map[string]chan AckSchema),
+		done:    make(chan struct{}),
+	}
+}
+
+func (ps *peerSession) close() {
+	ps.once.Do(func() {
+		close(ps.done)
+		ps.conn.Close()
+	})
+}
+
+// Key of the session among those of the service, one per device of a peer
+func (ps *peerSession) key() string {
+	return sessionKey(ps.peerId, ps.device)
+}
+
+func (ps *peerSession) closed() bool {
+	select {
+	case <-ps.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Queue frame without blocking and wait for the peer to acknowledge it
+func (ps *peerSession) request(frameType string, data []byte) (AckSchema, error) {
+	var ack AckSchema
+
+	id := ulid.Make().String()
+	ch := make(chan AckSchema, 1)
+
+	ps.mu.Lock()
+	ps.pending[id] = ch
+	ps.mu.Unlock()
+
+	defer func() {
+		ps.mu.Lock()
+		delete(ps.pending, id)
+		ps.mu.Unlock()
+	}()
+
+	select {
+	case ps.send <- FrameSchema{Type: frameType, ID: id, Data: data}:
+	case <-ps.done:
+		return ack, errors.New("session closed")
+	default:
+		return ack, errors.New("session busy")
+	}
+
+	select {
+	case ack = <-ch:
+		return ack, nil
+	case <-ps.done:
+		return ack, errors.New("session closed")
+	case <-time.After(ACK_WAIT):
+		return ack, errors.New("session ack timeout")
+	}
+}
+
+// Hand an ack to its waiter, duplicate or late acks are dropped so the read loop never blocks
+func (ps *peerSession) resolve(id string, ack AckSchema) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ch, ok := ps.pending[id]
+	if !ok {
+		return
+	}
+
+	delete(ps.pending, id)
+
+	select {
+	case ch <- ack:
+	default:
+	}
+}
+
+// Sessions with clients from before linking are keyed by the peer ID alone
+func sessionKey(peerId, device string) string {
+	if device == "" {
+		return peerId
+	}
+
+	return peerId + "/" + device
+}
+
+func newNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.New("failed to create nonce")
+	}
+
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+func readFrame(conn *websocket.Conn, frameType string, v any) error {
+	var frame FrameSchema
+
+	conn.SetReadDeadline(time.Now().Add(HANDSHAKE_WAIT))
+
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	err = sonic.Unmarshal(msg, &frame)
+	if err != nil || frame.Type != frameType {
+		return errors.New("unexpected frame")
+	}
+
+	return sonic.Unmarshal(frame.Data, v)
+}
+
+func writeFrame(conn *websocket.Conn, frameType string, v any) error {
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	payload, err := sonic.Marshal(&FrameSchema{Type: frameType, Data: data})
+	if err != nil {
+		return err
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(WRITE_WAIT))
+	return conn.WriteMessage(websocket.TextMessage, payload)
+}
+
+// Authenticate incoming connection and serve it until closed
+func (ss *SessionService) Accept(conn *websocket.Conn) {
+	var hello HelloSchema
+
+	userId := ss.s.GetString("user:id")
+	if userId == "" {
+		return
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return
+	}
+
+	err = writeFrame(conn, "challenge", ChallengeSchema{Nonce: nonce})
+	if err != nil {
+		return
+	}
+
+	err = readFrame(conn, "hello", &hello)
+	if err != nil {
+		return
+	}
+
+	err = ss.verify(hello.Sender, "hello:"+nonce, hello.Proof)
+	if err != nil {
+		log.Println("Rejected peer session:", err)
+		return
+	}
+
+	proof, err := ss.proof(hello.Sender, "welcome:"+hello.Nonce)
+	if err != nil {
+		return
+	}
+
+	device := ss.s.GetString("user:device")
+
+	err = writeFrame(conn, "welcome", HelloSchema{Sender: userId, Device: device, Proof: proof})
+	if err != nil {
+		return
+	}
+
+	sess := newPeerSession(hello.Sender, hello.Device, sessionKey(hello.Sender, hello.Device), conn)
+	if !ss.register(sess) {
+		return
+	}
+
+	ss.serve(sess)
+}
+
+func (ss *SessionService) backoff(key string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	r, ok := ss.retries[key]
+	if !ok {
+		r = &retry{delay: MAINTAIN_PERIOD}
+		ss.retries[key] = r
+	} else {
+		r.delay = min(r.delay*2, MAX_BACKOFF)
+	}
+
+	r.at = time.Now().Add(r.delay)
+}
+
+func (ss *SessionService) CloseAll() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for key, sess := range ss.sessions {
+		sess.close()
+		delete(ss.sessions, key)
+	}
+}
+
+// Dial a device of a peer unless a recent attempt failed
+func (ss *SessionService) connect(peer discovery.PeerModel) (*peerSession, error) {
+	userId := ss.s.GetString("user:id")
+	if userId == "" {
+		return nil, errors.New("user id not found")
+	}
+
+	if peer.IP == "" {
+		return nil, errors.New("peer is not found")
+	}
+
+	key := sessionKey(peer.ID, peer.Device)
+
+	ss.mu.Lock()
+	r, ok := ss.retries[key]
+	if ok && time.Now().Before(r.at) {
+		ss.mu.Unlock()
+		return nil, errors.New("session backoff")
+	}
+	ss.mu.Unlock()
+
+	// older peers only accept the REST endpoints, other devices of the user were linked by a client that has sessions
+	if peer.ID != userId {
+		err := ss.protocolService.Require(peer.ID, protocol.FEATURE_SESSION)
+		if err != nil {
+			ss.backoff(key)
+			return nil, err
+		}
+	}
+
+	sess, err := ss.dial(peer, userId)
+	if err != nil {
+		ss.backoff(key)
+		return nil, err
+	}
+
+	// a concurrent session with the device won the tie-break
+	if !ss.register(sess) {
+		sess.close()
+		return ss.getSession(key), nil
+	}
+
+	go ss.serve(sess)
+
+	return sess, nil
+}
+
+func (ss *SessionService) dial(peer discovery.PeerModel, userId string) (*peerSession, error) {
+	var challenge ChallengeSchema
+	var welcome HelloSchema
+
+	ctx, cancel := context.WithTimeout(ss.ctx, HANDSHAKE_WAIT)
+	defer cancel()
+
+	url := fmt.Sprintf("ws://%s:%d%s", peer.IP, discovery.SVC_PORT, SESSION_PATH)
+	conn, _, err := ss.dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = readFrame(conn, "challenge", &challenge)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	proof, err := ss.proof(peer.ID, "hello:"+challenge.Nonce)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	device := ss.s.GetString("user:device")
+
+	err = writeFrame(conn, "hello", HelloSchema{Sender: userId, Device: device, Nonce: nonce, Proof: proof})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	err = readFrame(conn, "welcome", &welcome)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if welcome.Sender != peer.ID || (peer.Device != "" && welcome.Device != peer.Device) {
+		conn.Close()
+		return nil, errors.New("unexpected peer")
+	}
+
+	err = ss.verify(peer.ID, "welcome:"+nonce, welcome.Proof)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return newPeerSession(peer.ID, welcome.Device, sessionKey(userId, device), conn), nil
+}
+
+// Decrypt a handshake proof, other devices of the user prove the sync key
+func (ss *SessionService) decrypt(peerId string, data []byte) ([]byte, error) {
+	if peerId != ss.s.GetString("user:id") {
+		return ss.keyring.Decrypt(peerId, data)
+	}
+
+	key, err := ss.keyring.SyncKey()
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+
+	decrypted, err := encryption.AESDecrypt(key, data)
+	if err != nil {
+		return nil, errors.New("failed to decrypt")
+	}
+
+	return decrypted, nil
+}
+
+func (ss *SessionService) dispatch(peerId string, frame FrameSchema) error {
+	ss.mu.Lock()
+	handler, ok := ss.handlers[frame.Type]
+	ss.mu.Unlock()
+
+	if !ok {
+		return errors.New("unsupported frame type")
+	}
+
+	return handler(peerId, frame.Data)
+}
+
+func (ss *SessionService) getSession(key string) *peerSession {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	sess, ok := ss.sessions[key]
+	if !ok || sess.closed() {
+		return nil
+	}
+
+	return sess
+}
+
+// Register handler for a frame type, path is the REST endpoint used as fallback
+func (ss *SessionService) Handle(frameType, path string, handler HandlerFunc) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.handlers[frameType] = handler
+	ss.routes[frameType] = path
+}
+
+// Check whether a session is open with any device of the peer
+func (ss *SessionService) IsConnected(peerId string) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for _, sess := range ss.sessions {
+		if sess.peerId == peerId && !sess.closed() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Open sessions to every device of online contacts and to the other devices of
+// the user, the side with the lower session key dials
+func (ss *SessionService) maintain() {
+	userId := ss.s.GetString("user:id")
+	if userId == "" {
+		return
+	}
+
+	own := sessionKey(userId, ss.s.GetString("user:device"))
+
+	peers := ss.discoveryService.GetPeers()
+	ids := []string{userId}
+	for _, peer := range peers.Data {
+		ids = append(ids, peer.ID)
+	}
+
+	for _, peerId := range ids {
+		// only contacts and linked devices share a key to authenticate with
+		key, err := ss.sharedKey(peerId)
+		if err != nil {
+			continue
+		}
+		clear(key)
+
+		for _, peer := range ss.discoveryService.GetDevices(peerId) {
+			if sessionKey(peer.ID, peer.Device) <= own || ss.getSession(sessionKey(peer.ID, peer.Device)) != nil {
+				continue
+			}
+
+			go ss.connect(peer)
+		}
+	}
+}
+
+func (ss *SessionService) MaintainSessions() {
+	ticker := time.NewTicker(MAINTAIN_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ss.maintain()
+		case <-ss.ctx.Done():
+			ss.CloseAll()
+			log.Println("Shutting down peer sessions...")
+			return
+		}
+	}
+}
+
+// Send frame to a device through the REST endpoint registered for its type
+func (ss *SessionService) post(peer discovery.PeerModel, frameType string, data []byte) error {
+	ss.mu.Lock()
+	path, ok := ss.routes[frameType]
+	ss.mu.Unlock()
+
+	if !ok {
+		return errors.New("unsupported frame type")
+	}
+
+	if peer.IP == "" {
+		return errors.New("peer is not found")
+	}
+
+	url := fmt.Sprintf("http://%s:%d%s", peer.IP, discovery.SVC_PORT, path)
+	res, err := ss.client.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var resErr response.ErrorResponseSchema
+
+		body, err := io.ReadAll(res.Body)
+		if err == nil && sonic.Unmarshal(body, &resErr) == nil && resErr.Error != "" {
+			return errors.New(resErr.Error)
+		}
+
+		return fmt.Errorf("peer responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// Prove knowledge of the shared key, the nonce is prefixed with the handshake step
+// so a proof can never be reflected back as the other side's proof
+func (ss *SessionService) proof(peerId, nonce string) (string, error) {
+	key, err := ss.sharedKey(peerId)
+	if err != nil {
+		return "", err
+	}
+	defer clear(key)
+
+	encrypted, err := encryption.AESEncrypt(key, []byte(nonce))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+func (ss *SessionService) readLoop(sess *peerSession) {
+	sess.conn.SetReadLimit(MAX_FRAME_SIZE)
+	sess.conn.SetReadDeadline(time.Now().Add(PONG_WAIT))
+	sess.conn.SetPongHandler(func(string) error {
+		return sess.conn.SetReadDeadline(time.Now().Add(PONG_WAIT))
+	})
+
+	for {
+		var frame FrameSchema
+
+		_, msg, err := sess.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		sess.conn.SetReadDeadline(time.Now().Add(PONG_WAIT))
+
+		err = sonic.Unmarshal(msg, &frame)
+		if err != nil {
+			continue
+		}
+
+		if frame.Type == "ack" {
+			var ack AckSchema
+			if sonic.Unmarshal(frame.Data, &ack) == nil {
+				sess.resolve(frame.ID, ack)
+			}
+
+			continue
+		}
+
+		var ack AckSchema
+		err = ss.dispatch(sess.peerId, frame)
+		if err != nil {
+			ack.Error = err.Error()
+		}
+
+		if frame.ID == "" {
+			continue
+		}
+
+		data, err := sonic.Marshal(&ack)
+		if err != nil {
+			continue
+		}
+
+		// block reading until the ack is queued, slowing down a flooding peer
+		select {
+		case sess.send <- FrameSchema{Type: "ack", ID: frame.ID, Data: data}:
+		case <-sess.done:
+			return
+		}
+	}
+}
+
+// Keep a single session per device, concurrent sessions are settled in favor of the lower key dialer
+func (ss *SessionService) register(sess *peerSession) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	key := sess.key()
+
+	current, ok := ss.sessions[key]
+	if ok && !current.closed() {
+		preferred := min(key, sessionKey(ss.s.GetString("user:id"), ss.s.GetString("user:device")))
+		if current.dialer == preferred && sess.dialer != preferred {
+			return false
+		}
+
+		current.close()
+	}
+
+	ss.sessions[key] = sess
+	delete(ss.retries, key)
+
+	return true
+}
+
+// Send frame to every device of the peer, one of them acknowledging it is enough.
+// The own user ID sends to the other devices of the user
+func (ss *SessionService) Send(peerId, frameType string, v any) error {
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		return errors.New("failed to generate json")
+	}
+
+	devices := ss.discoveryService.GetDevices(peerId)
+	if len(devices) == 0 {
+		return errors.New("peer is not found")
+	}
+
+	var sendErr error
+	delivered := false
+
+	for _, peer := range devices {
+		err = ss.sendDevice(peer, frameType, data)
+		if err != nil {
+			if sendErr == nil {
+				sendErr = err
+			}
+
+			continue
+		}
+
+		delivered = true
+	}
+
+	if delivered {
+		return nil
+	}
+
+	return sendErr
+}
+
+// Send frame over the session with a device, falling back to the REST endpoint
+func (ss *SessionService) sendDevice(peer discovery.PeerModel, frameType string, data []byte) error {
+	sess := ss.getSession(sessionKey(peer.ID, peer.Device))
+	if sess == nil {
+		sess, _ = ss.connect(peer)
+	}
+
+	if sess != nil {
+		ack, err := sess.request(frameType, data)
+		if err == nil {
+			if ack.Error != "" {
+				return errors.New(ack.Error)
+			}
+
+			return nil
+		}
+
+		log.Println("Peer session unavailable, falling back to http:", err)
+	}
+
+	return ss.post(peer, frameType, data)
+}
+
+func (ss *SessionService) serve(sess *peerSession) {
+	go ss.writeLoop(sess)
+
+	ss.readLoop(sess)
+
+	sess.close()
+	ss.unregister(sess)
+}
+
+// Key proven in the handshake, other devices of the user share the sync key
+func (ss *SessionService) sharedKey(peerId string) ([]byte, error) {
+	if peerId == ss.s.GetString("user:id") {
+		return ss.keyring.SyncKey()
+	}
+
+	return ss.keyring.SharedKey(peerId)
+}
+
+func (ss *SessionService) Startup(ctx context.Context) {
+	ss.ctx = ctx
+}
+
+func (ss *SessionService) unregister(sess *peerSession) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.sessions[sess.key()] == sess {
+		delete(ss.sessions, sess.key())
+	}
+}
+
+func (ss *SessionService) verify(peerId, nonce, proof string) error {
+	decoded, err := base64.StdEncoding.DecodeString(proof)
+	if err != nil {
+		return errors.New("invalid session proof")
+	}
+
+	// keys retired by a rotation still open packets sent before it
+	decrypted, err := ss.decrypt(peerId, decoded)
+	if err != nil && err.Error() != "failed to decrypt" {
+		return errors.New("unknown peer")
+	}
+
+	if err != nil || subtle.ConstantTimeCompare(decrypted, []byte(nonce)) != 1 {
+		return errors.New("invalid session proof")
+	}
+
+	return nil
+}
+
+func (ss *SessionService) writeLoop(sess *peerSession) {
+	ticker := time.NewTicker(PING_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case frame := <-sess.send:
+			payload, err := sonic.Marshal(&frame)
+			if err != nil {
+				continue
+			}
+
+			sess.conn.SetWriteDeadline(time.Now().Add(WRITE_WAIT))
+			err = sess.conn.WriteMessage(websocket.TextMessage, payload)
+			if err != nil {
+				sess.close()
+				return
+			}
+		case <-ticker.C:
+			err := sess.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WRITE_WAIT))
+			if err != nil {
+				sess.close()
+				return
+			}
+		case <-sess.done:
+			return
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package user
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,13 +12,41 @@ type UserController struct {
 }
 
 type IUserController interface {
+	HandleDeviceLink(c *fiber.Ctx) error
 	HandleUserPairing(c *fiber.Ctx) error
+	ReceiveContact(c *fiber.Ctx) error
 }
 
 func NewUserController(userService *UserService) *UserController {
 	return &UserController{userService}
 }
 
+func (uc *UserController) HandleDeviceLink(c *fiber.Ctx) error {
+	var input LinkRequestSchema
+
+	err := c.BodyParser(&input)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid link request schema"})
+	}
+
+	response, err := uc.userService.HandleDeviceLink(input)
+	if err != nil {
+		switch err.Error() {
+		case "link code not found":
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "linking disabled"})
+		case "link code incorrect":
+			return c.Status(http.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		case "invalid remote public key":
+			return c.Status(http.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid public key"})
+		default:
+			log.Println(err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "unknown error"})
+		}
+	}
+
+	return c.JSON(response)
+}
+
 func (uc *UserController) HandleUserPairing(c *fiber.Ctx) error {
 	var input InitPairSchema
 
@@ -26,9 +55,13 @@ func (uc *UserController) HandleUserPairing(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request pair schema"})
 	}
 
-	pubkey, err := uc.userService.HandleUserPairing(input)
+	pubkey, err := uc.userService.HandleUserPairing(input, c.IP())
 	if err != nil {
 		switch err.Error() {
+		case "rate limit exceeded":
+			return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+		case "pairing rejected":
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
 		case "pairing code not found":
 			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "pairing disabled"})
 		case "pairing code incorrect":
@@ -37,14 +70,41 @@ func (uc *UserController) HandleUserPairing(c *fiber.Ctx) error {
 			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
 		case "invalid remote public key":
 			return c.Status(http.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid public key"})
+		case "invalid remote signing key":
+			return c.Status(http.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid signing key"})
 		default:
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "unknown error"})
 		}
 	}
 
 	response := ResponsePairSchema{
-		Pubkey: pubkey.Pubkey,
+		Pubkey:  pubkey.Pubkey,
+		SignKey: pubkey.SignKey,
 	}
 
 	return c.JSON(response)
 }
+
+func (uc *UserController) ReceiveContact(c *fiber.Ctx) error {
+	var input ContactSyncSchema
+
+	err := c.BodyParser(&input)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid contact"})
+	}
+
+	err = uc.userService.ReceiveContact(input)
+	if err != nil {
+		switch err.Error() {
+		case "unknown peer":
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case "session locked":
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		default:
+			log.Println(err)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid contact"})
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "contact received successfully"})
+}
@@ -0,0 +1,887 @@
+package user
+
+import (
+	"bytes"
+	"chat-client/pkg/encryption"
+	"chat-client/pkg/memlock"
+	"chat-client/pkg/store"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"gorm.io/gorm"
+)
+
+// Keyring resolves contact shared keys for other services. It is kept apart
+// from UserService so the keys are never bound to the frontend.
+//
+// The password only derives the master key at login, which unwraps the data key.
+// The data key is the only secret kept in memory, it wraps the private keys and
+// the shared keys of contacts.
+type Keyring struct {
+	db      *gorm.DB
+	s       *store.Store
+	unlocks []func()
+	mu      sync.Mutex
+}
+
+// Shared keys of a contact, the current key and the retired keys still kept. Stored
+// history is read with any of them and sealed with the current one
+type SharedKeys struct {
+	ID      string
+	Current []byte
+	Retired map[string][]byte
+	overlap map[string]bool
+}
+
+// Envelope key ID of a shared key, the key derived at pairing keeps the plain contact ID
+func SharedKeyID(contactId, keyId string) string {
+	if keyId == "" {
+		return "shared:" + contactId
+	}
+
+	return "shared:" + contactId + ":" + keyId
+}
+
+// Open stored history sealed with any of the keys. Blobs from before envelopes do
+// not name their key and are tried with each
+func (sk *SharedKeys) Open(data []byte) ([]byte, error) {
+	if header, _, err := encryption.ParseHeader(data); err == nil {
+		if key, ok := sk.Retired[header.KeyID]; ok {
+			return encryption.Open(key, data)
+		}
+	}
+
+	decrypted, err := encryption.Open(sk.Current, data)
+	if err == nil {
+		return decrypted, nil
+	}
+
+	for _, key := range sk.Retired {
+		if decrypted, err := encryption.Open(key, data); err == nil {
+			return decrypted, nil
+		}
+	}
+
+	return nil, err
+}
+
+// Seal payload for storage with the current key
+func (sk *SharedKeys) Seal(payload []byte) ([]byte, error) {
+	return encryption.Seal(sk.Current, sk.ID, payload)
+}
+
+// Check whether data is an envelope sealed with the current key
+func (sk *SharedKeys) Sealed(data []byte) bool {
+	header, _, err := encryption.ParseHeader(data)
+
+	return err == nil && encryption.IsCurrent(data) && header.KeyID == sk.ID
+}
+
+type IKeyring interface {
+	Close()
+	CreateAccount(account *UserModel, password string, priv, devicePriv *ecdh.PrivateKey, signPriv ed25519.PrivateKey) error
+	dataKey() ([]byte, error)
+	Decrypt(contactId string, data []byte) ([]byte, error)
+	DeviceID() (string, error)
+	Digest(payload []byte) (string, error)
+	DevicePrivateKey() (*ecdh.PrivateKey, error)
+	Identity() (priv, signPriv []byte, err error)
+	Lock()
+	Locked() bool
+	migrate(account *UserModel, password string) error
+	newDataKey(password string, cost encryption.Argon2Params) (wrapped, dataKey []byte, err error)
+	OnUnlock(fn func())
+	Open(account UserModel, password string) error
+	openDataKey(account UserModel, password string) ([]byte, error)
+	PrivateKey() (*ecdh.PrivateKey, error)
+	PruneKeys(before time.Time, inUse func(contactId, keyId string) (bool, error)) error
+	PublicKey() ([]byte, error)
+	Rotate(contactId, keyId string, shared []byte) error
+	SharedKey(contactId string) ([]byte, error)
+	SetSyncKey(key []byte) error
+	SharedKeys(contactId string) (*SharedKeys, error)
+	Sign(payload []byte) ([]byte, error)
+	SigningKey() ([]byte, error)
+	SyncKey() ([]byte, error)
+	Unlock(account UserModel, password string) error
+	upgrade(account *UserModel, password string, dataKey []byte) error
+	Unwrap(encrypted []byte) ([]byte, error)
+	Verify(contactId string, payload, signature []byte) error
+	Wrap(payload []byte) ([]byte, error)
+}
+
+func NewKeyring(s *store.Store, db *gorm.DB) *Keyring {
+	return &Keyring{s: s, db: db}
+}
+
+// Wipe the data key and the pairing and link codes from memory
+func (k *Keyring) Close() {
+	dataKey := k.s.Get("key:data")
+
+	// store deletion zeroes the value
+	k.s.Delete("key:data")
+	k.s.Delete("pair:code")
+	k.s.Delete("link:code")
+
+	memlock.Unlock(dataKey)
+}
+
+// Create an account with the given identity and device keys, wrapping them with a new data
+// key under the password. A linked device brings the identity but has its own device key
+func (k *Keyring) CreateAccount(account *UserModel, password string, priv, devicePriv *ecdh.PrivateKey, signPriv ed25519.PrivateKey) error {
+	// tune the cost to this machine once, it is kept with the account
+	cost := encryption.CalibrateArgon2(encryption.ARGON2_TARGET)
+
+	hashed, err := encryption.HashPassword([]byte(password), cost)
+	if err != nil {
+		return err
+	}
+
+	wrapped, dataKey, err := k.newDataKey(password, cost)
+	if err != nil {
+		return err
+	}
+	defer clear(dataKey)
+
+	account.PrivKey, err = encryption.Seal(dataKey, "data", priv.Bytes())
+	if err != nil {
+		return err
+	}
+
+	account.PubKey, err = encryption.Seal(dataKey, "data", priv.PublicKey().Bytes())
+	if err != nil {
+		return err
+	}
+
+	account.SignPriv, err = encryption.Seal(dataKey, "data", signPriv)
+	if err != nil {
+		return err
+	}
+
+	account.DevicePriv, err = encryption.Seal(dataKey, "data", devicePriv.Bytes())
+	if err != nil {
+		return err
+	}
+
+	// the public key is the second half of the private key
+	account.SignPub = bytes.Clone(signPriv[ed25519.SeedSize:])
+	account.Password = hashed
+	account.DataKey = wrapped
+	account.KDFTime = cost.Time
+	account.KDFMemory = cost.Memory
+	account.KDFThreads = cost.Threads
+
+	return k.db.Create(account).Error
+}
+
+func (k *Keyring) dataKey() ([]byte, error) {
+	if k.Locked() {
+		return nil, errors.New("session locked")
+	}
+
+	dataKey := k.s.Get("key:data")
+	if dataKey == nil {
+		return nil, errors.New("data key not found")
+	}
+
+	return dataKey, nil
+}
+
+// Decrypt a packet of a contact with the current shared key, or with a key retired
+// within the overlap while the contact may still be sending with it
+func (k *Keyring) Decrypt(contactId string, data []byte) ([]byte, error) {
+	keys, err := k.SharedKeys(contactId)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := encryption.AESDecrypt(keys.Current, data)
+	if err == nil {
+		return decrypted, nil
+	}
+
+	for keyId, key := range keys.Retired {
+		if !keys.overlap[keyId] {
+			continue
+		}
+
+		if decrypted, err := encryption.AESDecrypt(key, data); err == nil {
+			return decrypted, nil
+		}
+	}
+
+	return nil, errors.New("failed to decrypt")
+}
+
+// Return the device ID of this install of the account
+func (k *Keyring) DeviceID() (string, error) {
+	var account UserModel
+
+	err := k.db.First(&account, "ID = ?", k.s.GetString("user:id")).Error
+	if err != nil {
+		return "", errors.New("user not found")
+	}
+
+	if account.DeviceID == "" {
+		return "", errors.New("device key not found")
+	}
+
+	return account.DeviceID, nil
+}
+
+// Return the key of this device, used when linking another device
+func (k *Keyring) DevicePrivateKey() (*ecdh.PrivateKey, error) {
+	var account UserModel
+
+	err := k.db.First(&account, "ID = ?", k.s.GetString("user:id")).Error
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if len(account.DevicePriv) == 0 {
+		return nil, errors.New("device key not found")
+	}
+
+	decrypted, err := k.Unwrap(account.DevicePriv)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(decrypted)
+
+	return ecdh.P256().NewPrivateKey(decrypted)
+}
+
+// Return the private identity keys of the logged in user, only ever handed to a device being linked
+func (k *Keyring) Identity() (priv, signPriv []byte, err error) {
+	var account UserModel
+
+	err = k.db.First(&account, "ID = ?", k.s.GetString("user:id")).Error
+	if err != nil {
+		return nil, nil, errors.New("user not found")
+	}
+
+	priv, err = k.Unwrap(account.PrivKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signPriv, err = k.Unwrap(account.SignPriv)
+	if err != nil {
+		clear(priv)
+		return nil, nil, err
+	}
+
+	return priv, signPriv, nil
+}
+
+// Wipe the data key from memory until unlocked again
+func (k *Keyring) Lock() {
+	k.s.Set("user:locked", []byte("1"))
+	k.Close()
+}
+
+func (k *Keyring) Locked() bool {
+	return k.s.Get("user:locked") != nil
+}
+
+// Move an account wrapped by the password onto a data key, rewrapping its own and its contacts' keys
+func (k *Keyring) migrate(account *UserModel, password string) error {
+	var contacts []ContactModel
+
+	priv, err := encryption.PasswordDecrypt([]byte(password), account.PrivKey)
+	if err != nil {
+		return errors.New("failed to decrypt private key")
+	}
+
+	pub, err := encryption.PasswordDecrypt([]byte(password), account.PubKey)
+	if err != nil {
+		return errors.New("failed to decrypt public key")
+	}
+
+	wrapped, dataKey, err := k.newDataKey(password, account.kdf())
+	if err != nil {
+		return err
+	}
+	defer clear(dataKey)
+
+	err = k.db.Find(&contacts).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	return k.db.Transaction(func(tx *gorm.DB) error {
+		for _, contact := range contacts {
+			shared, err := encryption.PasswordDecrypt([]byte(password), contact.SharedKey)
+			if err != nil {
+				return errors.New("failed to decrypt shared key")
+			}
+
+			rewrapped, err := encryption.Seal(dataKey, "data", shared)
+			if err != nil {
+				return errors.New("failed to encrypt shared key")
+			}
+
+			err = tx.Model(&ContactModel{}).Where("ID = ?", contact.ID).Update("shared_key", rewrapped).Error
+			if err != nil {
+				return errors.New("db error")
+			}
+		}
+
+		privEnc, err := encryption.Seal(dataKey, "data", priv)
+		if err != nil {
+			return errors.New("failed to encrypt private key")
+		}
+
+		pubEnc, err := encryption.Seal(dataKey, "data", pub)
+		if err != nil {
+			return errors.New("failed to encrypt public key")
+		}
+
+		account.PrivKey = privEnc
+		account.PubKey = pubEnc
+		account.KeySalt = nil
+		account.DataKey = wrapped
+
+		return tx.Model(&UserModel{}).Where("ID = ?", account.ID).Updates(map[string]any{
+			"priv_key": account.PrivKey,
+			"pub_key":  account.PubKey,
+			"key_salt": account.KeySalt,
+			"data_key": account.DataKey,
+		}).Error
+	})
+}
+
+// Generate a data key wrapped in a password envelope, which records the salt and cost of the master key
+func (k *Keyring) newDataKey(password string, cost encryption.Argon2Params) (wrapped, dataKey []byte, err error) {
+	dataKey, err = encryption.GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wrapped, err = encryption.PasswordSeal([]byte(password), cost, "master", dataKey)
+	if err != nil {
+		return nil, nil, errors.New("failed to encrypt data key")
+	}
+
+	return wrapped, dataKey, nil
+}
+
+// Register a function run after the keyring is unlocked, used to process what was queued while locked
+func (k *Keyring) OnUnlock(fn func()) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.unlocks = append(k.unlocks, fn)
+}
+
+// Derive the master key from the password and keep the unwrapped data key in locked memory
+func (k *Keyring) Open(account UserModel, password string) error {
+	if len(account.DataKey) == 0 {
+		err := k.migrate(&account, password)
+		if err != nil {
+			return err
+		}
+	}
+
+	dataKey, err := k.openDataKey(account, password)
+	if err != nil {
+		return err
+	}
+
+	// reseal what an older format or a lower cost protects while the password is at hand
+	err = k.upgrade(&account, password, dataKey)
+	if err != nil {
+		log.Println("failed to upgrade keys:", err)
+	}
+
+	buf := memlock.Alloc(len(dataKey))
+	copy(buf, dataKey)
+	clear(dataKey)
+
+	// a repeated login replaces the key kept so far
+	old := k.s.Get("key:data")
+	k.s.Set("key:data", buf)
+
+	if old != nil {
+		clear(old)
+		memlock.Unlock(old)
+	}
+
+	return nil
+}
+
+// Unwrap the data key with the master key derived from the password
+func (k *Keyring) openDataKey(account UserModel, password string) ([]byte, error) {
+	// data keys wrapped before envelopes keep the salt on the account
+	if len(account.KeySalt) > 0 {
+		master, err := encryption.DeriveKey([]byte(password), account.KeySalt)
+		if err != nil {
+			return nil, err
+		}
+		defer clear(master)
+
+		dataKey, err := encryption.AESDecrypt(master, account.DataKey)
+		if err != nil {
+			return nil, errors.New("failed to decrypt data key")
+		}
+
+		return dataKey, nil
+	}
+
+	dataKey, err := encryption.PasswordOpen([]byte(password), account.DataKey)
+	if err != nil {
+		return nil, errors.New("failed to decrypt data key")
+	}
+
+	return dataKey, nil
+}
+
+// Return the private key of the logged in user
+func (k *Keyring) PrivateKey() (*ecdh.PrivateKey, error) {
+	var account UserModel
+
+	err := k.db.First(&account, "ID = ?", k.s.GetString("user:id")).Error
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	decrypted, err := k.Unwrap(account.PrivKey)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(decrypted)
+
+	return ecdh.P256().NewPrivateKey(decrypted)
+}
+
+// Delete retired keys that left the overlap before the given time, once no
+// stored history is sealed with them anymore as reported by inUse
+func (k *Keyring) PruneKeys(before time.Time, inUse func(contactId, keyId string) (bool, error)) error {
+	var retired []RetiredKeyModel
+
+	// packets sealed with a key may arrive until its overlap ends
+	if overlap := time.Now().Add(-KEY_OVERLAP); overlap.Before(before) {
+		before = overlap
+	}
+
+	err := k.db.Find(&retired, "retired_at < ?", before).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	for _, r := range retired {
+		used, err := inUse(r.ContactID, r.KeyID)
+		if err != nil {
+			return err
+		}
+
+		if used {
+			continue
+		}
+
+		err = k.db.Delete(&r).Error
+		if err != nil {
+			return errors.New("db error")
+		}
+	}
+
+	return nil
+}
+
+// Return the public key of the logged in user
+func (k *Keyring) PublicKey() ([]byte, error) {
+	var account UserModel
+
+	err := k.db.First(&account, "ID = ?", k.s.GetString("user:id")).Error
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	return k.Unwrap(account.PubKey)
+}
+
+// Replace the shared key of a contact with one agreed in a rotation, retiring the current key
+func (k *Keyring) Rotate(contactId, keyId string, shared []byte) error {
+	var contact ContactModel
+
+	wrapped, err := k.Wrap(shared)
+	if err != nil {
+		return errors.New("failed to encrypt shared key")
+	}
+
+	return k.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&contact, "ID = ?", contactId).Error
+		if err != nil {
+			return errors.New("shared key not found")
+		}
+
+		if contact.KeyID == keyId {
+			return errors.New("key already rotated")
+		}
+
+		now := time.Now()
+
+		err = tx.Create(&RetiredKeyModel{
+			ContactID: contactId,
+			KeyID:     SharedKeyID(contactId, contact.KeyID),
+			SharedKey: contact.SharedKey,
+			RetiredAt: now,
+		}).Error
+		if err != nil {
+			return errors.New("db error")
+		}
+
+		err = tx.Model(&contact).Updates(map[string]any{
+			"shared_key":     wrapped,
+			"key_id":         keyId,
+			"key_rotated_at": now,
+		}).Error
+		if err != nil {
+			return errors.New("db error")
+		}
+
+		return nil
+	})
+}
+
+// Store the key authenticating the devices of the user to each other
+func (k *Keyring) SetSyncKey(key []byte) error {
+	wrapped, err := k.Wrap(key)
+	if err != nil {
+		return err
+	}
+
+	err = k.db.Model(&UserModel{}).Where("ID = ?", k.s.GetString("user:id")).Update("sync_key", wrapped).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+// Return the shared key of a contact, unwrapped with the data key on every call
+func (k *Keyring) SharedKey(contactId string) ([]byte, error) {
+	var contact ContactModel
+
+	dataKey, err := k.dataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	err = k.db.First(&contact, "ID = ?", contactId).Error
+	if err != nil {
+		return nil, errors.New("shared key not found")
+	}
+
+	shared, err := encryption.Open(dataKey, contact.SharedKey)
+	if err != nil {
+		return nil, errors.New("failed to decrypt shared key")
+	}
+
+	return shared, nil
+}
+
+// Return the current and retired shared keys of a contact, keyed by envelope key ID
+func (k *Keyring) SharedKeys(contactId string) (*SharedKeys, error) {
+	var contact ContactModel
+	var retired []RetiredKeyModel
+
+	dataKey, err := k.dataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	err = k.db.First(&contact, "ID = ?", contactId).Error
+	if err != nil {
+		return nil, errors.New("shared key not found")
+	}
+
+	current, err := encryption.Open(dataKey, contact.SharedKey)
+	if err != nil {
+		return nil, errors.New("failed to decrypt shared key")
+	}
+
+	err = k.db.Order("retired_at DESC").Find(&retired, "contact_id = ?", contactId).Error
+	if err != nil {
+		return nil, errors.New("db error")
+	}
+
+	keys := &SharedKeys{
+		ID:      SharedKeyID(contactId, contact.KeyID),
+		Current: current,
+		Retired: make(map[string][]byte),
+		overlap: make(map[string]bool),
+	}
+
+	for _, r := range retired {
+		key, err := encryption.Open(dataKey, r.SharedKey)
+		if err != nil {
+			continue
+		}
+
+		keys.Retired[r.KeyID] = key
+		keys.overlap[r.KeyID] = time.Since(r.RetiredAt) < KEY_OVERLAP
+	}
+
+	return keys, nil
+}
+
+// Sign payload with the identity key of the logged in user
+func (k *Keyring) Sign(payload []byte) ([]byte, error) {
+	var account UserModel
+
+	err := k.db.First(&account, "ID = ?", k.s.GetString("user:id")).Error
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if len(account.SignPriv) == 0 {
+		return nil, errors.New("signing key not found")
+	}
+
+	priv, err := k.Unwrap(account.SignPriv)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(priv)
+
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid signing key")
+	}
+
+	return ed25519.Sign(priv, payload), nil
+}
+
+// Return the public identity key of the logged in user
+func (k *Keyring) SigningKey() ([]byte, error) {
+	var account UserModel
+
+	err := k.db.First(&account, "ID = ?", k.s.GetString("user:id")).Error
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if len(account.SignPub) == 0 {
+		return nil, errors.New("signing key not found")
+	}
+
+	return account.SignPub, nil
+}
+
+// Return the key shared by the devices of the user, none exists before the first link
+func (k *Keyring) SyncKey() ([]byte, error) {
+	var account UserModel
+
+	err := k.db.First(&account, "ID = ?", k.s.GetString("user:id")).Error
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if len(account.SyncKey) == 0 {
+		return nil, errors.New("sync key not found")
+	}
+
+	return k.Unwrap(account.SyncKey)
+}
+
+// Open the keyring again with the verified password and run the unlock functions
+func (k *Keyring) Unlock(account UserModel, password string) error {
+	err := k.Open(account, password)
+	if err != nil {
+		return err
+	}
+
+	k.s.Delete("user:locked")
+
+	k.mu.Lock()
+	unlocks := append([]func(){}, k.unlocks...)
+	k.mu.Unlock()
+
+	for _, fn := range unlocks {
+		go fn()
+	}
+
+	return nil
+}
+
+// Decrypt a key wrapped with the data key
+func (k *Keyring) Unwrap(encrypted []byte) ([]byte, error) {
+	dataKey, err := k.dataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.Open(dataKey, encrypted)
+}
+
+// Reseal the data key, the own keys and the shared keys of contacts that are not in the current
+// envelope format, the data key also when its master key was derived at a lower cost. Accounts
+// from before signing get their identity key here, accounts from before linking their device key
+func (k *Keyring) upgrade(account *UserModel, password string, dataKey []byte) error {
+	var contacts []ContactModel
+
+	err := k.db.Find(&contacts).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	reseal := func(tx *gorm.DB, model any, id, column string, encrypted []byte) ([]byte, error) {
+		if encryption.IsCurrent(encrypted) {
+			return encrypted, nil
+		}
+
+		decrypted, err := encryption.Open(dataKey, encrypted)
+		if err != nil {
+			return nil, err
+		}
+		defer clear(decrypted)
+
+		sealed, err := encryption.Seal(dataKey, "data", decrypted)
+		if err != nil {
+			return nil, err
+		}
+
+		return sealed, tx.Model(model).Where("ID = ?", id).Update(column, sealed).Error
+	}
+
+	return k.db.Transaction(func(tx *gorm.DB) error {
+		cost, ok := encryption.PasswordParams(account.DataKey)
+		if len(account.KeySalt) > 0 || !ok || !cost.Covers(account.kdf()) {
+			wrapped, err := encryption.PasswordSeal([]byte(password), account.kdf(), "master", dataKey)
+			if err != nil {
+				return err
+			}
+
+			err = tx.Model(&UserModel{}).Where("ID = ?", account.ID).Updates(map[string]any{"data_key": wrapped, "key_salt": nil}).Error
+			if err != nil {
+				return err
+			}
+
+			account.DataKey = wrapped
+			account.KeySalt = nil
+		}
+
+		if len(account.SignPriv) == 0 {
+			priv, err := encryption.GenerateSigningKey()
+			if err != nil {
+				return err
+			}
+			defer clear(priv)
+
+			sealed, err := encryption.Seal(dataKey, "data", priv)
+			if err != nil {
+				return err
+			}
+
+			// the public key is the second half of the private key, which is cleared
+			pub := bytes.Clone(priv[ed25519.SeedSize:])
+
+			err = tx.Model(&UserModel{}).Where("ID = ?", account.ID).Updates(map[string]any{"sign_priv": sealed, "sign_pub": pub}).Error
+			if err != nil {
+				return err
+			}
+
+			account.SignPriv = sealed
+			account.SignPub = pub
+		}
+
+		if account.DeviceID == "" || len(account.DevicePriv) == 0 {
+			priv, err := encryption.GeneratePrivateKey()
+			if err != nil {
+				return err
+			}
+
+			sealed, err := encryption.Seal(dataKey, "data", priv.Bytes())
+			if err != nil {
+				return err
+			}
+
+			deviceId := ulid.Make().String()
+
+			err = tx.Model(&UserModel{}).Where("ID = ?", account.ID).Updates(map[string]any{"device_id": deviceId, "device_priv": sealed}).Error
+			if err != nil {
+				return err
+			}
+
+			account.DeviceID = deviceId
+			account.DevicePriv = sealed
+		}
+
+		account.PrivKey, err = reseal(tx, &UserModel{}, account.ID, "priv_key", account.PrivKey)
+		if err != nil {
+			return err
+		}
+
+		account.PubKey, err = reseal(tx, &UserModel{}, account.ID, "pub_key", account.PubKey)
+		if err != nil {
+			return err
+		}
+
+		for _, contact := range contacts {
+			_, err = reseal(tx, &ContactModel{}, contact.ID, "shared_key", contact.SharedKey)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Check the signature of a contact on payload. Contacts whose identity key is not
+// known yet are only authenticated by the shared key and pass unsigned
+func (k *Keyring) Verify(contactId string, payload, signature []byte) error {
+	var contact ContactModel
+
+	err := k.db.First(&contact, "ID = ?", contactId).Error
+	if err != nil {
+		return errors.New("unknown peer")
+	}
+
+	if len(contact.SignKey) == 0 {
+		return nil
+	}
+
+	if len(signature) == 0 {
+		return errors.New("signature missing")
+	}
+
+	if len(contact.SignKey) != ed25519.PublicKeySize || !ed25519.Verify(contact.SignKey, payload, signature) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+// Keyed digest of a payload stored sealed, letting rows be looked up and kept unique
+// without the plaintext. It survives key rotations as it is keyed with the data key
+func (k *Keyring) Digest(payload []byte) (string, error) {
+	dataKey, err := k.dataKey()
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte("digest\x00"))
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Encrypt a key with the data key
+func (k *Keyring) Wrap(payload []byte) ([]byte, error) {
+	dataKey, err := k.dataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.Seal(dataKey, "data", payload)
+}
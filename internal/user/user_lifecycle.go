@@ -0,0 +1,142 @@
+package user
+
+import (
+	"chat-client/internal/discovery"
+	"chat-client/internal/session"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// how long open requests get to finish when the server shuts down
+const SHUTDOWN_TIMEOUT = time.Second * 5
+
+// Lifecycle owns the goroutines of a login, the service broadcast, the peer query
+// and the chat server, and stops them together on logout
+type Lifecycle struct {
+	ctx              context.Context
+	router           *fiber.App
+	discoveryService *discovery.DiscoveryService
+	sessionService   *session.SessionService
+	userId           string
+	ln               net.Listener
+	cancel           context.CancelFunc
+	wg               sync.WaitGroup
+	mu               sync.Mutex
+}
+
+type ILifecycle interface {
+	Running() string
+	Start(id, username string)
+	Startup(ctx context.Context)
+	Stop()
+	stop()
+}
+
+func NewLifecycle(router *fiber.App, discoveryService *discovery.DiscoveryService, sessionService *session.SessionService) *Lifecycle {
+	return &Lifecycle{
+		router:           router,
+		discoveryService: discoveryService,
+		sessionService:   sessionService,
+	}
+}
+
+// Return the ID of the user whose login is running, empty when logged out
+func (l *Lifecycle) Running() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.userId
+}
+
+// Start the goroutines of a login, a running login of the same user is kept
+func (l *Lifecycle) Start(id, username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.userId == id {
+		return
+	}
+
+	l.stop()
+
+	ctx, cancel := context.WithCancel(l.ctx)
+	l.userId = id
+	l.cancel = cancel
+
+	// listen before returning so a quick logout finds the server to shut down
+	ln, err := net.Listen(l.router.Config().Network, fmt.Sprintf(":%d", discovery.SVC_PORT))
+	if err != nil {
+		log.Println("Failed to start chat server:", err)
+	}
+
+	l.wg.Add(2)
+
+	// start broadcasting the service
+	go func() {
+		defer l.wg.Done()
+		l.discoveryService.BroadcastService(ctx, id, username)
+	}()
+
+	// start service query
+	go func() {
+		defer l.wg.Done()
+		l.discoveryService.QueryService(ctx)
+	}()
+
+	// start chat server
+	if ln != nil {
+		l.ln = ln
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+
+			err := l.router.Listener(ln)
+			if err != nil {
+				log.Println("Chat server stopped:", err)
+			}
+		}()
+	}
+}
+
+func (l *Lifecycle) Startup(ctx context.Context) {
+	l.ctx = ctx
+}
+
+// Stop the running login and wait for its goroutines to end
+func (l *Lifecycle) Stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stop()
+}
+
+func (l *Lifecycle) stop() {
+	if l.cancel == nil {
+		return
+	}
+
+	l.cancel()
+
+	err := l.router.ShutdownWithTimeout(SHUTDOWN_TIMEOUT)
+	if err != nil {
+		log.Println("Failed to shut down chat server:", err)
+	}
+
+	// the server may not have taken over the listener yet
+	if l.ln != nil {
+		l.ln.Close()
+	}
+
+	l.sessionService.CloseAll()
+	l.wg.Wait()
+
+	l.userId = ""
+	l.ln = nil
+	l.cancel = nil
+}
@@ -1,28 +1,248 @@
 package user
 
-import "chat-client/internal/discovery"
+import (
+	"chat-client/internal/discovery"
+	"chat-client/pkg/encryption"
+	"time"
+)
+
+// Limits of the local contact metadata
+const (
+	MAX_NICKNAME_LENGTH = 32
+	MAX_NOTE_LENGTH     = 1000
+	MAX_TAG_LENGTH      = 24
+)
+
+const (
+	// how long a device link code can be used, it is also spent by the first attempt
+	LINK_CODE_TTL = time.Minute * 2
+
+	// how long linking waits for the device showing the code to answer
+	LINK_REQUEST_TIMEOUT = time.Second * 10
+
+	// how often contacts are pushed to the other devices of the user
+	DEVICE_SYNC_PERIOD = time.Minute * 5
+
+	MAX_DEVICE_NAME_LENGTH = 64
+)
+
+// Limits guarding the pairing endpoint against guessing the 6-digit code
+const (
+	// pairing attempts allowed per minute from one address and from all addresses together
+	PAIR_IP_LIMIT     = 5
+	PAIR_GLOBAL_LIMIT = 20
+
+	// wrong codes after which the pairing code is invalidated
+	PAIR_MAX_FAILURES = 3
+
+	// how long a pairing attempt with the correct code waits for the user to accept it
+	PAIR_CONFIRM_TIMEOUT = time.Second * 60
+
+	// how long a pairing request waits for the peer, which includes its user answering
+	PAIR_REQUEST_TIMEOUT = PAIR_CONFIRM_TIMEOUT + time.Second*15
+)
+
+// how long a retired shared key still decrypts packets after a rotation, packets
+// sealed before the rotation may be in flight, relayed or queued while locked
+const KEY_OVERLAP = time.Hour * 24
 
 type UserModel struct {
 	ID       string `json:"id" gorm:"primaryKey"`
 	Username string `json:"username" gorm:"not null" validate:"required,alphanum,min=3,max=16"`
-	Password string `json:"password" gorm:"not null" validate:"required,min=8,max=32"`
+	Password string `json:"password" gorm:"not null" validate:"required,min=8,max=128"`
 	PrivKey  []byte `gorm:"not null"`
 	PubKey   []byte `gorm:"not null"`
+
+	// Ed25519 identity signing messages, profile updates and discovery records. The private
+	// key is wrapped with the data key, accounts from before signing get one at their next login
+	SignPriv []byte
+	SignPub  []byte
+
+	// this install of the account, other devices of the user share the identity but have
+	// their own ID and key. The sync key authenticates them to each other, it is empty
+	// until a device is linked
+	DeviceID   string `json:"device_id" gorm:"not null;default:''"`
+	DevicePriv []byte
+	SyncKey    []byte
+
+	// data key wrapping the private and shared keys, itself wrapped by the master key
+	// derived from the password. Empty for accounts still wrapped by the password, the
+	// salt is only kept for data keys wrapped before envelopes recorded it
+	KeySalt []byte
+	DataKey []byte
+
+	// Argon2id cost of the password hash and master key, calibrated at registration
+	KDFTime    uint32 `gorm:"not null;default:0"`
+	KDFMemory  uint32 `gorm:"not null;default:0"`
+	KDFThreads uint8  `gorm:"not null;default:0"`
+
+	// relay envelopes for other contacts when enabled
+	MeshEnabled bool `json:"mesh_enabled" gorm:"not null;default:false"`
+
+	// public profile pushed to contacts, the version grows with every change
+	DisplayName    string `json:"display_name" gorm:"not null;default:''"`
+	StatusText     string `json:"status_text" gorm:"not null;default:''"`
+	Avatar         string `json:"avatar" gorm:"not null;default:''"`
+	ProfileVersion int64  `json:"profile_version" gorm:"not null;default:0"`
+
+	// chosen presence and minutes of inactivity before turning away, zero never does
+	Presence        string `json:"presence" gorm:"not null;default:'available'"`
+	AutoAwayMinutes int    `json:"auto_away_minutes" gorm:"not null;default:5"`
+
+	// minutes of inactivity before the session locks, zero never does
+	AutoLockMinutes int `json:"auto_lock_minutes" gorm:"not null;default:15"`
 }
 
 type UserProfile struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+	ID             string `json:"id"`
+	Username       string `json:"username"`
+	DisplayName    string `json:"display_name"`
+	StatusText     string `json:"status_text"`
+	Avatar         string `json:"avatar"`
+	ProfileVersion int64  `json:"profile_version"`
+}
+
+func (um *UserModel) kdf() encryption.Argon2Params {
+	return encryption.Argon2Params{Time: um.KDFTime, Memory: um.KDFMemory, Threads: um.KDFThreads}
 }
 
 func (um *UserModel) toProfile() UserProfile {
-	return UserProfile{ID: um.ID, Username: um.Username}
+	return UserProfile{
+		ID:             um.ID,
+		Username:       um.Username,
+		DisplayName:    um.DisplayName,
+		StatusText:     um.StatusText,
+		Avatar:         um.Avatar,
+		ProfileVersion: um.ProfileVersion,
+	}
 }
 
 type ContactModel struct {
 	ID        string `json:"id" gorm:"primaryKey"`
 	Username  string `json:"username" gorm:"not null"`
 	SharedKey []byte `gorm:"not null"`
+
+	// Ed25519 public key the contact signs with, empty until exchanged at pairing or
+	// in a re-keying handshake. Once known, unsigned packets of the contact are rejected
+	SignKey []byte
+
+	// ID of the current shared key and when it was agreed, the key derived at pairing
+	// has an empty ID. Contacts paired before rotation have no time
+	KeyID        string     `json:"key_id" gorm:"not null;default:''"`
+	KeyRotatedAt *time.Time `json:"key_rotated_at"`
+
+	// seconds until messages in the conversation disappear, zero keeps them
+	DisappearAfter int64 `json:"disappear_after" gorm:"not null;default:0"`
+
+	// latest profile received from the contact, the avatar is a data URL
+	DisplayName    string `json:"display_name" gorm:"not null;default:''"`
+	StatusText     string `json:"status_text" gorm:"not null;default:''"`
+	Avatar         string `json:"avatar" gorm:"not null;default:''"`
+	ProfileVersion int64  `json:"profile_version" gorm:"not null;default:0"`
+
+	// local metadata, never shared with the contact
+	Nickname string `json:"nickname" gorm:"not null;default:''"`
+	Note     string `json:"note" gorm:"not null;default:''"`
+	Color    string `json:"color" gorm:"not null;default:''"`
+	Tag      string `json:"tag" gorm:"not null;default:''"`
+	Trusted  bool   `json:"trusted" gorm:"not null;default:false"`
+}
+
+// Shared key replaced by a rotation, kept to decrypt packets in flight during the
+// overlap and stored history until it is resealed with the current key
+type RetiredKeyModel struct {
+	ID        uint64    `gorm:"primaryKey"`
+	ContactID string    `gorm:"index;not null"`
+	KeyID     string    `gorm:"not null"`
+	SharedKey []byte    `gorm:"not null"`
+	RetiredAt time.Time `gorm:"not null"`
+}
+
+// Other device of the user, linked to this one
+type DeviceModel struct {
+	ID       string    `json:"id" gorm:"primaryKey"`
+	Name     string    `json:"name" gorm:"not null;default:''"`
+	PubKey   []byte    `json:"-" gorm:"not null"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// Device of the user as listed to the frontend, the fingerprint is of its device key
+type DeviceInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+	Current     bool   `json:"current"`
+	Online      bool   `json:"online"`
+	LinkedAt    string `json:"linked_at,omitempty"`
+}
+
+// Sent by a new device to the one showing the link code. The MAC is keyed with the
+// secret of the code, the device key is the new device's own P-256 key
+type LinkRequestSchema struct {
+	Device string `json:"device" validate:"required,alphanum"`
+	Name   string `json:"name"`
+	Pubkey string `json:"pubkey" validate:"required,base64"`
+	Mac    string `json:"mac" validate:"required,base64"`
+}
+
+// Answer to a link request, the bundle is the LinkBundle encrypted with a key derived
+// from both device keys and the secret of the code
+type LinkResponseSchema struct {
+	Device string `json:"device"`
+	Name   string `json:"name"`
+	Pubkey string `json:"pubkey"`
+	Bundle string `json:"bundle"`
+	Mac    string `json:"mac"`
+}
+
+// Identity and contacts handed to a linked device, history stays on the devices it was sent or received on
+type LinkBundle struct {
+	ID             string        `json:"id"`
+	Username       string        `json:"username"`
+	PrivKey        []byte        `json:"priv_key"`
+	SignPriv       []byte        `json:"sign_priv"`
+	SyncKey        []byte        `json:"sync_key"`
+	DisplayName    string        `json:"display_name"`
+	StatusText     string        `json:"status_text"`
+	Avatar         string        `json:"avatar"`
+	ProfileVersion int64         `json:"profile_version"`
+	Contacts       []ContactData `json:"contacts"`
+}
+
+// Contact as shared between the devices of the user, the shared key is in the clear
+// and only ever sent encrypted with the sync key or the link key
+type ContactData struct {
+	ID             string     `json:"id"`
+	Username       string     `json:"username"`
+	SharedKey      []byte     `json:"shared_key"`
+	SignKey        []byte     `json:"sign_key"`
+	KeyID          string     `json:"key_id"`
+	KeyRotatedAt   *time.Time `json:"key_rotated_at"`
+	DisappearAfter int64      `json:"disappear_after"`
+	DisplayName    string     `json:"display_name"`
+	StatusText     string     `json:"status_text"`
+	Avatar         string     `json:"avatar"`
+	ProfileVersion int64      `json:"profile_version"`
+	Nickname       string     `json:"nickname"`
+	Note           string     `json:"note"`
+	Color          string     `json:"color"`
+	Tag            string     `json:"tag"`
+	Trusted        bool       `json:"trusted"`
+}
+
+// Contact synced from another device of the user, payload is the ContactData encrypted with the sync key
+type ContactSyncSchema struct {
+	Sender  string `json:"sender" validate:"required,alphanum"`
+	Payload string `json:"payload" validate:"required,base64"`
+}
+
+// Local contact metadata, checked against the MAX_* limits and the color pattern by UpdateContact
+type ContactMetaSchema struct {
+	Nickname string `json:"nickname"`
+	Note     string `json:"note"`
+	Color    string `json:"color"`
+	Tag      string `json:"tag"`
+	Trusted  bool   `json:"trusted"`
 }
 
 type InitPairingRequest struct {
@@ -35,6 +255,18 @@ type InitPairSchema struct {
 	Username string `json:"username" validate:"required,alphanum,min=3,max=16"`
 	Code     string `json:"code" validate:"required,numeric,length=4"`
 	Pubkey   string `json:"pubkey" validate:"required,base64"`
+
+	// signing key encrypted like the public key, omitted by clients from before signing
+	SignKey string `json:"sign_key,omitempty" validate:"omitempty,base64"`
+}
+
+// Pairing attempt with the correct code, emitted with pair:attempt and held until
+// the user accepts or rejects it with RespondPairing
+type PairAttempt struct {
+	ID       string `json:"id"`
+	PeerID   string `json:"peer_id"`
+	Username string `json:"username"`
+	IP       string `json:"ip"`
 }
 
 type RequestPairSchema struct {
@@ -44,5 +276,6 @@ type RequestPairSchema struct {
 }
 
 type ResponsePairSchema struct {
-	Pubkey string `json:"pubkey"`
+	Pubkey  string `json:"pubkey"`
+	SignKey string `json:"sign_key,omitempty"`
 }
@@ -3,13 +3,19 @@ package user
 import (
 	"bytes"
 	"chat-client/internal/discovery"
+	"chat-client/internal/protocol"
+	"chat-client/internal/session"
 	"chat-client/pkg/encryption"
+	"chat-client/pkg/ratelimit"
 	"chat-client/pkg/response"
 	"chat-client/pkg/store"
 	"context"
 	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base32"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
@@ -17,47 +23,246 @@ import (
 	"io"
 	"log"
 	"math/big"
+	"net"
 	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bytedance/sonic"
-	"github.com/gofiber/fiber/v2"
 	"github.com/oklog/ulid/v2"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
 type UserService struct {
 	ctx              context.Context
 	db               *gorm.DB
 	discoveryService *discovery.DiscoveryService
+	protocolService  *protocol.ProtocolService
+	sessionService   *session.SessionService
 	s                *store.Store
-	router           *fiber.App
+	keyring          *Keyring
+	lifecycle        *Lifecycle
+	client           *http.Client
+	linkClient       *http.Client
+	ipLimiter        *ratelimit.Limiter
+	pairLimiter      *ratelimit.Limiter
+	pairFailures     int
+	attempts         map[string]chan bool
+	mu               sync.Mutex
 }
 
 type IUserService interface {
+	confirmPairing(input InitPairSchema, ip string) error
+	decryptSignKey(code, encoded string) ([]byte, error)
+	encryptSignKey(code string) (string, error)
+	exportContact(contact ContactModel) (ContactData, error)
+	GenerateLinkCode() response.Response[string]
 	GeneratePairingCode() response.Response[string]
-	generateSharedKey() error
+	generateSharedKey(remotePubkey []byte) ([]byte, error)
 	GetContacts() response.Response[[]ContactModel]
 	getDefaultUser() (UserModel, error)
+	GetDevices() response.Response[[]DeviceInfo]
 	GetProfile() response.Response[UserProfile]
-	HandleUserPairing(input RequestPairSchema) (ResponsePairSchema, error)
-	loadPrivateKey(password []byte) (*ecdh.PrivateKey, error)
+	handleContact(peerId string, data []byte) error
+	HandleDeviceLink(input LinkRequestSchema) (LinkResponseSchema, error)
+	HandleUserPairing(input InitPairSchema, ip string) (ResponsePairSchema, error)
+	importContact(data ContactData) error
+	LinkDevice(code, password string) response.Response[UserProfile]
 	Login(username, password string) response.Response[UserProfile]
+	Logout() response.Response[bool]
+	pushContact(contact ContactModel) error
+	ReceiveContact(input ContactSyncSchema) error
 	Register(username, password string) response.Response[UserProfile]
+	rehash(account *UserModel, password string, hashed encryption.Argon2Params) error
 	RequestPairing(input RequestPairSchema) response.Response[string]
+	RespondPairing(attemptId string, accept bool) response.Response[bool]
 	ScanPeers() response.Response[[]discovery.PeerModel]
 	Startup(ctx context.Context)
+	SyncContact(contactId string) response.Response[bool]
+	SyncDevices()
+	unlink(userId string, contacts []ContactData)
+	UpdateContact(contactId string, input ContactMetaSchema) response.Response[ContactModel]
 }
 
-func NewUserService(s *store.Store, db *gorm.DB, router *fiber.App, discoveryService *discovery.DiscoveryService) *UserService {
-	return &UserService{
+func NewUserService(s *store.Store, db *gorm.DB, keyring *Keyring, lifecycle *Lifecycle, discoveryService *discovery.DiscoveryService, protocolService *protocol.ProtocolService, sessionService *session.SessionService) *UserService {
+	us := &UserService{
 		s:                s,
 		db:               db,
 		discoveryService: discoveryService,
-		router:           router,
+		protocolService:  protocolService,
+		sessionService:   sessionService,
+		keyring:          keyring,
+		lifecycle:        lifecycle,
+		client:           &http.Client{Timeout: PAIR_REQUEST_TIMEOUT},
+		linkClient:       &http.Client{Timeout: LINK_REQUEST_TIMEOUT},
+		ipLimiter:        ratelimit.NewLimiter(PAIR_IP_LIMIT, time.Minute),
+		pairLimiter:      ratelimit.NewLimiter(PAIR_GLOBAL_LIMIT, time.Minute),
+		attempts:         make(map[string]chan bool),
+	}
+
+	sessionService.Handle("user:contact", "/api/user/contact", us.handleContact)
+
+	return us
+}
+
+// Name other devices of the user see this one under
+func deviceName() string {
+	name, err := os.Hostname()
+	if err != nil || utf8.RuneCountInString(name) > MAX_DEVICE_NAME_LENGTH {
+		return "unknown device"
 	}
+
+	return name
+}
+
+// Key the link bundle is encrypted with, bound to the secret of the link code
+func linkKey(secret string, shared []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("link-key\x00"))
+	mac.Write(shared)
+
+	return mac.Sum(nil)
+}
+
+// MAC over the fields of a link message, keyed with the secret of the link code
+func linkMac(secret string, fields ...string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(fields, "\x00")))
+
+	return mac.Sum(nil)
+}
+
+// Ask the user to accept a pairing attempt, waiting for the answer until it times out
+func (us *UserService) confirmPairing(input InitPairSchema, ip string) error {
+	attempt := PairAttempt{
+		ID:       ulid.Make().String(),
+		PeerID:   input.ID,
+		Username: input.Username,
+		IP:       ip,
+	}
+
+	answer := make(chan bool, 1)
+
+	us.mu.Lock()
+	us.attempts[attempt.ID] = answer
+	us.mu.Unlock()
+
+	defer func() {
+		us.mu.Lock()
+		delete(us.attempts, attempt.ID)
+		us.mu.Unlock()
+	}()
+
+	// notify frontend subscriber for pairing attempt event
+	runtime.EventsEmit(us.ctx, "pair:attempt", attempt)
+
+	timer := time.NewTimer(PAIR_CONFIRM_TIMEOUT)
+	defer timer.Stop()
+
+	select {
+	case accepted := <-answer:
+		if !accepted {
+			return errors.New("pairing rejected")
+		}
+
+		return nil
+	case <-timer.C:
+		// notify frontend subscriber for expired pairing attempt event
+		runtime.EventsEmit(us.ctx, "pair:attempt:expired", attempt)
+
+		return errors.New("pairing rejected")
+	case <-us.ctx.Done():
+		return errors.New("pairing rejected")
+	}
+}
+
+// Decrypt the signing key a peer sent at pairing, empty for clients from before signing
+func (us *UserService) decryptSignKey(code, encoded string) ([]byte, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("invalid remote signing key")
+	}
+
+	decrypted, err := encryption.PasswordDecrypt([]byte(code), decoded)
+	if err != nil || len(decrypted) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid remote signing key")
+	}
+
+	return decrypted, nil
+}
+
+// Encrypt own signing key using pre-shared passcode
+func (us *UserService) encryptSignKey(code string) (string, error) {
+	signKey := us.s.Get("key:sign")
+	if signKey == nil {
+		return "", errors.New("signing key not found")
+	}
+
+	encrypted, err := encryption.PasswordEncrypt([]byte(code), signKey)
+	if err != nil {
+		return "", errors.New("failed to encrypt signing key")
+	}
+
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// Contact with its shared key in the clear, to be sent encrypted to another device of the user
+func (us *UserService) exportContact(contact ContactModel) (ContactData, error) {
+	sharedKey, err := us.keyring.SharedKey(contact.ID)
+	if err != nil {
+		return ContactData{}, err
+	}
+
+	return ContactData{
+		ID:             contact.ID,
+		Username:       contact.Username,
+		SharedKey:      sharedKey,
+		SignKey:        contact.SignKey,
+		KeyID:          contact.KeyID,
+		KeyRotatedAt:   contact.KeyRotatedAt,
+		DisappearAfter: contact.DisappearAfter,
+		DisplayName:    contact.DisplayName,
+		StatusText:     contact.StatusText,
+		Avatar:         contact.Avatar,
+		ProfileVersion: contact.ProfileVersion,
+		Nickname:       contact.Nickname,
+		Note:           contact.Note,
+		Color:          contact.Color,
+		Tag:            contact.Tag,
+		Trusted:        contact.Trusted,
+	}, nil
+}
+
+// Generate a one-time code linking another device to this identity, shown as a QR
+// code or typed. It names the user to find on the network and holds the link secret
+func (us *UserService) GenerateLinkCode() response.Response[string] {
+	userId := us.s.GetString("user:id")
+	if userId == "" {
+		return response.New("user not found").Status(404)
+	}
+
+	secret := make([]byte, 10)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return response.New("failed to generate link code").Status(500)
+	}
+
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+
+	// link code expires in two minutes
+	us.s.SetEx("link:code", []byte(encoded), LINK_CODE_TTL)
+
+	return response.New(userId + "-" + encoded)
 }
 
 // Generate 6-digit pairing code and expires in 60 seconds
@@ -80,38 +285,38 @@ func (us *UserService) GeneratePairingCode() response.Response[string] {
 	pairingCode := fmt.Sprintf("%02d%02d%02d", nA.Int64(), nB.Int64(), nC.Int64())
 
 	// pairing code expires in 60 seconds
+	us.mu.Lock()
 	us.s.SetEx("pair:code", []byte(pairingCode), time.Second*60)
+	us.pairFailures = 0
+	us.mu.Unlock()
 
 	return response.New(pairingCode)
 }
 
-// Generate shared key from remote public key
-func (us *UserService) generateSharedKey(remotePubkey []byte) ([]byte, []byte, error) {
-	if us.s.Get("user:password") == nil {
-		return nil, nil, errors.New("user password not found")
-	}
-
+// Generate shared key from remote public key, returned wrapped with the data key
+func (us *UserService) generateSharedKey(remotePubkey []byte) ([]byte, error) {
 	remote, err := ecdh.P256().NewPublicKey(remotePubkey)
 	if err != nil {
-		return nil, nil, errors.New("invalid remote public key")
+		return nil, errors.New("invalid remote public key")
 	}
 
-	priv, err := us.loadPrivateKey([]byte(us.s.GetString("user:password")))
+	priv, err := us.keyring.PrivateKey()
 	if err != nil {
-		return nil, nil, errors.New("failed to load private key")
+		return nil, errors.New("failed to load private key")
 	}
 
 	shared, err := encryption.GenerateSharedKey(priv, remote)
 	if err != nil {
-		return nil, nil, errors.New("failed to generate shared key")
+		return nil, errors.New("failed to generate shared key")
 	}
+	defer clear(shared)
 
-	sharedEnc, err := encryption.PasswordEncrypt([]byte(us.s.GetString("user:password")), shared)
+	sharedEnc, err := us.keyring.Wrap(shared)
 	if err != nil {
-		return nil, nil, errors.New("failed to encrypt shared key")
+		return nil, errors.New("failed to encrypt shared key")
 	}
 
-	return shared, sharedEnc, nil
+	return sharedEnc, nil
 }
 
 // Get all contacts
@@ -138,6 +343,52 @@ func (us *UserService) getDefaultUser() (UserModel, error) {
 	return result, nil
 }
 
+// Get this device and the devices linked to it
+func (us *UserService) GetDevices() response.Response[[]DeviceInfo] {
+	var devices []DeviceModel
+	var result []DeviceInfo
+
+	userId := us.s.GetString("user:id")
+	if userId == "" {
+		return response.New(result).Status(404)
+	}
+
+	priv, err := us.keyring.DevicePrivateKey()
+	if err != nil {
+		return response.New(result).Status(500)
+	}
+
+	err = us.db.Order("linked_at").Find(&devices).Error
+	if err != nil {
+		return response.New(result).Status(500)
+	}
+
+	online := make(map[string]bool)
+	for _, peer := range us.discoveryService.GetDevices(userId) {
+		online[peer.Device] = true
+	}
+
+	result = append(result, DeviceInfo{
+		ID:          us.s.GetString("user:device"),
+		Name:        deviceName(),
+		Fingerprint: encryption.Fingerprint(priv.PublicKey().Bytes()),
+		Current:     true,
+		Online:      true,
+	})
+
+	for _, device := range devices {
+		result = append(result, DeviceInfo{
+			ID:          device.ID,
+			Name:        device.Name,
+			Fingerprint: encryption.Fingerprint(device.PubKey),
+			Online:      online[device.ID],
+			LinkedAt:    device.LinkedAt.Format(time.RFC3339),
+		})
+	}
+
+	return response.New(result)
+}
+
 // Get user profile
 func (us *UserService) GetProfile() response.Response[UserProfile] {
 	var result UserModel
@@ -150,12 +401,182 @@ func (us *UserService) GetProfile() response.Response[UserProfile] {
 	return response.New(result.toProfile())
 }
 
+func (us *UserService) handleContact(peerId string, data []byte) error {
+	var input ContactSyncSchema
+
+	err := sonic.Unmarshal(data, &input)
+	if err != nil {
+		return errors.New("invalid contact")
+	}
+
+	input.Sender = peerId
+
+	return us.ReceiveContact(input)
+}
+
+// Hand the identity and contacts to a new device that knows the link code. The
+// code is spent by the first attempt, so a guess gets a single try
+func (us *UserService) HandleDeviceLink(input LinkRequestSchema) (LinkResponseSchema, error) {
+	var result LinkResponseSchema
+	var account UserModel
+	var contacts []ContactModel
+
+	secret := us.s.GetString("link:code")
+	if secret == "" {
+		return result, errors.New("link code not found")
+	}
+
+	us.s.Delete("link:code")
+
+	userId := us.s.GetString("user:id")
+
+	mac, err := base64.StdEncoding.DecodeString(input.Mac)
+	if err != nil || !hmac.Equal(mac, linkMac(secret, "link-request", userId, input.Device, input.Pubkey)) {
+		return result, errors.New("link code incorrect")
+	}
+
+	pubkey, err := base64.StdEncoding.DecodeString(input.Pubkey)
+	if err != nil {
+		return result, errors.New("invalid remote public key")
+	}
+
+	remote, err := ecdh.P256().NewPublicKey(pubkey)
+	if err != nil {
+		return result, errors.New("invalid remote public key")
+	}
+
+	devicePriv, err := us.keyring.DevicePrivateKey()
+	if err != nil {
+		return result, err
+	}
+
+	shared, err := encryption.GenerateSharedKey(devicePriv, remote)
+	if err != nil {
+		return result, err
+	}
+	defer clear(shared)
+
+	key := linkKey(secret, shared)
+	defer clear(key)
+
+	// the first link creates the key the devices of the user authenticate each other with
+	syncKey, err := us.keyring.SyncKey()
+	if err != nil {
+		if err.Error() != "sync key not found" {
+			return result, err
+		}
+
+		syncKey, err = encryption.GenerateKey()
+		if err != nil {
+			return result, err
+		}
+
+		err = us.keyring.SetSyncKey(syncKey)
+		if err != nil {
+			return result, err
+		}
+	}
+	defer clear(syncKey)
+
+	err = us.db.First(&account, "ID = ?", userId).Error
+	if err != nil {
+		return result, errors.New("user not found")
+	}
+
+	priv, signPriv, err := us.keyring.Identity()
+	if err != nil {
+		return result, err
+	}
+	defer clear(priv)
+	defer clear(signPriv)
+
+	err = us.db.Find(&contacts).Error
+	if err != nil {
+		return result, errors.New("db error")
+	}
+
+	bundle := LinkBundle{
+		ID:             account.ID,
+		Username:       account.Username,
+		PrivKey:        priv,
+		SignPriv:       signPriv,
+		SyncKey:        syncKey,
+		DisplayName:    account.DisplayName,
+		StatusText:     account.StatusText,
+		Avatar:         account.Avatar,
+		ProfileVersion: account.ProfileVersion,
+	}
+
+	for _, contact := range contacts {
+		data, err := us.exportContact(contact)
+		if err != nil {
+			return result, err
+		}
+		defer clear(data.SharedKey)
+
+		bundle.Contacts = append(bundle.Contacts, data)
+	}
+
+	data, err := sonic.Marshal(bundle)
+	if err != nil {
+		return result, errors.New("failed to generate json")
+	}
+	defer clear(data)
+
+	encrypted, err := encryption.AESEncrypt(key, data)
+	if err != nil {
+		return result, errors.New("failed to encrypt bundle")
+	}
+
+	result = LinkResponseSchema{
+		Device: us.s.GetString("user:device"),
+		Name:   deviceName(),
+		Pubkey: base64.StdEncoding.EncodeToString(devicePriv.PublicKey().Bytes()),
+		Bundle: base64.StdEncoding.EncodeToString(encrypted),
+	}
+	result.Mac = base64.StdEncoding.EncodeToString(linkMac(secret, "link-response", userId, result.Device, result.Pubkey, input.Device, result.Bundle))
+
+	name := input.Name
+	if utf8.RuneCountInString(name) > MAX_DEVICE_NAME_LENGTH {
+		name = ""
+	}
+
+	device := DeviceModel{
+		ID:       input.Device,
+		Name:     name,
+		PubKey:   pubkey,
+		LinkedAt: time.Now(),
+	}
+
+	err = us.db.Save(&device).Error
+	if err != nil {
+		return result, errors.New("db error")
+	}
+
+	// notify frontend subscriber for linked device event
+	runtime.EventsEmit(us.ctx, "device:linked", DeviceInfo{
+		ID:          device.ID,
+		Name:        device.Name,
+		Fingerprint: encryption.Fingerprint(device.PubKey),
+		LinkedAt:    device.LinkedAt.Format(time.RFC3339),
+	})
+
+	return result, nil
+}
+
 // Handle user pairing and create shared key
-func (us *UserService) HandleUserPairing(input InitPairSchema) (ResponsePairSchema, error) {
+func (us *UserService) HandleUserPairing(input InitPairSchema, ip string) (ResponsePairSchema, error) {
 	var result ResponsePairSchema
 
+	// the code has a million values, guesses are limited per address and in total
+	if !us.ipLimiter.Allow(ip) || !us.pairLimiter.Allow("pair") {
+		return result, errors.New("rate limit exceeded")
+	}
+
+	us.mu.Lock()
 	pairCode := us.s.GetString("pair:code")
 	if pairCode == "" {
+		us.mu.Unlock()
 		return result, errors.New("pairing code not found")
 	}
 
@@ -165,9 +586,29 @@ func (us *UserService) HandleUserPairing(input InitPairSchema) (ResponsePairSche
 
 	// checksum of both paircode
 	if input.Code != hashString {
+		us.pairFailures++
+
+		// too many wrong codes, a new one has to be generated
+		invalidated := us.pairFailures >= PAIR_MAX_FAILURES
+		if invalidated {
+			us.s.Delete("pair:code")
+			us.pairFailures = 0
+		}
+		us.mu.Unlock()
+
+		if invalidated {
+			// notify frontend subscriber for invalidated pairing code event
+			runtime.EventsEmit(us.ctx, "pair:invalidated", ip)
+		}
+
 		return result, errors.New("pairing code incorrect")
 	}
 
+	// the code pairs a single contact, later attempts need a new one
+	us.s.Delete("pair:code")
+	us.pairFailures = 0
+	us.mu.Unlock()
+
 	// check for existing contact
 	var oldContact ContactModel
 	err := us.db.First(&oldContact, "ID = ?", input.ID).Error
@@ -197,7 +638,18 @@ func (us *UserService) HandleUserPairing(input InitPairSchema) (ResponsePairSche
 		return result, errors.New("invalid encrypted pubkey")
 	}
 
-	shared, sharedEnc, err := us.generateSharedKey(decrypted)
+	signKey, err := us.decryptSignKey(pairCode, input.SignKey)
+	if err != nil {
+		return result, err
+	}
+
+	// the user confirms who is pairing before the contact is created
+	err = us.confirmPairing(input, ip)
+	if err != nil {
+		return result, err
+	}
+
+	sharedEnc, err := us.generateSharedKey(decrypted)
 	if err != nil {
 		if err.Error() == "invalid remote public key" {
 			return result, err
@@ -206,10 +658,13 @@ func (us *UserService) HandleUserPairing(input InitPairSchema) (ResponsePairSche
 		return result, errors.New("failed to generate shared key")
 	}
 
+	now := time.Now()
 	contact := ContactModel{
-		ID:        input.ID,
-		Username:  input.Username,
-		SharedKey: sharedEnc,
+		ID:           input.ID,
+		Username:     input.Username,
+		SharedKey:    sharedEnc,
+		SignKey:      signKey,
+		KeyRotatedAt: &now,
 	}
 
 	// save the newly paired contact
@@ -218,43 +673,243 @@ func (us *UserService) HandleUserPairing(input InitPairSchema) (ResponsePairSche
 		return result, err
 	}
 
-	// store the shared key in memory
-	us.s.Set("key:shared:"+input.ID, shared)
-
 	// broadcast for new contact
 	contact.SharedKey = nil
 	runtime.EventsEmit(us.ctx, "pair:new", contact)
 
+	// the other devices of the user talk to the contact too
+	go us.SyncContact(contact.ID)
+
 	// encrypt public key using pre-shared passcode
 	encrypted, err := encryption.PasswordEncrypt([]byte(pairCode), us.s.Get("key:public"))
+	if err != nil {
+		return result, errors.New("failed to encrypt public key")
+	}
 
 	result.Pubkey = base64.StdEncoding.EncodeToString(encrypted)
 
+	result.SignKey, err = us.encryptSignKey(pairCode)
+	if err != nil {
+		return result, err
+	}
+
 	return result, nil
 }
 
-func (us *UserService) loadPrivateKey(password []byte) (*ecdh.PrivateKey, error) {
-	user, err := us.getDefaultUser()
+// Store a contact received from another device of the user, wrapping its shared key with the data key
+func (us *UserService) importContact(data ContactData) error {
+	sharedEnc, err := us.keyring.Wrap(data.SharedKey)
+	if err != nil {
+		return errors.New("failed to encrypt shared key")
+	}
+
+	contact := ContactModel{
+		ID:             data.ID,
+		Username:       data.Username,
+		SharedKey:      sharedEnc,
+		SignKey:        data.SignKey,
+		KeyID:          data.KeyID,
+		KeyRotatedAt:   data.KeyRotatedAt,
+		DisappearAfter: data.DisappearAfter,
+		DisplayName:    data.DisplayName,
+		StatusText:     data.StatusText,
+		Avatar:         data.Avatar,
+		ProfileVersion: data.ProfileVersion,
+		Nickname:       data.Nickname,
+		Note:           data.Note,
+		Color:          data.Color,
+		Tag:            data.Tag,
+		Trusted:        data.Trusted,
+	}
+
+	err = us.db.Create(&contact).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	// broadcast for new contact
+	contact.SharedKey = nil
+	runtime.EventsEmit(us.ctx, "pair:new", contact)
+
+	return nil
+}
+
+// Link this install to the identity of another device of the user with its link code.
+// The account is created here with its own password and device key, then logged in
+func (us *UserService) LinkDevice(code, password string) response.Response[UserProfile] {
+	var result UserModel
+	var linked LinkResponseSchema
+	var bundle LinkBundle
+
+	if _, err := us.getDefaultUser(); err == nil {
+		return response.New(result.toProfile()).Status(409)
+	}
+
+	userId, secret, ok := strings.Cut(strings.TrimSpace(code), "-")
+	if !ok || userId == "" || secret == "" {
+		return response.New(result.toProfile()).Status(400)
+	}
+
+	peer := us.discoveryService.FindPeer(userId)
+	if peer.IP == "" {
+		return response.New(result.toProfile()).Status(404)
+	}
+
+	devicePriv, err := encryption.GeneratePrivateKey()
+	if err != nil {
+		return response.New(result.toProfile()).Status(500)
+	}
+
+	deviceId := ulid.Make().String()
+	pubkey := base64.StdEncoding.EncodeToString(devicePriv.PublicKey().Bytes())
+
+	payload, err := sonic.Marshal(&LinkRequestSchema{
+		Device: deviceId,
+		Name:   deviceName(),
+		Pubkey: pubkey,
+		Mac:    base64.StdEncoding.EncodeToString(linkMac(secret, "link-request", userId, deviceId, pubkey)),
+	})
+	if err != nil {
+		return response.New(result.toProfile()).Status(500)
+	}
+
+	url := fmt.Sprintf("http://%s:%d/api/user/link", peer.IP, discovery.SVC_PORT)
+	res, err := us.linkClient.Post(url, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		return response.New(result.toProfile()).Status(500)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return nil, err
+		return response.New(result.toProfile()).Status(500)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return response.New(result.toProfile()).Status(res.StatusCode)
 	}
 
-	decrypted, err := encryption.PasswordDecrypt(password, user.PrivKey)
+	err = sonic.Unmarshal(body, &linked)
 	if err != nil {
-		return nil, err
+		return response.New(result.toProfile()).Status(500)
 	}
 
-	priv, err := ecdh.P256().NewPrivateKey(decrypted)
+	// only the device showing the code can answer for it
+	mac, err := base64.StdEncoding.DecodeString(linked.Mac)
+	if err != nil || !hmac.Equal(mac, linkMac(secret, "link-response", userId, linked.Device, linked.Pubkey, deviceId, linked.Bundle)) {
+		return response.New(result.toProfile()).Status(401)
+	}
+
+	remotePubkey, err := base64.StdEncoding.DecodeString(linked.Pubkey)
 	if err != nil {
-		return nil, err
+		return response.New(result.toProfile()).Status(500)
+	}
+
+	remote, err := ecdh.P256().NewPublicKey(remotePubkey)
+	if err != nil {
+		return response.New(result.toProfile()).Status(500)
 	}
 
-	return priv, nil
+	shared, err := encryption.GenerateSharedKey(devicePriv, remote)
+	if err != nil {
+		return response.New(result.toProfile()).Status(500)
+	}
+	defer clear(shared)
+
+	key := linkKey(secret, shared)
+	defer clear(key)
+
+	encrypted, err := base64.StdEncoding.DecodeString(linked.Bundle)
+	if err != nil {
+		return response.New(result.toProfile()).Status(500)
+	}
+
+	decrypted, err := encryption.AESDecrypt(key, encrypted)
+	if err != nil {
+		return response.New(result.toProfile()).Status(500)
+	}
+	defer clear(decrypted)
+
+	err = sonic.Unmarshal(decrypted, &bundle)
+	if err != nil || bundle.ID != userId {
+		return response.New(result.toProfile()).Status(500)
+	}
+	defer clear(bundle.PrivKey)
+	defer clear(bundle.SignPriv)
+	defer clear(bundle.SyncKey)
+	defer func() {
+		for _, contact := range bundle.Contacts {
+			clear(contact.SharedKey)
+		}
+	}()
+
+	priv, err := ecdh.P256().NewPrivateKey(bundle.PrivKey)
+	if err != nil || len(bundle.SignPriv) != ed25519.PrivateKeySize {
+		return response.New(result.toProfile()).Status(500)
+	}
+
+	result = UserModel{
+		ID:             bundle.ID,
+		Username:       bundle.Username,
+		DeviceID:       deviceId,
+		DisplayName:    bundle.DisplayName,
+		StatusText:     bundle.StatusText,
+		Avatar:         bundle.Avatar,
+		ProfileVersion: bundle.ProfileVersion,
+	}
+
+	err = us.keyring.CreateAccount(&result, password, priv, devicePriv, bundle.SignPriv)
+	if err != nil {
+		log.Println(err)
+		return response.New(result.toProfile()).Status(500)
+	}
+
+	// from here on a failure undoes the link, a half linked install would refuse the retry
+	login := us.Login(result.Username, password)
+	if login.Code != 200 {
+		us.unlink(result.ID, bundle.Contacts)
+		return login
+	}
+
+	err = us.keyring.SetSyncKey(bundle.SyncKey)
+	if err != nil {
+		log.Println(err)
+		us.unlink(result.ID, bundle.Contacts)
+		return response.New(result.toProfile()).Status(500)
+	}
+
+	for _, contact := range bundle.Contacts {
+		err = us.importContact(contact)
+		if err != nil {
+			log.Println("failed to import contact:", err)
+			us.unlink(result.ID, bundle.Contacts)
+			return response.New(result.toProfile()).Status(500)
+		}
+	}
+
+	err = us.db.Create(&DeviceModel{
+		ID:       linked.Device,
+		Name:     linked.Name,
+		PubKey:   remotePubkey,
+		LinkedAt: time.Now(),
+	}).Error
+	if err != nil {
+		log.Println(err)
+		us.unlink(result.ID, bundle.Contacts)
+		return response.New(result.toProfile()).Status(500)
+	}
+
+	return login
 }
 
 func (us *UserService) Login(username, password string) response.Response[UserProfile] {
 	var result UserModel
 
+	// a locked session is resumed with Unlock, which is rate limited and runs the unlock hooks
+	if us.keyring.Locked() {
+		return response.New(result.toProfile()).Status(409)
+	}
+
 	err := us.db.First(&result).Error
 	if err != nil {
 		return response.New(result.toProfile()).Status(404)
@@ -266,49 +921,199 @@ func (us *UserService) Login(username, password string) response.Response[UserPr
 	}
 
 	// check for password
-	err = bcrypt.CompareHashAndPassword([]byte(result.Password), []byte(password))
-	if err != nil {
+	ok, hashed, err := encryption.VerifyPassword([]byte(password), result.Password)
+	if err != nil || !ok {
 		return response.New(result.toProfile()).Status(401)
 	}
 
-	// get public key
-	pubkey, err := encryption.PasswordDecrypt([]byte(password), result.PubKey)
+	// bring the hash up to the current cost before the keys are opened with it
+	err = us.rehash(&result, password, hashed)
 	if err != nil {
+		log.Println(err)
 		return response.New(result.toProfile()).Status(500)
 	}
 
 	// store username in memory
 	us.s.Set("user:username", []byte(username))
 
-	// store password in memory
+	// store user id in memory
 	us.s.Set("user:id", []byte(result.ID))
 
-	// store password in memory
-	us.s.Set("user:password", []byte(password))
+	// derive the master key once and keep only the data key, never the password
+	err = us.keyring.Open(result, password)
+	if err != nil {
+		log.Println(err)
+		return response.New(result.toProfile()).Status(500)
+	}
+
+	// get public key
+	pubkey, err := us.keyring.PublicKey()
+	if err != nil {
+		us.keyring.Close()
+		return response.New(result.toProfile()).Status(500)
+	}
 
 	// store pubkey in memory
 	us.s.Set("key:public", pubkey)
 
-	// start broadcasting the service
-	go us.discoveryService.BroadcastService(result.ID, username)
+	// identity key exchanged at pairing, created by the keyring for older accounts
+	signKey, err := us.keyring.SigningKey()
+	if err != nil {
+		us.keyring.Close()
+		return response.New(result.toProfile()).Status(500)
+	}
+
+	us.s.Set("key:sign", signKey)
+
+	// device announced next to the user ID, created by the keyring for older accounts
+	deviceId, err := us.keyring.DeviceID()
+	if err != nil {
+		us.keyring.Close()
+		return response.New(result.toProfile()).Status(500)
+	}
 
-	// start service query
-	go us.discoveryService.QueryService()
+	us.s.Set("user:device", []byte(deviceId))
 
-	// start chat server
-	go us.router.Listen(fmt.Sprintf(":%d", discovery.SVC_PORT))
+	// start broadcast, query and chat server unless already running for this user
+	us.lifecycle.Start(result.ID, username)
 
 	return response.New(result.toProfile())
 }
 
-func (us *UserService) Register(username, password string) response.Response[UserProfile] {
-	var user UserModel
+// Stop broadcasting and serving peers and wipe everything kept in memory
+func (us *UserService) Logout() response.Response[bool] {
+	if us.lifecycle.Running() == "" {
+		return response.New(false)
+	}
+
+	us.lifecycle.Stop()
+	us.discoveryService.Reset()
+	us.keyring.Close()
+
+	// store deletion zeroes what is left
+	us.s.Clear()
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	// notify frontend subscriber for logout event
+	runtime.EventsEmit(us.ctx, "user:logout", true)
+
+	return response.New(true)
+}
+
+// Encrypt a contact with the sync key and send it to the other devices of the user
+func (us *UserService) pushContact(contact ContactModel) error {
+	data, err := us.exportContact(contact)
 	if err != nil {
-		log.Println(err)
-		return response.New(user.toProfile()).Status(500)
+		return err
+	}
+	defer clear(data.SharedKey)
+
+	payload, err := sonic.Marshal(data)
+	if err != nil {
+		return errors.New("failed to generate json")
+	}
+	defer clear(payload)
+
+	syncKey, err := us.keyring.SyncKey()
+	if err != nil {
+		return err
+	}
+	defer clear(syncKey)
+
+	encrypted, err := encryption.AESEncrypt(syncKey, payload)
+	if err != nil {
+		return errors.New("failed to encrypt contact")
+	}
+
+	userId := us.s.GetString("user:id")
+
+	return us.sessionService.Send(userId, "user:contact", ContactSyncSchema{
+		Sender:  userId,
+		Payload: base64.StdEncoding.EncodeToString(encrypted),
+	})
+}
+
+// Store a contact synced from another device of the user. Contacts paired there are
+// created, a newer shared key agreed there replaces the current one
+func (us *UserService) ReceiveContact(input ContactSyncSchema) error {
+	var data ContactData
+	var contact ContactModel
+
+	// only other devices of the user hold the sync key
+	userId := us.s.GetString("user:id")
+	if userId == "" || input.Sender != userId {
+		return errors.New("unknown peer")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(input.Payload)
+	if err != nil {
+		return errors.New("invalid contact")
+	}
+
+	syncKey, err := us.keyring.SyncKey()
+	if err != nil {
+		return err
 	}
+	defer clear(syncKey)
+
+	decrypted, err := encryption.AESDecrypt(syncKey, decoded)
+	if err != nil {
+		return errors.New("invalid contact")
+	}
+	defer clear(decrypted)
+
+	err = sonic.Unmarshal(decrypted, &data)
+	if err != nil || data.ID == "" || data.ID == userId || len(data.SharedKey) != 32 {
+		return errors.New("invalid contact")
+	}
+	defer clear(data.SharedKey)
+
+	err = us.db.First(&contact, "ID = ?", data.ID).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("db error")
+		}
+
+		return us.importContact(data)
+	}
+
+	changed := false
+
+	// devices may sync an older key than the one agreed since, only a newer key is taken
+	if data.KeyID != contact.KeyID && data.KeyRotatedAt != nil && (contact.KeyRotatedAt == nil || data.KeyRotatedAt.After(*contact.KeyRotatedAt)) {
+		err = us.keyring.Rotate(contact.ID, data.KeyID, data.SharedKey)
+		if err != nil {
+			return err
+		}
+
+		err = us.db.Model(&contact).Update("key_rotated_at", data.KeyRotatedAt).Error
+		if err != nil {
+			return errors.New("db error")
+		}
+
+		changed = true
+	}
+
+	if len(contact.SignKey) == 0 && len(data.SignKey) == ed25519.PublicKeySize {
+		err = us.db.Model(&contact).Update("sign_key", data.SignKey).Error
+		if err != nil {
+			return errors.New("db error")
+		}
+
+		changed = true
+	}
+
+	if changed {
+		contact.SharedKey = nil
+
+		// notify frontend subscriber for updated contact event
+		runtime.EventsEmit(us.ctx, "contact:updated", contact)
+	}
+
+	return nil
+}
+
+func (us *UserService) Register(username, password string) response.Response[UserProfile] {
+	var user UserModel
 
 	priv, err := encryption.GeneratePrivateKey()
 	if err != nil {
@@ -316,27 +1121,26 @@ func (us *UserService) Register(username, password string) response.Response[Use
 		return response.New(user.toProfile()).Status(500)
 	}
 
-	privEnc, err := encryption.PasswordEncrypt([]byte(password), priv.Bytes())
+	devicePriv, err := encryption.GeneratePrivateKey()
 	if err != nil {
 		log.Println(err)
 		return response.New(user.toProfile()).Status(500)
 	}
 
-	pubEnc, err := encryption.PasswordEncrypt([]byte(password), priv.PublicKey().Bytes())
+	signPriv, err := encryption.GenerateSigningKey()
 	if err != nil {
 		log.Println(err)
 		return response.New(user.toProfile()).Status(500)
 	}
+	defer clear(signPriv)
 
 	user = UserModel{
 		ID:       ulid.Make().String(),
 		Username: username,
-		Password: string(hashed),
-		PrivKey:  privEnc,
-		PubKey:   pubEnc,
+		DeviceID: ulid.Make().String(),
 	}
 
-	err = us.db.Create(&user).Error
+	err = us.keyring.CreateAccount(&user, password, priv, devicePriv, signPriv)
 	if err != nil {
 		log.Println(err)
 		return response.New(user.toProfile()).Status(500)
@@ -345,6 +1149,47 @@ func (us *UserService) Register(username, password string) response.Response[Use
 	return response.New(user.toProfile())
 }
 
+// Calibrate the cost of accounts from before Argon2id, raise it to the minimum and
+// rehash the password when it was hashed at a lower cost
+func (us *UserService) rehash(account *UserModel, password string, hashed encryption.Argon2Params) error {
+	cost := account.kdf()
+	if cost == (encryption.Argon2Params{}) {
+		cost = encryption.CalibrateArgon2(encryption.ARGON2_TARGET)
+	}
+	cost = cost.Raise(encryption.MinArgon2)
+
+	if cost == account.kdf() && hashed.Covers(cost) {
+		return nil
+	}
+
+	values := map[string]any{
+		"kdf_time":    cost.Time,
+		"kdf_memory":  cost.Memory,
+		"kdf_threads": cost.Threads,
+	}
+
+	if !hashed.Covers(cost) {
+		hash, err := encryption.HashPassword([]byte(password), cost)
+		if err != nil {
+			return err
+		}
+
+		values["password"] = hash
+		account.Password = hash
+	}
+
+	err := us.db.Model(&UserModel{}).Where("ID = ?", account.ID).Updates(values).Error
+	if err != nil {
+		return errors.New("db error")
+	}
+
+	account.KDFTime = cost.Time
+	account.KDFMemory = cost.Memory
+	account.KDFThreads = cost.Threads
+
+	return nil
+}
+
 func (us *UserService) RequestPairing(input RequestPairSchema) response.Response[string] {
 	userId := us.s.GetString("user:id")
 	if userId == "" {
@@ -369,6 +1214,11 @@ func (us *UserService) RequestPairing(input RequestPairSchema) response.Response
 	// encode pubkey to base64
 	encoded := base64.StdEncoding.EncodeToString(encrypted)
 
+	signKey, err := us.encryptSignKey(input.Code)
+	if err != nil {
+		return response.New(err.Error()).Status(500)
+	}
+
 	// hash passcode using sha256
 	hash := sha256.Sum256([]byte(input.Code))
 	hashString := hex.EncodeToString(hash[:])
@@ -378,6 +1228,7 @@ func (us *UserService) RequestPairing(input RequestPairSchema) response.Response
 		Username: username,
 		Pubkey:   encoded,
 		Code:     hashString,
+		SignKey:  signKey,
 	}
 
 	payload, err := sonic.Marshal(&initReq)
@@ -390,9 +1241,26 @@ func (us *UserService) RequestPairing(input RequestPairSchema) response.Response
 		return response.New("peer is not found")
 	}
 
+	err = us.protocolService.RequireCompatible(input.ID)
+	if err != nil {
+		switch err.Error() {
+		case "peer too old":
+			return response.New(err.Error()).Status(426)
+		case "peer is unreachable":
+			return response.New(err.Error()).Status(503)
+		}
+
+		return response.New("failed to get peer info").Status(500)
+	}
+
+	// the peer holds the request until its user accepts it
 	url := fmt.Sprintf("http://%s:%d/api/user/pair", peer.IP, discovery.SVC_PORT)
-	res, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	res, err := us.client.Post(url, "application/json", bytes.NewBuffer(payload))
 	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return response.New("peer did not answer").Status(504)
+		}
+
 		return response.New("failed to initiate pair").Status(500)
 	}
 	defer res.Body.Close()
@@ -430,7 +1298,12 @@ func (us *UserService) RequestPairing(input RequestPairSchema) response.Response
 		return response.New("invalid encrypted pubkey").Status(500)
 	}
 
-	shared, sharedEnc, err := us.generateSharedKey(decrypted)
+	remoteSignKey, err := us.decryptSignKey(input.Code, resPair.SignKey)
+	if err != nil {
+		return response.New(err.Error()).Status(500)
+	}
+
+	sharedEnc, err := us.generateSharedKey(decrypted)
 	if err != nil {
 		if err.Error() == "invalid remote public key" {
 			return response.New(err.Error()).Status(500)
@@ -439,10 +1312,13 @@ func (us *UserService) RequestPairing(input RequestPairSchema) response.Response
 		return response.New("failed to generate shared key").Status(500)
 	}
 
+	now := time.Now()
 	contact := ContactModel{
-		ID:        input.ID,
-		Username:  input.Username,
-		SharedKey: sharedEnc,
+		ID:           input.ID,
+		Username:     input.Username,
+		SharedKey:    sharedEnc,
+		SignKey:      remoteSignKey,
+		KeyRotatedAt: &now,
 	}
 
 	// save the newly paired contact
@@ -451,16 +1327,32 @@ func (us *UserService) RequestPairing(input RequestPairSchema) response.Response
 		return response.New("failed to store contact").Status(500)
 	}
 
-	// store the shared key in memory
-	us.s.Set("key:shared:"+input.ID, shared)
-
 	// broadcast for new contact
 	contact.SharedKey = nil
 	runtime.EventsEmit(us.ctx, "pair:new", contact)
 
+	// the other devices of the user talk to the contact too
+	go us.SyncContact(contact.ID)
+
 	return response.New("paired successfully")
 }
 
+// Accept or reject a pairing attempt announced with pair:attempt
+func (us *UserService) RespondPairing(attemptId string, accept bool) response.Response[bool] {
+	us.mu.Lock()
+	answer, ok := us.attempts[attemptId]
+	delete(us.attempts, attemptId)
+	us.mu.Unlock()
+
+	if !ok {
+		return response.New(false).Status(404)
+	}
+
+	answer <- accept
+
+	return response.New(true)
+}
+
 func (us *UserService) ScanPeers() response.Response[[]discovery.PeerModel] {
 	var result []discovery.PeerModel
 	isContact := make(map[string]bool)
@@ -497,4 +1389,129 @@ func (us *UserService) ScanPeers() response.Response[[]discovery.PeerModel] {
 
 func (us *UserService) Startup(ctx context.Context) {
 	us.ctx = ctx
+	us.lifecycle.Startup(ctx)
+}
+
+// Send a contact to the other devices of the user that are online
+func (us *UserService) SyncContact(contactId string) response.Response[bool] {
+	var contact ContactModel
+
+	err := us.db.First(&contact, "ID = ?", contactId).Error
+	if err != nil {
+		return response.New(false).Status(404)
+	}
+
+	if len(us.discoveryService.GetDevices(us.s.GetString("user:id"))) == 0 {
+		return response.New(false)
+	}
+
+	err = us.pushContact(contact)
+	if err != nil {
+		log.Println("failed to sync contact:", err)
+		return response.New(false).Status(500)
+	}
+
+	return response.New(true)
+}
+
+// Keep the other devices of the user up to date with contacts paired or re-keyed
+// while they were offline, every contact is sent and only what changed is taken
+func (us *UserService) SyncDevices() {
+	ticker := time.NewTicker(DEVICE_SYNC_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			var contacts []ContactModel
+
+			userId := us.s.GetString("user:id")
+			if userId == "" || us.keyring.Locked() || len(us.discoveryService.GetDevices(userId)) == 0 {
+				continue
+			}
+
+			err := us.db.Find(&contacts).Error
+			if err != nil {
+				continue
+			}
+
+			for _, contact := range contacts {
+				err = us.pushContact(contact)
+				if err != nil {
+					log.Println("failed to sync contact:", err)
+					break
+				}
+			}
+		case <-us.ctx.Done():
+			return
+		}
+	}
+}
+
+// Remove the account and contacts created by a device link that failed halfway
+func (us *UserService) unlink(userId string, contacts []ContactData) {
+	var ids []string
+
+	for _, contact := range contacts {
+		ids = append(ids, contact.ID)
+	}
+
+	if us.lifecycle.Running() != "" {
+		us.Logout()
+	} else {
+		us.keyring.Close()
+		us.s.Clear()
+	}
+
+	err := us.db.Transaction(func(tx *gorm.DB) error {
+		if len(ids) > 0 {
+			err := tx.Delete(&ContactModel{}, "ID IN ?", ids).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&UserModel{}, "ID = ?", userId).Error
+	})
+	if err != nil {
+		log.Println("failed to undo device link:", err)
+	}
+}
+
+// Update the local nickname, note, color, tag and trust label of a contact
+func (us *UserService) UpdateContact(contactId string, input ContactMetaSchema) response.Response[ContactModel] {
+	var contact ContactModel
+
+	input.Nickname = strings.TrimSpace(input.Nickname)
+	input.Tag = strings.TrimSpace(input.Tag)
+
+	if utf8.RuneCountInString(input.Nickname) > MAX_NICKNAME_LENGTH ||
+		utf8.RuneCountInString(input.Note) > MAX_NOTE_LENGTH ||
+		utf8.RuneCountInString(input.Tag) > MAX_TAG_LENGTH ||
+		(input.Color != "" && !colorPattern.MatchString(input.Color)) {
+		return response.New(contact).Status(400)
+	}
+
+	err := us.db.First(&contact, "ID = ?", contactId).Error
+	if err != nil {
+		return response.New(contact).Status(404)
+	}
+
+	err = us.db.Model(&contact).Updates(map[string]any{
+		"nickname": input.Nickname,
+		"note":     input.Note,
+		"color":    input.Color,
+		"tag":      input.Tag,
+		"trusted":  input.Trusted,
+	}).Error
+	if err != nil {
+		return response.New(contact).Status(500)
+	}
+
+	contact.SharedKey = nil
+
+	// notify frontend subscriber for updated contact event
+	runtime.EventsEmit(us.ctx, "contact:updated", contact)
+
+	return response.New(contact)
 }
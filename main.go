@@ -3,7 +3,17 @@ package main
 import (
 	"chat-client/internal/chat"
 	"chat-client/internal/discovery"
+	"chat-client/internal/export"
+	"chat-client/internal/identity"
+	"chat-client/internal/lock"
+	"chat-client/internal/mesh"
+	"chat-client/internal/presence"
+	"chat-client/internal/profile"
+	"chat-client/internal/protocol"
+	"chat-client/internal/retention"
+	"chat-client/internal/rotation"
 	"chat-client/internal/router"
+	"chat-client/internal/session"
 	"chat-client/internal/user"
 	"chat-client/pkg/db"
 	"chat-client/pkg/store"
@@ -28,21 +38,42 @@ func main() {
 	// Init fiber
 	fiberApp := fiber.New(router.DefaultConfig())
 
+	// Init keyring
+	keyring := user.NewKeyring(s, db)
+
 	// Init services
 	discoveryService := discovery.NewDiscoveryService(s)
-	chatService := chat.NewChatService(s, db, discoveryService)
-	userService := user.NewUserService(s, db, fiberApp, discoveryService)
+	protocolService := protocol.NewProtocolService(discoveryService)
+	sessionService := session.NewSessionService(s, keyring, discoveryService, protocolService)
+	identityService := identity.NewIdentityService(s, db, keyring, discoveryService, protocolService, sessionService)
+	meshService := mesh.NewMeshService(s, db, keyring, discoveryService, protocolService, sessionService)
+	presenceService := presence.NewPresenceService(s, db, keyring, discoveryService, protocolService, sessionService)
+	chatService := chat.NewChatService(s, db, keyring, discoveryService, identityService, meshService, presenceService, protocolService, sessionService)
+	lifecycle := user.NewLifecycle(fiberApp, discoveryService, sessionService)
+	userService := user.NewUserService(s, db, keyring, lifecycle, discoveryService, protocolService, sessionService)
+	exportService := export.NewExportService(s, db, keyring)
+	retentionService := retention.NewRetentionService(db)
+	profileService := profile.NewProfileService(s, db, keyring, discoveryService, identityService, protocolService, sessionService)
+	lockService := lock.NewLockService(s, db, keyring, presenceService)
+	rotationService := rotation.NewRotationService(s, db, keyring, discoveryService, identityService, protocolService, sessionService, userService)
 
 	// Init controllers
 	chatController := chat.NewChatController(chatService)
 	userController := user.NewUserController(userService)
+	identityController := identity.NewIdentityController(identityService)
+	meshController := mesh.NewMeshController(meshService)
+	presenceController := presence.NewPresenceController(presenceService)
+	profileController := profile.NewProfileController(profileService)
+	protocolController := protocol.NewProtocolController(protocolService)
+	rotationController := rotation.NewRotationController(rotationService)
+	sessionController := session.NewSessionController(sessionService)
 
 	// Init router
-	mainRouter := router.NewRouter(fiberApp, chatController, userController)
+	mainRouter := router.NewRouter(fiberApp, chatController, userController, identityController, meshController, presenceController, profileController, protocolController, rotationController, sessionController)
 	mainRouter.Handle()
 
 	// Create an instance of the app structure
-	app := NewApp(s, userService, chatService, discoveryService)
+	app := NewApp(s, userService, chatService, discoveryService, exportService, identityService, lockService, meshService, presenceService, profileService, protocolService, retentionService, rotationService, sessionService)
 
 	// Create application with options
 	err := wails.Run(&options.App{
@@ -59,6 +90,15 @@ func main() {
 			app,
 			chatService,
 			discoveryService,
+			exportService,
+			identityService,
+			lockService,
+			meshService,
+			presenceService,
+			profileService,
+			protocolService,
+			retentionService,
+			rotationService,
 			userService,
 		},
 	})
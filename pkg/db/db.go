@@ -2,26 +2,67 @@ package db
 
 import (
 	"chat-client/internal/chat"
+	"chat-client/internal/retention"
 	"chat-client/internal/user"
-	"log"
 
 	"github.com/glebarez/sqlite"
+	"github.com/oklog/ulid/v2"
 	"gorm.io/gorm"
 )
 
 func NewDB() *gorm.DB {
-	db, err := gorm.Open(sqlite.Open("data.db"), &gorm.Config{})
+	// secure delete zeroes freed pages so expired messages leave no trace in the file,
+	// incremental vacuum lets retention return them to the file system
+	db, err := gorm.Open(sqlite.Open("data.db?_pragma=secure_delete(1)&_pragma=auto_vacuum(2)"), &gorm.Config{})
 	if err != nil {
 		panic("failed to connect to database")
 	}
 
-	// do auto migrations
-	err = db.Find(&user.UserModel{}).Error
+	// do auto migrations, existing tables only get the missing columns and indexes
+	err = db.AutoMigrate(
+		&user.UserModel{},
+		&user.ContactModel{},
+		&user.RetiredKeyModel{},
+		&user.DeviceModel{},
+		&chat.ChatModel{},
+		&chat.ChatRevisionModel{},
+		&chat.ReactionModel{},
+		&chat.ConversationModel{},
+		&chat.ConversationSettingsModel{},
+		&chat.QueuedPacketModel{},
+		&retention.RetentionPolicyModel{},
+	)
 	if err != nil {
-		log.Println(err)
-		db.AutoMigrate(&user.UserModel{})
-		db.AutoMigrate(&user.ContactModel{})
-		db.AutoMigrate(&chat.ChatModel{})
+		panic("failed to migrate database")
+	}
+
+	// the peer index is covered by the composite history index
+	if db.Migrator().HasIndex(&chat.ChatModel{}, "idx_chat_models_peer_id") {
+		db.Migrator().DropIndex(&chat.ChatModel{}, "idx_chat_models_peer_id")
+	}
+
+	// reactions are unique by their digest now that the emoji is sealed
+	if db.Migrator().HasIndex(&chat.ReactionModel{}, "idx_reaction") {
+		db.Migrator().DropIndex(&chat.ReactionModel{}, "idx_reaction")
+	}
+
+	// messages stored before message IDs existed get one, so they can be replied to,
+	// reacted to and deduplicated like the rest
+	var legacy []chat.ChatModel
+	err = db.Select("id", "created_at").Where("message_id IS NULL OR message_id = ?", "").FindInBatches(&legacy, 500, func(tx *gorm.DB, batch int) error {
+		for _, row := range legacy {
+			messageId := ulid.MustNew(ulid.Timestamp(row.CreatedAt), ulid.DefaultEntropy()).String()
+
+			err := tx.Model(&chat.ChatModel{}).Where("id = ?", row.ID).Update("message_id", messageId).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}).Error
+	if err != nil {
+		panic("failed to migrate database")
 	}
 
 	return db
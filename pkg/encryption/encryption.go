@@ -4,10 +4,13 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/ecdh"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
+	"strings"
 
 	"golang.org/x/crypto/hkdf"
 	"golang.org/x/crypto/scrypt"
@@ -65,6 +68,39 @@ func AESEncrypt(key, payload []byte) ([]byte, error) {
 	return ciphertext, nil
 }
 
+// Derive a 256-bit key from a password, the cost is paid once per derivation
+func DeriveKey(password, salt []byte) ([]byte, error) {
+	key, err := scrypt.Key(password, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, errors.New("failed to generate AES key")
+	}
+
+	return key, nil
+}
+
+// Short SHA-256 of a public key in groups of four, read out to compare identities
+func Fingerprint(pubkey []byte) string {
+	hash := sha256.Sum256(pubkey)
+	encoded := hex.EncodeToString(hash[:16])
+
+	groups := make([]string, 0, len(encoded)/4)
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+
+	return strings.ToUpper(strings.Join(groups, " "))
+}
+
+// Generate a random 256-bit key
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.New("failed to generate key")
+	}
+
+	return key, nil
+}
+
 func GeneratePrivateKey() (*ecdh.PrivateKey, error) {
 	priv, err := ecdh.P256().GenerateKey(rand.Reader)
 	if err != nil {
@@ -74,6 +110,15 @@ func GeneratePrivateKey() (*ecdh.PrivateKey, error) {
 	return priv, nil
 }
 
+func GenerateSigningKey() (ed25519.PrivateKey, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.New("failed to generate signing key")
+	}
+
+	return priv, nil
+}
+
 func GenerateSharedKey(priv *ecdh.PrivateKey, remote *ecdh.PublicKey) ([]byte, error) {
 	shared, err := priv.ECDH(remote)
 	if err != nil {
@@ -95,9 +140,9 @@ func PasswordDecrypt(password, encrypted []byte) ([]byte, error) {
 	encrypted = encrypted[16:]
 
 	// generate AES key from password
-	key, err := scrypt.Key(password, salt, 1<<15, 8, 1, 32)
+	key, err := DeriveKey(password, salt)
 	if err != nil {
-		return nil, errors.New("failed to generate AES key")
+		return nil, err
 	}
 
 	// decrypt data
@@ -116,9 +161,9 @@ func PasswordEncrypt(password, payload []byte) ([]byte, error) {
 	}
 
 	// generate AES key from password
-	key, err := scrypt.Key(password, salt, 1<<15, 8, 1, 32)
+	key, err := DeriveKey(password, salt)
 	if err != nil {
-		return nil, errors.New("failed to generate AES key")
+		return nil, err
 	}
 
 	ciphertext, err := AESEncrypt(key, payload)
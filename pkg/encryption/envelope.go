@@ -0,0 +1,305 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Envelope layout, the header is authenticated as additional data:
+//
+//	magic | version | algorithm | kdf | kdf params | key ID length | key ID | nonce | ciphertext
+//
+// KDF params are only present for password envelopes, for scrypt they are
+// log2 N | r | p | salt length | salt, for Argon2id they are
+// time (uint32) | memory in KiB (uint32) | threads | salt length | salt
+const (
+	ENVELOPE_MAGIC   = "CENV"
+	ENVELOPE_VERSION = 1
+
+	ALG_AES256_GCM = 1
+
+	KDF_NONE     = 0
+	KDF_SCRYPT   = 1
+	KDF_ARGON2ID = 2
+)
+
+type KDFParams struct {
+	LogN   byte
+	R      byte
+	P      byte
+	Argon2 Argon2Params
+	Salt   []byte
+}
+
+type Header struct {
+	Version   byte
+	Algorithm byte
+	KDF       byte
+	Params    KDFParams
+	KeyID     string
+}
+
+// Prefix shared by envelopes of the current version and algorithm
+func CurrentPrefix() []byte {
+	return append([]byte(ENVELOPE_MAGIC), ENVELOPE_VERSION, ALG_AES256_GCM)
+}
+
+func (h Header) encode() []byte {
+	buf := append([]byte(ENVELOPE_MAGIC), h.Version, h.Algorithm, h.KDF)
+
+	switch h.KDF {
+	case KDF_SCRYPT:
+		buf = append(buf, h.Params.LogN, h.Params.R, h.Params.P, byte(len(h.Params.Salt)))
+		buf = append(buf, h.Params.Salt...)
+	case KDF_ARGON2ID:
+		buf = binary.BigEndian.AppendUint32(buf, h.Params.Argon2.Time)
+		buf = binary.BigEndian.AppendUint32(buf, h.Params.Argon2.Memory)
+		buf = append(buf, h.Params.Argon2.Threads, byte(len(h.Params.Salt)))
+		buf = append(buf, h.Params.Salt...)
+	}
+
+	buf = append(buf, byte(len(h.KeyID)))
+	return append(buf, h.KeyID...)
+}
+
+// Check whether data is an envelope sealed with the current format and KDF, the
+// Argon2id cost is compared by callers that know the cost they expect
+func IsCurrent(data []byte) bool {
+	header, _, err := ParseHeader(data)
+	if err != nil || header.Version != ENVELOPE_VERSION || header.Algorithm != ALG_AES256_GCM {
+		return false
+	}
+
+	return header.KDF == KDF_NONE || header.KDF == KDF_ARGON2ID
+}
+
+// Open an envelope sealed with the key, blobs from before envelopes are read as nonce||ciphertext
+func Open(key, data []byte) ([]byte, error) {
+	header, headerLen, err := ParseHeader(data)
+	if err != nil {
+		return AESDecrypt(key, data)
+	}
+
+	if header.KDF != KDF_NONE {
+		return nil, errors.New("envelope needs a password")
+	}
+
+	decrypted, err := openGCM(key, data[:headerLen], data[headerLen:])
+	if err != nil {
+		// a legacy nonce may start with the magic by chance
+		if legacy, legacyErr := AESDecrypt(key, data); legacyErr == nil {
+			return legacy, nil
+		}
+
+		return nil, err
+	}
+
+	return decrypted, nil
+}
+
+func openGCM(key, header, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.New("failed to create cipher")
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.New("failed to create gcm")
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+
+	decrypted, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, errors.New("failed to decrypt data")
+	}
+
+	return decrypted, nil
+}
+
+// Parse the envelope header, returning it with its length in bytes
+func ParseHeader(data []byte) (Header, int, error) {
+	var header Header
+
+	invalid := errors.New("invalid envelope")
+
+	if !bytes.HasPrefix(data, []byte(ENVELOPE_MAGIC)) || len(data) < len(ENVELOPE_MAGIC)+4 {
+		return header, 0, invalid
+	}
+
+	i := len(ENVELOPE_MAGIC)
+	header.Version = data[i]
+	header.Algorithm = data[i+1]
+	header.KDF = data[i+2]
+	i += 3
+
+	if header.Version != ENVELOPE_VERSION || header.Algorithm != ALG_AES256_GCM {
+		return header, 0, errors.New("unsupported envelope")
+	}
+
+	switch header.KDF {
+	case KDF_NONE:
+	case KDF_SCRYPT:
+		if len(data) < i+4 {
+			return header, 0, invalid
+		}
+
+		header.Params.LogN = data[i]
+		header.Params.R = data[i+1]
+		header.Params.P = data[i+2]
+		saltLen := int(data[i+3])
+		i += 4
+
+		if len(data) < i+saltLen {
+			return header, 0, invalid
+		}
+
+		header.Params.Salt = data[i : i+saltLen]
+		i += saltLen
+	case KDF_ARGON2ID:
+		if len(data) < i+10 {
+			return header, 0, invalid
+		}
+
+		header.Params.Argon2.Time = binary.BigEndian.Uint32(data[i:])
+		header.Params.Argon2.Memory = binary.BigEndian.Uint32(data[i+4:])
+		header.Params.Argon2.Threads = data[i+8]
+		saltLen := int(data[i+9])
+		i += 10
+
+		if len(data) < i+saltLen {
+			return header, 0, invalid
+		}
+
+		header.Params.Salt = data[i : i+saltLen]
+		i += saltLen
+	default:
+		return header, 0, errors.New("unsupported envelope")
+	}
+
+	if len(data) < i+1 {
+		return header, 0, invalid
+	}
+
+	keyIdLen := int(data[i])
+	i++
+
+	if len(data) < i+keyIdLen {
+		return header, 0, invalid
+	}
+
+	header.KeyID = string(data[i : i+keyIdLen])
+	i += keyIdLen
+
+	return header, i, nil
+}
+
+// Open a password envelope with the KDF cost it was sealed with, blobs from before
+// envelopes are read as salt||nonce||ciphertext
+func PasswordOpen(password, data []byte) ([]byte, error) {
+	header, headerLen, err := ParseHeader(data)
+	if err != nil {
+		return PasswordDecrypt(password, data)
+	}
+
+	var key []byte
+
+	switch header.KDF {
+	case KDF_SCRYPT:
+		if header.Params.LogN > 30 {
+			return nil, errors.New("unsupported envelope")
+		}
+
+		key, err = scrypt.Key(password, header.Params.Salt, 1<<header.Params.LogN, int(header.Params.R), int(header.Params.P), 32)
+		if err != nil {
+			return nil, errors.New("failed to generate AES key")
+		}
+	case KDF_ARGON2ID:
+		if !header.Params.Argon2.valid() {
+			return nil, errors.New("unsupported envelope")
+		}
+
+		key = header.Params.Argon2.Key(password, header.Params.Salt)
+	default:
+		return nil, errors.New("unsupported envelope")
+	}
+	defer clear(key)
+
+	return openGCM(key, data[:headerLen], data[headerLen:])
+}
+
+// Return the Argon2id cost of a password envelope, false for any other blob
+func PasswordParams(data []byte) (Argon2Params, bool) {
+	header, _, err := ParseHeader(data)
+	if err != nil || header.KDF != KDF_ARGON2ID {
+		return Argon2Params{}, false
+	}
+
+	return header.Params.Argon2, true
+}
+
+// Seal payload in a password envelope, deriving the key with Argon2id at the given cost
+func PasswordSeal(password []byte, cost Argon2Params, keyId string, payload []byte) ([]byte, error) {
+	params := KDFParams{Argon2: cost, Salt: make([]byte, 16)}
+	if _, err := io.ReadFull(rand.Reader, params.Salt); err != nil {
+		return nil, errors.New("failed to create salt")
+	}
+
+	key := cost.Key(password, params.Salt)
+	defer clear(key)
+
+	header := Header{Version: ENVELOPE_VERSION, Algorithm: ALG_AES256_GCM, KDF: KDF_ARGON2ID, Params: params, KeyID: keyId}
+
+	return sealGCM(key, header.encode(), payload)
+}
+
+// Header of envelopes sealed by Seal with the key ID, content is matched against it
+// to find what is still sealed with a key
+func SealedPrefix(keyId string) []byte {
+	return Header{Version: ENVELOPE_VERSION, Algorithm: ALG_AES256_GCM, KDF: KDF_NONE, KeyID: keyId}.encode()
+}
+
+// Seal payload in an envelope, the key ID names the key for readers and is not secret
+func Seal(key []byte, keyId string, payload []byte) ([]byte, error) {
+	if len(keyId) > 255 {
+		return nil, errors.New("key id too long")
+	}
+
+	header := Header{Version: ENVELOPE_VERSION, Algorithm: ALG_AES256_GCM, KDF: KDF_NONE, KeyID: keyId}
+
+	return sealGCM(key, header.encode(), payload)
+}
+
+func sealGCM(key, header, payload []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.New("failed to create cipher")
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.New("failed to create gcm")
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.New("failed to create nonce")
+	}
+
+	// the output must not share memory with the header passed as additional data
+	sealed := make([]byte, 0, len(header)+len(nonce)+len(payload)+gcm.Overhead())
+	sealed = append(sealed, header...)
+	sealed = append(sealed, nonce...)
+
+	return gcm.Seal(sealed, nonce, payload, header), nil
+}
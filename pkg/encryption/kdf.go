@@ -0,0 +1,131 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// latency a single derivation is calibrated to on first run
+	ARGON2_TARGET = time.Millisecond * 400
+
+	// memory in KiB used while calibrating, only the number of passes is tuned
+	ARGON2_MEMORY = 64 * 1024
+
+	// bounds guarding against unusable or hostile parameters read from storage
+	MAX_ARGON2_TIME   = 64
+	MAX_ARGON2_MEMORY = 2 * 1024 * 1024
+)
+
+// Argon2id cost, memory is in KiB
+type Argon2Params struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// floor of every derivation, raising it rehashes passwords and rewraps keys on the next login
+var MinArgon2 = Argon2Params{Time: 2, Memory: ARGON2_MEMORY, Threads: 1}
+
+// Pick the number of passes that makes a derivation take about the target latency here
+func CalibrateArgon2(target time.Duration) Argon2Params {
+	params := Argon2Params{Time: 1, Memory: ARGON2_MEMORY, Threads: uint8(min(runtime.NumCPU(), 4))}
+
+	salt := make([]byte, 16)
+	start := time.Now()
+	argon2.IDKey([]byte("calibration"), salt, params.Time, params.Memory, params.Threads, 32)
+	elapsed := time.Since(start)
+
+	if elapsed > 0 {
+		params.Time = uint32(min(max(int64(target/elapsed), 1), MAX_ARGON2_TIME))
+	}
+
+	return params.Raise(MinArgon2)
+}
+
+// Check whether the cost is at least the other in every dimension
+func (p Argon2Params) Covers(other Argon2Params) bool {
+	return p.Time >= other.Time && p.Memory >= other.Memory && p.Threads >= other.Threads
+}
+
+// Derive a 256-bit key
+func (p Argon2Params) Key(password, salt []byte) []byte {
+	return argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, 32)
+}
+
+// Raise every dimension to at least the other
+func (p Argon2Params) Raise(other Argon2Params) Argon2Params {
+	return Argon2Params{
+		Time:    max(p.Time, other.Time),
+		Memory:  max(p.Memory, other.Memory),
+		Threads: max(p.Threads, other.Threads),
+	}
+}
+
+func (p Argon2Params) valid() bool {
+	return p.Time > 0 && p.Time <= MAX_ARGON2_TIME && p.Memory >= 8*uint32(p.Threads) && p.Memory <= MAX_ARGON2_MEMORY && p.Threads > 0
+}
+
+// Hash a password for login checks in the PHC string format
+func HashPassword(password []byte, params Argon2Params) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", errors.New("failed to create salt")
+	}
+
+	hash := params.Key(password, salt)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// Check a password against its hash, returning the cost it was hashed with. Hashes
+// from before Argon2id are bcrypt and report a zero cost so they get rehashed
+func VerifyPassword(password []byte, hash string) (bool, Argon2Params, error) {
+	var params Argon2Params
+	var version int
+
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), password)
+		return err == nil, params, nil
+	}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, params, errors.New("invalid password hash")
+	}
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return false, params, errors.New("invalid password hash")
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil || !params.valid() {
+		return false, params, errors.New("invalid password hash")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, params, errors.New("invalid password hash")
+	}
+
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(expected) < 16 {
+		return false, params, errors.New("invalid password hash")
+	}
+
+	derived := argon2.IDKey(password, salt, params.Time, params.Memory, params.Threads, uint32(len(expected)))
+
+	return subtle.ConstantTimeCompare(derived, expected) == 1, params, nil
+}
@@ -0,0 +1,12 @@
+// Package memlock keeps key material out of swap where the platform allows it.
+package memlock
+
+// Allocate a buffer for key material, locked in memory where supported
+func Alloc(size int) []byte {
+	buf := make([]byte, size)
+
+	// best effort, the buffer is still usable when the limit is reached
+	Lock(buf)
+
+	return buf
+}
@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+package memlock
+
+func Lock(buf []byte) error {
+	return nil
+}
+
+func Unlock(buf []byte) error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type window struct {
+	count   int
+	resetAt time.Time
+}
+
+type Limiter struct {
+	sync.Mutex
+	limit   int
+	period  time.Duration
+	windows map[string]*window
+}
+
+type ILimiter interface {
+	Allow(key string) bool
+	Reset(key string)
+}
+
+func NewLimiter(limit int, period time.Duration) *Limiter {
+	windows := make(map[string]*window)
+	return &Limiter{limit: limit, period: period, windows: windows}
+}
+
+// Count a hit for key and report whether it is still within the limit
+func (l *Limiter) Allow(key string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+
+	// drop stale windows so the map does not grow unbounded
+	for k, w := range l.windows {
+		if now.After(w.resetAt) {
+			delete(l.windows, k)
+		}
+	}
+
+	w, ok := l.windows[key]
+	if !ok {
+		w = &window{resetAt: now.Add(l.period)}
+		l.windows[key] = w
+	}
+
+	if w.count >= l.limit {
+		return false
+	}
+
+	w.count++
+	return true
+}
+
+func (l *Limiter) Reset(key string) {
+	l.Lock()
+	defer l.Unlock()
+
+	delete(l.windows, key)
+}